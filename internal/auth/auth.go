@@ -1,6 +1,10 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -22,17 +26,22 @@ func CheckPassword(passwordHash, password string) bool {
 	return err == nil
 }
 
-// Создаем JWT токен
-func CreateToken(userID uint64, expireDate time.Time, secretKey []byte) (string, error) {
+// Создаем JWT токен, sessionID - семейство refresh токенов, к которому привязан токен.
+// Токен подписывается текущим ключом набора, в заголовке kid - идентификатор ключа
+func CreateToken(userID uint64, sessionID string, expireDate time.Time, keys *KeySet) (string, error) {
+	key := keys.Current()
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+	token := jwt.NewWithClaims(key.Method, jwt.MapClaims{
 		"user_id": userID,
+		"sid":     sessionID,
 		"iss":     "gophermart",
 		"exp":     expireDate.Unix(),
 		"iat":     time.Now().Unix(),
 	})
 
-	tokenString, err := token.SignedString(secretKey)
+	token.Header["kid"] = key.ID
+
+	tokenString, err := token.SignedString(key.signKey)
 	if err != nil {
 		return "", err
 	}
@@ -40,14 +49,38 @@ func CreateToken(userID uint64, expireDate time.Time, secretKey []byte) (string,
 	return tokenString, nil
 }
 
-// Проверка токена
-func VerifyToken(tokenString string, secretKey []byte) (*jwt.Token, error) {
-	// Парсим токен с нужным методом
+// Генерируем случайную строку из size байт для refresh токенов и идентификаторов сессий
+func GenerateSecureToken(size int) (string, error) {
+	buf := make([]byte, size)
+
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// В БД храним только хеш refresh токена
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// Проверка токена ключом из набора, указанным в заголовке kid
+func VerifyToken(tokenString string, keys *KeySet) (*jwt.Token, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := token.Header["kid"].(string)
+
+		key, ok := keys.Lookup(kid)
+		if !ok {
+			return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+		}
+
+		// Метод подписи должен совпадать с методом ключа
+		if token.Method.Alg() != key.Method.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return secretKey, nil
+		return key.verifyKey, nil
 	})
 
 	if err != nil {
@@ -49,24 +49,26 @@ func TestPasswords(t *testing.T) {
 }
 
 func TestTokens(t *testing.T) {
-	secret := []byte("test_secret_key")
+	keys, err := NewKeySet(NewHMACKey([]byte("test_secret_key")))
+	assert.NoError(t, err)
+
 	testUserID := uint64(1337)
 	expireDate := time.Now().Add(time.Hour)
 
 	t.Run("create token", func(t *testing.T) {
-		token, err := CreateToken(testUserID, expireDate, secret)
+		token, err := CreateToken(testUserID, "session", expireDate, keys)
 
 		assert.NoError(t, err)
 		assert.NotEmpty(t, token)
 	})
 
 	t.Run("successful token verification", func(t *testing.T) {
-		tokenString, err := CreateToken(testUserID, expireDate, secret)
+		tokenString, err := CreateToken(testUserID, "session", expireDate, keys)
 
 		assert.NoError(t, err)
 		assert.NotEmpty(t, tokenString)
 
-		token, err := VerifyToken(tokenString, secret)
+		token, err := VerifyToken(tokenString, keys)
 
 		claims, ok := token.Claims.(jwt.MapClaims)
 
@@ -78,12 +80,13 @@ func TestTokens(t *testing.T) {
 		claimedUserID := uint64(claims["user_id"].(float64))
 
 		assert.Equal(t, testUserID, claimedUserID)
+		assert.Equal(t, "session", claims["sid"])
 	})
 
 	t.Run("verify invalid token", func(t *testing.T) {
 		invalidToken := "invalid"
 
-		token, err := VerifyToken(invalidToken, secret)
+		token, err := VerifyToken(invalidToken, keys)
 
 		assert.Nil(t, token)
 		assert.Error(t, err)
@@ -99,9 +102,30 @@ func TestTokens(t *testing.T) {
 			"lLCJhcHBsaWNhdGlvbklkIjoiODVhMDM4NjctZGNjZi00ODgyLWFkZGUtMWE3OWFlZWM1M" +
 			"GRmIiwicm9sZXMiOlsiY2VvIl19.dee-Ke6RzR0G9avaLNRZf1GUCDfe8Zbk9L2c7yaqKME"
 
-		token, err := VerifyToken(tokenString, secret)
+		token, err := VerifyToken(tokenString, keys)
 
 		assert.Nil(t, token)
 		assert.Error(t, err)
 	})
 }
+
+func TestSecureTokens(t *testing.T) {
+	t.Run("generate token", func(t *testing.T) {
+		first, err := GenerateSecureToken(32)
+		assert.NoError(t, err)
+
+		second, err := GenerateSecureToken(32)
+		assert.NoError(t, err)
+
+		assert.Len(t, first, 43)
+		assert.NotEqual(t, first, second)
+	})
+
+	t.Run("hash token", func(t *testing.T) {
+		hash := HashToken("refresh")
+
+		assert.Len(t, hash, 64)
+		assert.Equal(t, hash, HashToken("refresh"))
+		assert.NotEqual(t, hash, HashToken("other"))
+	})
+}
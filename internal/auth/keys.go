@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var (
+	ErrUnknownKey     = errors.New("unknown signing key")
+	ErrUnsupportedKey = errors.New("unsupported key type")
+	ErrNoSigningKey   = errors.New("current key can't sign tokens")
+)
+
+// Ключ подписи JWT токенов. Ключи, оставшиеся после ротации, хранят только
+// ключ проверки подписи
+type Key struct {
+	ID        string
+	Method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// Симметричный ключ HS256, идентификатор вычисляется из самого секрета,
+// чтобы при смене SECRET_KEY у новых токенов менялся kid
+func NewHMACKey(secret []byte) Key {
+	hash := sha256.Sum256(secret)
+
+	return Key{
+		ID:        hex.EncodeToString(hash[:8]),
+		Method:    jwt.SigningMethodHS256,
+		signKey:   secret,
+		verifyKey: secret,
+	}
+}
+
+// Приватный ключ RSA (RS256) или Ed25519 (EdDSA) в формате PEM
+func ParsePrivateKey(pemData []byte) (Key, error) {
+	if rsaKey, err := jwt.ParseRSAPrivateKeyFromPEM(pemData); err == nil {
+		key, err := newPublicKey(&rsaKey.PublicKey)
+		key.signKey = rsaKey
+		return key, err
+	}
+
+	edKey, err := jwt.ParseEdPrivateKeyFromPEM(pemData)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: %v", ErrUnsupportedKey, err)
+	}
+
+	privateKey, ok := edKey.(ed25519.PrivateKey)
+	if !ok {
+		return Key{}, ErrUnsupportedKey
+	}
+
+	key, err := newPublicKey(privateKey.Public())
+	key.signKey = privateKey
+	return key, err
+}
+
+// Открытый ключ RSA или Ed25519 в формате PEM, годится только для проверки токенов
+func ParsePublicKey(pemData []byte) (Key, error) {
+	if rsaKey, err := jwt.ParseRSAPublicKeyFromPEM(pemData); err == nil {
+		return newPublicKey(rsaKey)
+	}
+
+	edKey, err := jwt.ParseEdPublicKeyFromPEM(pemData)
+	if err != nil {
+		return Key{}, fmt.Errorf("%w: %v", ErrUnsupportedKey, err)
+	}
+
+	return newPublicKey(edKey)
+}
+
+func newPublicKey(publicKey interface{}) (Key, error) {
+	var key Key
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return key, ErrUnsupportedKey
+	}
+
+	key.verifyKey = publicKey
+
+	// Идентификатор ключа - отпечаток JWK по RFC 7638
+	thumbprint, err := key.jwk().thumbprint()
+	if err != nil {
+		return key, err
+	}
+	key.ID = thumbprint
+
+	return key, nil
+}
+
+// Набор ключей: текущий ключ подписывает новые токены, предыдущие
+// продолжают проверять уже выданные токены до истечения их срока
+type KeySet struct {
+	current Key
+	keys    map[string]Key
+}
+
+func NewKeySet(current Key, previous ...Key) (*KeySet, error) {
+	if current.signKey == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	set := &KeySet{
+		current: current,
+		keys:    make(map[string]Key, len(previous)+1),
+	}
+
+	for _, key := range previous {
+		set.keys[key.ID] = key
+	}
+	set.keys[current.ID] = current
+
+	return set, nil
+}
+
+func (s *KeySet) Current() Key {
+	return s.current
+}
+
+// Ищем ключ по заголовку kid токена
+func (s *KeySet) Lookup(kid string) (Key, bool) {
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+// Открытые ключи набора в формате JWK, симметричные ключи не публикуются
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+
+	// Текущий ключ первым, чтобы клиенты видели его без перебора
+	for _, key := range append([]Key{s.current}, s.previous()...) {
+		if _, ok := key.Method.(*jwt.SigningMethodHMAC); ok {
+			continue
+		}
+
+		jwks.Keys = append(jwks.Keys, key.jwk())
+	}
+
+	return jwks
+}
+
+func (s *KeySet) previous() []Key {
+	var keys []Key
+
+	for id, key := range s.keys {
+		if id != s.current.ID {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (k Key) jwk() JWK {
+	jwk := JWK{
+		Kid: k.ID,
+		Use: "sig",
+		Alg: k.Method.Alg(),
+	}
+
+	switch publicKey := k.verifyKey.(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(publicKey)
+	}
+
+	return jwk
+}
+
+// Отпечаток строится по обязательным полям ключа в лексикографическом порядке
+func (j JWK) thumbprint() (string, error) {
+	var members map[string]string
+
+	switch j.Kty {
+	case "RSA":
+		members = map[string]string{"e": j.E, "kty": j.Kty, "n": j.N}
+	case "OKP":
+		members = map[string]string{"crv": j.Crv, "kty": j.Kty, "x": j.X}
+	default:
+		return "", ErrUnsupportedKey
+	}
+
+	// encoding/json сортирует ключи map, что и требуется RFC 7638
+	data, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256(data)
+
+	return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodePEM(t *testing.T, blockType string, der []byte, err error) []byte {
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+}
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := NewHMACKey([]byte("old_secret"))
+	newKey := NewHMACKey([]byte("new_secret"))
+
+	assert.NotEqual(t, oldKey.ID, newKey.ID)
+	assert.Equal(t, oldKey.ID, NewHMACKey([]byte("old_secret")).ID)
+
+	oldKeys, err := NewKeySet(oldKey)
+	require.NoError(t, err)
+
+	rotatedKeys, err := NewKeySet(newKey, oldKey)
+	require.NoError(t, err)
+
+	expireDate := time.Now().Add(time.Hour)
+
+	t.Run("token stamped with kid", func(t *testing.T) {
+		tokenString, err := CreateToken(1, "session", expireDate, rotatedKeys)
+		require.NoError(t, err)
+
+		token, err := VerifyToken(tokenString, rotatedKeys)
+		require.NoError(t, err)
+
+		assert.Equal(t, newKey.ID, token.Header["kid"])
+	})
+
+	t.Run("previous key verifies old token", func(t *testing.T) {
+		tokenString, err := CreateToken(1, "session", expireDate, oldKeys)
+		require.NoError(t, err)
+
+		token, err := VerifyToken(tokenString, rotatedKeys)
+		require.NoError(t, err)
+
+		assert.Equal(t, oldKey.ID, token.Header["kid"])
+	})
+
+	t.Run("removed key rejected", func(t *testing.T) {
+		tokenString, err := CreateToken(1, "session", expireDate, oldKeys)
+		require.NoError(t, err)
+
+		newKeys, err := NewKeySet(newKey)
+		require.NoError(t, err)
+
+		token, err := VerifyToken(tokenString, newKeys)
+
+		assert.Nil(t, token)
+		assert.ErrorIs(t, err, ErrUnknownKey)
+	})
+
+	t.Run("verification only key can't sign", func(t *testing.T) {
+		publicKey, _, _ := ed25519.GenerateKey(rand.Reader)
+		der, err := x509.MarshalPKIXPublicKey(publicKey)
+
+		key, err := ParsePublicKey(encodePEM(t, "PUBLIC KEY", der, err))
+		require.NoError(t, err)
+
+		keys, err := NewKeySet(key)
+
+		assert.Nil(t, keys)
+		assert.ErrorIs(t, err, ErrNoSigningKey)
+	})
+}
+
+func TestAsymmetricKeys(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		privateKey interface{}
+		publicKey  interface{}
+		alg        string
+		kty        string
+	}{
+		{
+			name:       "RS256",
+			privateKey: rsaKey,
+			publicKey:  rsaKey.Public(),
+			alg:        "RS256",
+			kty:        "RSA",
+		},
+		{
+			name:       "EdDSA",
+			privateKey: edKey,
+			publicKey:  edKey.Public(),
+			alg:        "EdDSA",
+			kty:        "OKP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			privateDER, err := x509.MarshalPKCS8PrivateKey(tt.privateKey)
+			current, err := ParsePrivateKey(encodePEM(t, "PRIVATE KEY", privateDER, err))
+			require.NoError(t, err)
+
+			publicDER, err := x509.MarshalPKIXPublicKey(tt.publicKey)
+			public, err := ParsePublicKey(encodePEM(t, "PUBLIC KEY", publicDER, err))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.alg, current.Method.Alg())
+			assert.Equal(t, current.ID, public.ID)
+
+			secretKey := NewHMACKey([]byte("test_secret_key"))
+
+			keys, err := NewKeySet(current, secretKey)
+			require.NoError(t, err)
+
+			tokenString, err := CreateToken(1, "session", time.Now().Add(time.Hour), keys)
+			require.NoError(t, err)
+
+			token, err := VerifyToken(tokenString, keys)
+			require.NoError(t, err)
+			assert.Equal(t, tt.alg, token.Method.Alg())
+
+			// Открытого ключа достаточно для проверки
+			verifyKeys := &KeySet{keys: map[string]Key{public.ID: public}}
+			_, err = VerifyToken(tokenString, verifyKeys)
+			assert.NoError(t, err)
+
+			// Токен, подписанный секретом с kid асимметричного ключа, отклоняется
+			forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sid": "session"})
+			forged.Header["kid"] = current.ID
+			forgedString, err := forged.SignedString([]byte("test_secret_key"))
+			require.NoError(t, err)
+
+			_, err = VerifyToken(forgedString, keys)
+			assert.Error(t, err)
+
+			// В JWKS публикуется только асимметричный ключ
+			jwks := keys.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			assert.Equal(t, current.ID, jwks.Keys[0].Kid)
+			assert.Equal(t, tt.kty, jwks.Keys[0].Kty)
+			assert.Equal(t, tt.alg, jwks.Keys[0].Alg)
+		})
+	}
+}
+
+func TestJWKSSecretKeys(t *testing.T) {
+	keys, err := NewKeySet(NewHMACKey([]byte("test_secret_key")))
+	require.NoError(t, err)
+
+	assert.Empty(t, keys.JWKS().Keys)
+}
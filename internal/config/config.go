@@ -2,22 +2,70 @@ package config
 
 import (
 	"bytes"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/Sadere/gophermart/internal/structs"
 )
 
+var ErrNoSecretKey = errors.New("no SECRET_KEY is set")
+
 type Config struct {
 	Address      structs.NetAddress // Адрес сервера
 	PostgresDSN  string             // DSN строка для подключения к бд
 	SecretKey    string             // Секретный ключ для подписи JWT токенов
 	AccrualAddr  structs.NetAddress // Адрес сервиса accrual
 	PullInterval int                // Интервал опроса accrual в секундах
+	PullWorkers  int                // Количество воркеров, опрашивающих accrual
+	OrderMaxAge  int                // Сколько минут ждать регистрации заказа в accrual, прежде чем признать его невалидным
+	OrderLease   int                // На сколько секунд реплика захватывает заказы для опроса accrual
+
+	ShutdownTimeout int // Время на завершение текущих запросов при остановке сервера в секундах
+	AccessTokenTTL  int // Время жизни access токена в минутах
+	RefreshTokenTTL int // Время жизни refresh токена в часах
+
+	PreviousSecretKeys     []string // Прежние секретные ключи, ими только проверяются ранее выданные токены
+	SigningKeyFile         string   // PEM файл приватного ключа RSA или Ed25519, если задан - токены подписываются им вместо SecretKey
+	PreviousPublicKeyFiles []string // PEM файлы открытых ключей, которыми подписывались токены до ротации
+
+	WebhookInterval    int // Интервал отправки событий на webhook в секундах, он же начальная задержка повтора
+	WebhookMaxAttempts int // Сколько раз пытаемся доставить событие, прежде чем признать его недоставленным
+
+	EventsSink    string // Приемник доменных событий: stdout, file:<путь> или postgres. Пустой - события копятся в outbox
+	EventsChannel string // Канал NOTIFY для приемника postgres
+
+	MetricsAddress structs.NetAddress // Адрес сервера метрик Prometheus и служебных методов, отдельный от адреса API
+	AdminToken     string             // Токен служебных методов. Пустой - служебные методы выключены
+
+	LogLevel  string // Уровень логирования: debug, info, warn или error
+	LogFormat string // Формат логов: json или text
+
+	TraceExporter string // Экспорт трассировок: otlp, stdout или file:<путь>. Пустой - трассировка выключена
+	TraceEndpoint string // URL OTLP коллектора, например http://collector:4318
 }
 
-const DefaultPullInterval = 10
+const (
+	DefaultPullInterval = 10
+	DefaultPullWorkers  = 5
+	DefaultOrderMaxAge  = 24 * 60
+	DefaultOrderLease   = 60
+
+	DefaultShutdownTimeout = 10
+	DefaultAccessTokenTTL  = 15
+	DefaultRefreshTokenTTL = 30 * 24
+
+	DefaultWebhookInterval    = 5
+	DefaultWebhookMaxAttempts = 10
+
+	DefaultEventsChannel = "gophermart_events"
+
+	DefaultLogLevel  = "info"
+	DefaultLogFormat = "json"
+)
 
 func NewConfig(args []string) (Config, error) {
 	flags := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
@@ -31,12 +79,31 @@ func NewConfig(args []string) (Config, error) {
 			Host: "",
 			Port: 8080,
 		},
+		MetricsAddress: structs.NetAddress{
+			Host: "",
+			Port: 9090,
+		},
 	}
 
 	flags.Var(&newConfig.Address, "a", "Адрес сервера")
 	flags.StringVar(&newConfig.PostgresDSN, "d", "", "DSN для postgresql")
 	flags.Var(&newConfig.AccrualAddr, "r", "Адрес сервиса accrual")
 	flags.IntVar(&newConfig.PullInterval, "i", DefaultPullInterval, "Интервал опроса accrual в секундах")
+	flags.IntVar(&newConfig.PullWorkers, "w", DefaultPullWorkers, "Количество воркеров опроса accrual")
+	flags.IntVar(&newConfig.OrderMaxAge, "m", DefaultOrderMaxAge, "Время ожидания регистрации заказа в accrual в минутах")
+	flags.IntVar(&newConfig.OrderLease, "l", DefaultOrderLease, "Время захвата заказов репликой для опроса accrual в секундах")
+	flags.IntVar(&newConfig.ShutdownTimeout, "t", DefaultShutdownTimeout, "Время на завершение запросов при остановке сервера в секундах")
+	flags.IntVar(&newConfig.AccessTokenTTL, "access-ttl", DefaultAccessTokenTTL, "Время жизни access токена в минутах")
+	flags.IntVar(&newConfig.RefreshTokenTTL, "refresh-ttl", DefaultRefreshTokenTTL, "Время жизни refresh токена в часах")
+	flags.IntVar(&newConfig.WebhookInterval, "webhook-interval", DefaultWebhookInterval, "Интервал отправки событий на webhook в секундах")
+	flags.IntVar(&newConfig.WebhookMaxAttempts, "webhook-attempts", DefaultWebhookMaxAttempts, "Количество попыток доставки события на webhook")
+	flags.Var(&newConfig.MetricsAddress, "metrics-address", "Адрес сервера метрик")
+	flags.StringVar(&newConfig.EventsSink, "events-sink", "", "Приемник доменных событий: stdout, file:<путь> или postgres")
+	flags.StringVar(&newConfig.EventsChannel, "events-channel", DefaultEventsChannel, "Канал NOTIFY для приемника postgres")
+	flags.StringVar(&newConfig.LogLevel, "log-level", DefaultLogLevel, "Уровень логирования: debug, info, warn или error")
+	flags.StringVar(&newConfig.LogFormat, "log-format", DefaultLogFormat, "Формат логов: json или text")
+	flags.StringVar(&newConfig.TraceExporter, "trace-exporter", "", "Экспорт трассировок: otlp, stdout или file:<путь>")
+	flags.StringVar(&newConfig.TraceEndpoint, "trace-endpoint", "", "URL OTLP коллектора")
 	err := flags.Parse(args)
 	if err != nil {
 		return newConfig, err
@@ -47,14 +114,21 @@ func NewConfig(args []string) (Config, error) {
 	if envAddr := os.Getenv("RUN_ADDRESS"); len(envAddr) > 0 {
 		err := newConfig.Address.Set(envAddr)
 		if err != nil {
-			log.Fatalf("Invalid server address supplied, RUN_ADDRESS = %s", envAddr)
+			return newConfig, fmt.Errorf("invalid server address supplied, RUN_ADDRESS = %s", envAddr)
 		}
 	}
 
 	if envAccAddr := os.Getenv("ACCRUAL_SYSTEM_ADDRESS"); len(envAccAddr) > 0 {
 		err := newConfig.AccrualAddr.Set(envAccAddr)
 		if err != nil {
-			log.Fatalf("Invalid accrual address supplied, ACCRUAL_SYSTEM_ADDRESS = %s", envAccAddr)
+			return newConfig, fmt.Errorf("invalid accrual address supplied, ACCRUAL_SYSTEM_ADDRESS = %s", envAccAddr)
+		}
+	}
+
+	if envMetricsAddr := os.Getenv("METRICS_ADDRESS"); len(envMetricsAddr) > 0 {
+		err := newConfig.MetricsAddress.Set(envMetricsAddr)
+		if err != nil {
+			return newConfig, fmt.Errorf("invalid metrics address supplied, METRICS_ADDRESS = %s", envMetricsAddr)
 		}
 	}
 
@@ -62,15 +136,157 @@ func NewConfig(args []string) (Config, error) {
 		newConfig.PostgresDSN = envDSN
 	}
 
+	if envWorkers := os.Getenv("ACCRUAL_WORKERS"); len(envWorkers) > 0 {
+		workers, err := strconv.Atoi(envWorkers)
+		if err != nil {
+			return newConfig, fmt.Errorf("invalid accrual workers count supplied, ACCRUAL_WORKERS = %s", envWorkers)
+		}
+
+		newConfig.PullWorkers = workers
+	}
+
+	if envMaxAge := os.Getenv("ORDER_MAX_AGE"); len(envMaxAge) > 0 {
+		maxAge, err := strconv.Atoi(envMaxAge)
+		if err != nil {
+			return newConfig, fmt.Errorf("invalid order max age supplied, ORDER_MAX_AGE = %s", envMaxAge)
+		}
+
+		newConfig.OrderMaxAge = maxAge
+	}
+
+	if envLease := os.Getenv("ORDER_LEASE"); len(envLease) > 0 {
+		lease, err := strconv.Atoi(envLease)
+		if err != nil {
+			return newConfig, fmt.Errorf("invalid order lease supplied, ORDER_LEASE = %s", envLease)
+		}
+
+		newConfig.OrderLease = lease
+	}
+
+	if envTimeout := os.Getenv("SHUTDOWN_TIMEOUT"); len(envTimeout) > 0 {
+		timeout, err := strconv.Atoi(envTimeout)
+		if err != nil {
+			return newConfig, fmt.Errorf("invalid shutdown timeout supplied, SHUTDOWN_TIMEOUT = %s", envTimeout)
+		}
+
+		newConfig.ShutdownTimeout = timeout
+	}
+
+	if envAccessTTL := os.Getenv("ACCESS_TOKEN_TTL"); len(envAccessTTL) > 0 {
+		accessTTL, err := strconv.Atoi(envAccessTTL)
+		if err != nil {
+			return newConfig, fmt.Errorf("invalid access token TTL supplied, ACCESS_TOKEN_TTL = %s", envAccessTTL)
+		}
+
+		newConfig.AccessTokenTTL = accessTTL
+	}
+
+	if envRefreshTTL := os.Getenv("REFRESH_TOKEN_TTL"); len(envRefreshTTL) > 0 {
+		refreshTTL, err := strconv.Atoi(envRefreshTTL)
+		if err != nil {
+			return newConfig, fmt.Errorf("invalid refresh token TTL supplied, REFRESH_TOKEN_TTL = %s", envRefreshTTL)
+		}
+
+		newConfig.RefreshTokenTTL = refreshTTL
+	}
+
+	if envWebhookInterval := os.Getenv("WEBHOOK_INTERVAL"); len(envWebhookInterval) > 0 {
+		webhookInterval, err := strconv.Atoi(envWebhookInterval)
+		if err != nil {
+			return newConfig, fmt.Errorf("invalid webhook interval supplied, WEBHOOK_INTERVAL = %s", envWebhookInterval)
+		}
+
+		newConfig.WebhookInterval = webhookInterval
+	}
+
+	if envWebhookAttempts := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); len(envWebhookAttempts) > 0 {
+		webhookAttempts, err := strconv.Atoi(envWebhookAttempts)
+		if err != nil {
+			return newConfig, fmt.Errorf("invalid webhook max attempts supplied, WEBHOOK_MAX_ATTEMPTS = %s", envWebhookAttempts)
+		}
+
+		newConfig.WebhookMaxAttempts = webhookAttempts
+	}
+
+	if envSink := os.Getenv("EVENTS_SINK"); len(envSink) > 0 {
+		newConfig.EventsSink = envSink
+	}
+
+	if envChannel := os.Getenv("EVENTS_CHANNEL"); len(envChannel) > 0 {
+		newConfig.EventsChannel = envChannel
+	}
+
+	if envLevel := os.Getenv("LOG_LEVEL"); len(envLevel) > 0 {
+		newConfig.LogLevel = envLevel
+	}
+
+	if envFormat := os.Getenv("LOG_FORMAT"); len(envFormat) > 0 {
+		newConfig.LogFormat = envFormat
+	}
+
+	if envExporter := os.Getenv("TRACE_EXPORTER"); len(envExporter) > 0 {
+		newConfig.TraceExporter = envExporter
+	}
+
+	if envEndpoint := os.Getenv("TRACE_ENDPOINT"); len(envEndpoint) > 0 {
+		newConfig.TraceEndpoint = envEndpoint
+	}
+
+	newConfig.PreviousSecretKeys = listFromEnv("PREVIOUS_SECRET_KEYS")
+	newConfig.SigningKeyFile = os.Getenv("JWT_SIGNING_KEY_FILE")
+	newConfig.PreviousPublicKeyFiles = listFromEnv("JWT_PREVIOUS_PUBLIC_KEY_FILES")
+
+	// Секретный ключ не нужен, если токены подписываются асимметричным ключом
 	envSecret, ok := os.LookupEnv("SECRET_KEY")
-	if !ok || len(envSecret) == 0 {
-		log.Fatal("no SECRET_KEY is set!")
+	if (!ok || len(envSecret) == 0) && len(newConfig.SigningKeyFile) == 0 {
+		return newConfig, ErrNoSecretKey
 	}
 
 	newConfig.SecretKey = envSecret
+	newConfig.AdminToken = os.Getenv("ADMIN_TOKEN")
+
+	return newConfig, newConfig.validate()
+}
+
+// Проверяем итоговые значения, чтобы флаги и переменные окружения
+// проходили одни и те же проверки
+func (c Config) validate() error {
+	positive := []struct {
+		name  string
+		value int
+	}{
+		{"pull interval (-i)", c.PullInterval},
+		{"accrual workers count (-w, ACCRUAL_WORKERS)", c.PullWorkers},
+		{"order max age (-m, ORDER_MAX_AGE)", c.OrderMaxAge},
+		{"order lease (-l, ORDER_LEASE)", c.OrderLease},
+		{"access token TTL (-access-ttl, ACCESS_TOKEN_TTL)", c.AccessTokenTTL},
+		{"refresh token TTL (-refresh-ttl, REFRESH_TOKEN_TTL)", c.RefreshTokenTTL},
+		{"webhook interval (-webhook-interval, WEBHOOK_INTERVAL)", c.WebhookInterval},
+		{"webhook max attempts (-webhook-attempts, WEBHOOK_MAX_ATTEMPTS)", c.WebhookMaxAttempts},
+	}
 
-	log.Println("server address: ", newConfig.Address)
-	log.Println("accrual address: ", newConfig.AccrualAddr)
+	for _, setting := range positive {
+		if setting.value < 1 {
+			return fmt.Errorf("invalid %s supplied: %d, must be positive", setting.name, setting.value)
+		}
+	}
+
+	if c.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid shutdown timeout (-t, SHUTDOWN_TIMEOUT) supplied: %d, must not be negative", c.ShutdownTimeout)
+	}
+
+	return nil
+}
+
+// Читаем список значений через запятую из переменной окружения
+func listFromEnv(name string) []string {
+	var values []string
+
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); len(value) > 0 {
+			values = append(values, value)
+		}
+	}
 
-	return newConfig, nil
+	return values
 }
@@ -29,6 +29,26 @@ func TestConfig(t *testing.T) {
 				},
 				SecretKey:    "test",
 				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
 			},
 		},
 		{
@@ -45,6 +65,26 @@ func TestConfig(t *testing.T) {
 				},
 				SecretKey:    "test",
 				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
 			},
 		},
 		{
@@ -64,6 +104,26 @@ func TestConfig(t *testing.T) {
 				},
 				SecretKey:    "test",
 				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
 			},
 		},
 		{
@@ -84,6 +144,26 @@ func TestConfig(t *testing.T) {
 				},
 				SecretKey:    "test",
 				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
 			},
 		},
 		{
@@ -100,6 +180,26 @@ func TestConfig(t *testing.T) {
 				PostgresDSN:  "dsn_test",
 				SecretKey:    "test",
 				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
 			},
 		},
 		{
@@ -117,6 +217,466 @@ func TestConfig(t *testing.T) {
 				PostgresDSN:  "000dsn_test000",
 				SecretKey:    "test",
 				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "workers from arg",
+			args: []string{"-a", "localhost:1337", "-w", "3"},
+			env: map[string]string{
+				"SECRET_KEY": "test",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  3,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "workers from env",
+			args: []string{"-a", "localhost:1337", "-w", "3"},
+			env: map[string]string{
+				"SECRET_KEY":      "test",
+				"ACCRUAL_WORKERS": "16",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  16,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "order max age from env",
+			args: []string{"-a", "localhost:1337", "-m", "30"},
+			env: map[string]string{
+				"SECRET_KEY":    "test",
+				"ORDER_MAX_AGE": "90",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  90,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "shutdown timeout from env",
+			args: []string{"-a", "localhost:1337", "-t", "5"},
+			env: map[string]string{
+				"SECRET_KEY":       "test",
+				"SHUTDOWN_TIMEOUT": "30",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: 30,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "order lease from env",
+			args: []string{"-a", "localhost:1337", "-l", "15"},
+			env: map[string]string{
+				"SECRET_KEY":  "test",
+				"ORDER_LEASE": "120",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   120,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "token ttl",
+			args: []string{"-a", "localhost:1337", "-access-ttl", "5", "-refresh-ttl", "48"},
+			env: map[string]string{
+				"SECRET_KEY":        "test",
+				"REFRESH_TOKEN_TTL": "72",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  5,
+				RefreshTokenTTL: 72,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "signing keys",
+			args: []string{"-a", "localhost:1337"},
+			env: map[string]string{
+				"PREVIOUS_SECRET_KEYS":          "old, older,",
+				"JWT_SIGNING_KEY_FILE":          "/etc/gophermart/jwt.pem",
+				"JWT_PREVIOUS_PUBLIC_KEY_FILES": "/etc/gophermart/jwt_old.pub",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+
+				PreviousSecretKeys:     []string{"old", "older"},
+				SigningKeyFile:         "/etc/gophermart/jwt.pem",
+				PreviousPublicKeyFiles: []string{"/etc/gophermart/jwt_old.pub"},
+			},
+		},
+		{
+			name: "webhooks from env",
+			args: []string{"-a", "localhost:1337", "-webhook-interval", "30"},
+			env: map[string]string{
+				"SECRET_KEY":           "test",
+				"WEBHOOK_MAX_ATTEMPTS": "3",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    30,
+				WebhookMaxAttempts: 3,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "events sink from env",
+			args: []string{"-a", "localhost:1337", "-events-sink", "stdout"},
+			env: map[string]string{
+				"SECRET_KEY":     "test",
+				"EVENTS_SINK":    "postgres",
+				"EVENTS_CHANNEL": "events",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsSink:    "postgres",
+				EventsChannel: "events",
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "metrics address",
+			args: []string{"-a", "localhost:1337", "-metrics-address", "localhost:9100"},
+			env: map[string]string{
+				"SECRET_KEY": "test",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				MetricsAddress: structs.NetAddress{
+					Host: "localhost",
+					Port: 9100,
+				},
+			},
+		},
+		{
+			name: "logging",
+			args: []string{"-a", "localhost:1337", "-log-level", "debug"},
+			env: map[string]string{
+				"SECRET_KEY": "test",
+				"LOG_FORMAT": "text",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  "debug",
+				LogFormat: "text",
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
+			},
+		},
+		{
+			name: "tracing",
+			args: []string{"-a", "localhost:1337", "-trace-exporter", "stdout"},
+			env: map[string]string{
+				"SECRET_KEY":     "test",
+				"TRACE_EXPORTER": "otlp",
+				"TRACE_ENDPOINT": "http://collector:4318",
+			},
+			conf: Config{
+				Address: structs.NetAddress{
+					Host: "localhost",
+					Port: 1337,
+				},
+				SecretKey:    "test",
+				PullInterval: DefaultPullInterval,
+				PullWorkers:  DefaultPullWorkers,
+				OrderMaxAge:  DefaultOrderMaxAge,
+				OrderLease:   DefaultOrderLease,
+
+				ShutdownTimeout: DefaultShutdownTimeout,
+				AccessTokenTTL:  DefaultAccessTokenTTL,
+				RefreshTokenTTL: DefaultRefreshTokenTTL,
+
+				WebhookInterval:    DefaultWebhookInterval,
+				WebhookMaxAttempts: DefaultWebhookMaxAttempts,
+
+				EventsChannel: DefaultEventsChannel,
+
+				LogLevel:  DefaultLogLevel,
+				LogFormat: DefaultLogFormat,
+
+				TraceExporter: "otlp",
+				TraceEndpoint: "http://collector:4318",
+
+				MetricsAddress: structs.NetAddress{
+					Host: "",
+					Port: 9090,
+				},
 			},
 		},
 	}
@@ -142,3 +702,92 @@ func TestConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigErrors(t *testing.T) {
+	var tests = []struct {
+		name    string
+		args    []string
+		env     map[string]string
+		wantErr error
+	}{
+		{
+			name:    "no secret key",
+			args:    []string{},
+			env:     map[string]string{},
+			wantErr: ErrNoSecretKey,
+		},
+		{
+			name: "invalid env address",
+			args: []string{},
+			env: map[string]string{
+				"SECRET_KEY":  "test",
+				"RUN_ADDRESS": "bad address",
+			},
+		},
+		{
+			name: "invalid env workers",
+			args: []string{},
+			env: map[string]string{
+				"SECRET_KEY":      "test",
+				"ACCRUAL_WORKERS": "0",
+			},
+		},
+		{
+			name: "invalid flag workers",
+			args: []string{"-w", "0"},
+			env: map[string]string{
+				"SECRET_KEY": "test",
+			},
+		},
+		{
+			name: "negative flag order max age",
+			args: []string{"-m", "-5"},
+			env: map[string]string{
+				"SECRET_KEY": "test",
+			},
+		},
+		{
+			name: "invalid flag metrics address",
+			args: []string{"-metrics-address", "bad address"},
+			env: map[string]string{
+				"SECRET_KEY": "test",
+			},
+		},
+		{
+			name: "invalid flag metrics port",
+			args: []string{"-metrics-address", "localhost:0"},
+			env: map[string]string{
+				"SECRET_KEY": "test",
+			},
+		},
+		{
+			name: "invalid env metrics address",
+			args: []string{},
+			env: map[string]string{
+				"SECRET_KEY":      "test",
+				"METRICS_ADDRESS": "bad address",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+			}
+
+			_, err := NewConfig(tt.args)
+
+			assert.Error(t, err)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+
+			// Remove envs for next tests
+			for key := range tt.env {
+				os.Unsetenv(key)
+			}
+		})
+	}
+}
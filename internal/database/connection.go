@@ -2,14 +2,20 @@ package database
 
 import (
 	"github.com/jmoiron/sqlx"
+	"github.com/uptrace/opentelemetry-go-extra/otelsql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 )
 
+// Подключение к бд, каждый запрос пишется в трассировку отдельным спаном
+// с текстом запроса, транзакции - спанами begin/commit/rollback
 func NewConnection(driver, dsn string) (*sqlx.DB, error) {
-	db, err := sqlx.Open(driver, dsn)
+	sqlDB, err := otelsql.Open(driver, dsn, otelsql.WithAttributes(semconv.DBSystemPostgreSQL))
 	if err != nil {
 		return nil, err
 	}
 
+	db := sqlx.NewDb(sqlDB, driver)
+
 	if err = db.Ping(); err != nil {
 		return nil, err
 	}
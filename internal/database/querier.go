@@ -0,0 +1,23 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Общий интерфейс *sqlx.DB и *sqlx.Tx. Запросы репозиториев пишутся поверх него,
+// чтобы один и тот же код выполнялся как отдельно, так и внутри транзакции WrapTx
+type Querier interface {
+	sqlx.ExtContext
+
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+var (
+	_ Querier = (*sqlx.DB)(nil)
+	_ Querier = (*sqlx.Tx)(nil)
+)
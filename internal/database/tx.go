@@ -2,11 +2,29 @@ package database
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 
 	"github.com/jmoiron/sqlx"
 )
 
-func WrapTx(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context, tx *sqlx.Tx) error) error {
+var ErrUnsupportedQuerier = errors.New("querier must be *sqlx.DB or *sqlx.Tx")
+
+// Выполняем fn в транзакции. Если q уже транзакция, fn выполняется в ней под точкой
+// сохранения: при ошибке откатываются только изменения fn, а фиксирует транзакцию
+// тот, кто ее начал. Так репозиторий из WithTx можно вызывать внутри чужой транзакции
+func WrapTx(ctx context.Context, q Querier, fn func(ctx context.Context, tx *sqlx.Tx) error) error {
+	switch q := q.(type) {
+	case *sqlx.DB:
+		return wrapDB(ctx, q, fn)
+	case *sqlx.Tx:
+		return wrapSavepoint(ctx, q, fn)
+	default:
+		return ErrUnsupportedQuerier
+	}
+}
+
+func wrapDB(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context, tx *sqlx.Tx) error) error {
 	tx, err := db.BeginTxx(ctx, nil)
 	if err != nil {
 		return err
@@ -14,6 +32,7 @@ func WrapTx(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context, tx *s
 
 	if err = fn(ctx, tx); err != nil {
 		if errRollback := tx.Rollback(); errRollback != nil {
+			slog.ErrorContext(ctx, "failed to rollback transaction", slog.Any("error", errRollback), slog.Any("cause", err))
 			return err
 		}
 
@@ -26,3 +45,22 @@ func WrapTx(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context, tx *s
 
 	return nil
 }
+
+func wrapSavepoint(ctx context.Context, tx *sqlx.Tx, fn func(ctx context.Context, tx *sqlx.Tx) error) error {
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT wrap_tx"); err != nil {
+		return err
+	}
+
+	if err := fn(ctx, tx); err != nil {
+		if _, errRollback := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT wrap_tx"); errRollback != nil {
+			slog.ErrorContext(ctx, "failed to rollback to savepoint", slog.Any("error", errRollback), slog.Any("cause", err))
+			return err
+		}
+
+		return err
+	}
+
+	_, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT wrap_tx")
+
+	return err
+}
@@ -1,17 +1,24 @@
 package gophermart
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/Sadere/gophermart/internal/auth"
 	"github.com/Sadere/gophermart/internal/config"
 	"github.com/Sadere/gophermart/internal/database"
+	"github.com/Sadere/gophermart/internal/logger"
+	"github.com/Sadere/gophermart/internal/metrics"
+	"github.com/Sadere/gophermart/internal/outbox"
+	"github.com/Sadere/gophermart/internal/pubsub"
 	"github.com/Sadere/gophermart/internal/repository"
 	"github.com/Sadere/gophermart/internal/service"
+	"github.com/Sadere/gophermart/internal/tracing"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 
@@ -20,26 +27,57 @@ import (
 )
 
 type GopherMart struct {
-	config         config.Config
-	userRepo       repository.UserRepository
-	userService    *service.UserService
-	orderService   *service.OrderService
-	balanceService *service.BalanceService
-	accService     *service.AccrualService
+	config          config.Config
+	keys            *auth.KeySet
+	userRepo        repository.UserRepository
+	tokenRepo       repository.TokenRepository
+	idempotencyRepo repository.IdempotencyRepository
+	userService     *service.UserService
+	tokenService    *service.TokenService
+	orderService    *service.OrderService
+	balanceService  *service.BalanceService
+	accService      *service.AccrualService
+	webhookService  *service.WebhookService
+	dispatcher      *service.WebhookDispatcher
+	publisher       outbox.Publisher
+	relay           *service.OutboxRelay
+	cleanup         *service.CleanupService
+	broker          *pubsub.Broker
 }
 
 func (g *GopherMart) Start() {
-	r := gin.Default()
+	// Ловим сигналы отключения сервера
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Логирование и восстановление после паники подключаем в SetupRoutes
+	r := gin.New()
+
+	// Трассировку включаем до подключения к БД, чтобы запросы попадали в спаны
+	var traceProvider *tracing.Provider
+	if len(g.config.TraceExporter) > 0 {
+		provider, err := tracing.Setup(ctx, g.config.TraceExporter, g.config.TraceEndpoint)
+		if err != nil {
+			fatal("failed to configure tracing", err)
+		}
+
+		traceProvider = provider
+	}
 
 	// Миграции
 	if err := database.MigrateUp(g.config.PostgresDSN); err != nil {
-		log.Fatal("failed to run migrations: ", err)
+		fatal("failed to run migrations", err)
 	}
 
 	// Подключаемся к БД
 	db, err := database.NewConnection("pgx", g.config.PostgresDSN)
 	if err != nil {
-		log.Fatal("failed to connect to database: ", err)
+		fatal("failed to connect to database", err)
+	}
+
+	// Статистика пула соединений в метриках
+	if err := metrics.RegisterDB(db); err != nil {
+		fatal("failed to register database metrics", err)
 	}
 
 	// Подключаем сервисы
@@ -54,22 +92,123 @@ func (g *GopherMart) Start() {
 		Handler: r,
 	}
 
+	// Закрываем SSE потоки, иначе Shutdown будет ждать их до таймаута
+	srv.RegisterOnShutdown(g.broker.Close)
+
+	// Метрики и служебные методы отдаем на отдельном адресе, чтобы не открывать их вместе с API
+	internalRouter := gin.New()
+	g.SetupInternalRoutes(internalRouter)
+
+	metricsSrv := &http.Server{
+		Addr:    g.config.MetricsAddress.String(),
+		Handler: internalRouter,
+	}
+
 	// Запускаем сервис опроса accrual
-	go g.accService.Pull()
+	pullerDone := make(chan struct{})
+	go func() {
+		defer close(pullerDone)
+		g.accService.Pull(ctx)
+	}()
+
+	// Запускаем доставку событий на webhook
+	dispatcherDone := make(chan struct{})
+	go func() {
+		defer close(dispatcherDone)
+		g.dispatcher.Run(ctx)
+	}()
+
+	// Запускаем публикацию доменных событий, если задан приемник
+	relayDone := make(chan struct{})
+	go func() {
+		defer close(relayDone)
+
+		if g.relay != nil {
+			g.relay.Run(ctx)
+		}
+	}()
+
+	// Запускаем фоновую очистку
+	cleanupDone := make(chan struct{})
+	go func() {
+		defer close(cleanupDone)
+		g.cleanup.Run(ctx)
+	}()
 
 	// Запускаем сервер в фоне
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("listen: %s\n", err)
+			fatal("failed to start server", err)
 		}
 	}()
 
-	// Ловим сигналы отключения сервера
-	quit := make(chan os.Signal, 1)
+	go func() {
+		if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			fatal("failed to start metrics server", err)
+		}
+	}()
+
+	<-ctx.Done()
+	slog.Info("graceful server shutdown")
 
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	log.Println("graceful server shutdown ...")
+	shutdownCtx, cancel := context.WithTimeout(
+		context.Background(),
+		time.Second*time.Duration(g.config.ShutdownTimeout),
+	)
+	defer cancel()
+
+	// Дожидаемся завершения текущих запросов
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to shutdown server", slog.Any("error", err))
+	}
+
+	if err := metricsSrv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("failed to shutdown metrics server", slog.Any("error", err))
+	}
+
+	// Дожидаемся, пока опрос accrual закончит текущую пачку заказов
+	select {
+	case <-pullerDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("accrual poller didn't stop in time")
+	}
+
+	select {
+	case <-dispatcherDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("webhook dispatcher didn't stop in time")
+	}
+
+	select {
+	case <-relayDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("outbox relay didn't stop in time")
+	}
+
+	select {
+	case <-cleanupDone:
+	case <-shutdownCtx.Done():
+		slog.Warn("cleanup didn't stop in time")
+	}
+
+	if g.publisher != nil {
+		if err := g.publisher.Close(); err != nil {
+			slog.Error("failed to close events publisher", slog.Any("error", err))
+		}
+	}
+
+	if err := db.Close(); err != nil {
+		slog.Error("failed to close database connection", slog.Any("error", err))
+	}
+
+	// Отправляем накопленные спаны
+	if traceProvider != nil {
+		if err := traceProvider.Shutdown(shutdownCtx); err != nil {
+			slog.Error("failed to shutdown tracing", slog.Any("error", err))
+		}
+	}
+
+	slog.Info("server stopped")
 }
 
 func (g *GopherMart) InitServices(db *sqlx.DB) {
@@ -77,16 +216,53 @@ func (g *GopherMart) InitServices(db *sqlx.DB) {
 	g.userRepo = userRepo
 	g.userService = service.NewUserService(userRepo)
 
+	tokenRepo := repository.NewPgTokenRepository(db)
+	g.tokenRepo = tokenRepo
+	g.tokenService = service.NewTokenService(
+		tokenRepo,
+		g.keys,
+		time.Minute*time.Duration(g.config.AccessTokenTTL),
+		time.Hour*time.Duration(g.config.RefreshTokenTTL),
+	)
+
 	orderRepo := repository.NewPgOrderRepository(db)
 	g.orderService = service.NewOrderService(orderRepo)
 
+	g.idempotencyRepo = repository.NewPgIdempotencyRepository(db)
+
 	balanceRepo := repository.NewPgBalanceRepository(db)
 	g.balanceService = service.NewBalanceService(balanceRepo)
+	g.cleanup = service.NewCleanupService(balanceRepo, g.idempotencyRepo, tokenRepo)
+
+	webhookRepo := repository.NewPgWebhookRepository(db)
+	g.webhookService = service.NewWebhookService(webhookRepo)
+	g.dispatcher = service.NewWebhookDispatcher(
+		webhookRepo,
+		time.Second*time.Duration(g.config.WebhookInterval),
+		uint(g.config.WebhookMaxAttempts),
+	)
+
+	if len(g.config.EventsSink) > 0 {
+		publisher, err := outbox.NewPublisher(g.config.EventsSink, db, g.config.EventsChannel)
+		if err != nil {
+			fatal("failed to create events publisher", err)
+		}
+
+		g.publisher = publisher
+		g.relay = service.NewOutboxRelay(repository.NewPgOutboxRepository(db), publisher, time.Second)
+	}
+
+	g.broker = pubsub.NewBroker()
 
 	g.accService = service.NewAccrualService(orderRepo,
 		balanceRepo,
 		g.config.AccrualAddr,
 		time.Second*time.Duration(g.config.PullInterval),
+		g.config.PullWorkers,
+		time.Minute*time.Duration(g.config.OrderMaxAge),
+		time.Second*time.Duration(g.config.OrderLease),
+		time.Second*time.Duration(g.config.ShutdownTimeout),
+		g.broker,
 	)
 }
 
@@ -94,10 +270,36 @@ func Run() {
 	app := &GopherMart{}
 	conf, err := config.NewConfig(os.Args[1:])
 	if err != nil {
-		log.Fatalln("failed to parse cmd line flags", err)
+		// Логгер из конфига еще не настроен, пишем стандартным slog
+		fatal("failed to parse config", err)
 	}
 
 	app.config = conf
 
+	// До разбора конфига пишем стандартным slog, дальше - в заданном формате
+	appLogger, err := logger.New(os.Stderr, conf.LogLevel, conf.LogFormat)
+	if err != nil {
+		fatal("failed to configure logger", err)
+	}
+
+	slog.SetDefault(appLogger)
+
+	slog.Info("starting server",
+		slog.String("address", conf.Address.String()),
+		slog.String("accrual_address", conf.AccrualAddr.String()),
+		slog.String("metrics_address", conf.MetricsAddress.String()),
+	)
+
+	app.keys, err = newKeySet(conf)
+	if err != nil {
+		fatal("failed to load signing keys", err)
+	}
+
 	app.Start()
 }
+
+// Логируем ошибку, после которой сервер не может работать, и завершаемся
+func fatal(msg string, err error) {
+	slog.Error(msg, slog.Any("error", err))
+	os.Exit(1)
+}
@@ -0,0 +1,55 @@
+package gophermart
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Sadere/gophermart/internal/auth"
+	"github.com/Sadere/gophermart/internal/config"
+)
+
+// Собираем набор ключей подписи JWT из конфига. Текущим становится приватный
+// ключ из файла, если он задан, иначе SecretKey. Остальные ключи из конфига
+// остаются только для проверки токенов, выданных до ротации
+func newKeySet(conf config.Config) (*auth.KeySet, error) {
+	var previous []auth.Key
+
+	for _, secret := range conf.PreviousSecretKeys {
+		previous = append(previous, auth.NewHMACKey([]byte(secret)))
+	}
+
+	for _, path := range conf.PreviousPublicKeyFiles {
+		pemData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key %s: %w", path, err)
+		}
+
+		key, err := auth.ParsePublicKey(pemData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+		}
+
+		previous = append(previous, key)
+	}
+
+	if len(conf.SigningKeyFile) == 0 {
+		return auth.NewKeySet(auth.NewHMACKey([]byte(conf.SecretKey)), previous...)
+	}
+
+	pemData, err := os.ReadFile(conf.SigningKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	current, err := auth.ParsePrivateKey(pemData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	// При переходе с HS256 на асимметричную подпись старый секрет еще проверяет выданные токены
+	if len(conf.SecretKey) > 0 {
+		previous = append(previous, auth.NewHMACKey([]byte(conf.SecretKey)))
+	}
+
+	return auth.NewKeySet(current, previous...)
+}
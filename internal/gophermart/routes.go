@@ -2,36 +2,81 @@ package gophermart
 
 import (
 	"github.com/Sadere/gophermart/internal/handler"
+	"github.com/Sadere/gophermart/internal/metrics"
 	"github.com/Sadere/gophermart/internal/middleware"
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
 )
 
 func (g *GopherMart) SetupRoutes(r *gin.Engine, db *sqlx.DB) {
-	userHandler := handler.NewAuthHandler(g.userService, g.config)
+	userHandler := handler.NewAuthHandler(g.userService, g.tokenService)
 	orderHandler := handler.NewOrderHandler(g.orderService)
 	balanceHandler := handler.NewBalanceHandler(g.balanceService)
+	jwksHandler := handler.NewJWKSHandler(g.keys)
+	eventsHandler := handler.NewEventsHandler(g.broker)
+	webhookHandler := handler.NewWebhookHandler(g.webhookService)
 
-	apiMiddleware := middleware.NewMiddleware(g.userRepo)
+	apiMiddleware := middleware.NewMiddleware(g.userRepo, g.tokenRepo)
+
+	// Метрики и логи снаружи Recovery, чтобы запросы с паникой попадали в них с кодом 500
+	r.Use(middleware.Tracing(), middleware.RequestID(), middleware.Logger(), middleware.Metrics(), gin.Recovery())
+
+	r.GET("/.well-known/jwks.json", jwksHandler.GetKeys)
 
 	api := r.Group("/api")
 	{
 		api.POST("/user/register", userHandler.Register)
 		api.POST("/user/login", userHandler.Login)
+		api.POST("/user/token/refresh", userHandler.Refresh)
 	}
 
 	// Методы, доступные только авторизованным пользователям
 	apiAuthRoutes := api.Group("")
 
-	apiAuthRoutes.Use(apiMiddleware.AuthCheck([]byte(g.config.SecretKey)))
+	apiAuthRoutes.Use(apiMiddleware.AuthCheck(g.keys))
 	{
+		apiAuthRoutes.POST("/user/logout", userHandler.Logout)
+
 		// Orders
 		apiAuthRoutes.POST("/user/orders", orderHandler.SaveOrder)
+		apiAuthRoutes.POST("/user/orders/batch", orderHandler.SaveOrdersBatch)
 		apiAuthRoutes.GET("/user/orders", middleware.JSON(), orderHandler.ListOrders)
+		apiAuthRoutes.GET("/user/orders/events", eventsHandler.StreamOrderEvents)
+		apiAuthRoutes.GET("/user/orders/:number", middleware.JSON(), orderHandler.GetOrder)
 
 		// Balance
-		apiAuthRoutes.POST("/user/balance/withdraw", balanceHandler.RegisterWithdraw)
+		apiAuthRoutes.POST("/user/balance/withdraw", middleware.Idempotency(g.idempotencyRepo), balanceHandler.RegisterWithdraw)
 		apiAuthRoutes.GET("/user/withdrawals", balanceHandler.ListUserWithdrawals)
+		apiAuthRoutes.POST("/user/withdrawals/:number/confirm", balanceHandler.ConfirmWithdrawal)
+		apiAuthRoutes.POST("/user/withdrawals/:number/cancel", balanceHandler.CancelWithdrawal)
 		apiAuthRoutes.GET("/user/balance", balanceHandler.GetUserBalance)
+		apiAuthRoutes.GET("/user/balance/history", balanceHandler.GetBalanceHistory)
+
+		// Webhooks
+		apiAuthRoutes.POST("/user/webhooks", webhookHandler.CreateWebhook)
+		apiAuthRoutes.GET("/user/webhooks", webhookHandler.ListWebhooks)
+		apiAuthRoutes.DELETE("/user/webhooks/:id", webhookHandler.DeleteWebhook)
+		apiAuthRoutes.GET("/user/webhooks/deliveries/dead", webhookHandler.ListDeadDeliveries)
+	}
+}
+
+// Служебные методы на адресе метрик. Методы, меняющие данные, требуют служебный токен
+// и выключены, если он не задан
+func (g *GopherMart) SetupInternalRoutes(r *gin.Engine) {
+	balanceHandler := handler.NewBalanceHandler(g.balanceService)
+
+	r.Use(middleware.RequestID(), middleware.Logger(), gin.Recovery())
+
+	r.GET("/metrics", gin.WrapH(metrics.Handler()))
+
+	if len(g.config.AdminToken) == 0 {
+		return
+	}
+
+	internal := r.Group("/internal")
+
+	internal.Use(middleware.ServiceToken(g.config.AdminToken))
+	{
+		internal.POST("/withdrawals/:number/refund", balanceHandler.RefundWithdrawal)
 	}
 }
@@ -5,10 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"time"
 
-	"github.com/Sadere/gophermart/internal/auth"
-	"github.com/Sadere/gophermart/internal/config"
 	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/service"
 	"github.com/gin-gonic/gin"
@@ -16,8 +13,8 @@ import (
 )
 
 type AuthHandler struct {
-	userService *service.UserService
-	config      config.Config
+	userService  *service.UserService
+	tokenService *service.TokenService
 }
 
 type AuthRequest struct {
@@ -25,10 +22,14 @@ type AuthRequest struct {
 	Password string `json:"password"`
 }
 
-func NewAuthHandler(userService *service.UserService, config config.Config) *AuthHandler {
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+func NewAuthHandler(userService *service.UserService, tokenService *service.TokenService) *AuthHandler {
 	return &AuthHandler{
-		userService: userService,
-		config:      config,
+		userService:  userService,
+		tokenService: tokenService,
 	}
 }
 
@@ -43,7 +44,7 @@ func authRequest(c *gin.Context) (*AuthRequest, error) {
 	err = json.Unmarshal(
 		body,
 		request,
-	
+
 		json.RejectUnknownMembers(true),
 	)
 	if err != nil {
@@ -67,7 +68,7 @@ func (u *AuthHandler) Register(c *gin.Context) {
 	}
 
 	// Регистрируем юзера
-	newUser, err := u.userService.RegisterUser(request.Login, request.Password)
+	newUser, err := u.userService.RegisterUser(c.Request.Context(), request.Login, request.Password)
 
 	// Проверяем существует ли юзер с таким логином
 	if errors.Is(err, &service.ErrUserExists{Login: request.Login}) {
@@ -95,7 +96,7 @@ func (u *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Пытаемся залогиниться
-	user, err := u.userService.LoginUser(request.Login, request.Password)
+	user, err := u.userService.LoginUser(c.Request.Context(), request.Login, request.Password)
 
 	// Неверные данные для авторизации
 	if errors.Is(err, service.ErrBadCredentials) {
@@ -113,16 +114,63 @@ func (u *AuthHandler) Login(c *gin.Context) {
 	u.authUser(user.ID, c)
 }
 
+// Обмениваем refresh токен на новую пару токенов
+func (u *AuthHandler) Refresh(c *gin.Context) {
+	request := RefreshRequest{}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("failed to parse request: %v", err),
+		})
+		return
+	}
+
+	pair, err := u.tokenService.RefreshTokens(c.Request.Context(), request.RefreshToken)
+
+	// Недействительный или повторно использованный токен
+	if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to refresh tokens"})
+		return
+	}
+
+	respondTokens(c, pair)
+}
+
+// Завершаем текущую сессию пользователя
+func (u *AuthHandler) Logout(c *gin.Context) {
+	sessionID := c.GetString("session_id")
+	if len(sessionID) == 0 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session not found"})
+		return
+	}
+
+	if err := u.tokenService.Logout(c.Request.Context(), sessionID); err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to logout"})
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
 func (u *AuthHandler) authUser(userID uint64, c *gin.Context) {
-	// Возвращаем токен авторизации
-	token, err := auth.CreateToken(userID, time.Now().Add(time.Hour*24), []byte(u.config.SecretKey))
+	// Начинаем новую сессию и возвращаем токены авторизации
+	pair, err := u.tokenService.IssueTokens(c.Request.Context(), userID)
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to generate access token"})
 		return
 	}
 
-	c.Header("Authorization", fmt.Sprintf("Bearer %s", token))
-	c.Status(http.StatusOK)
+	respondTokens(c, pair)
+}
+
+func respondTokens(c *gin.Context, pair model.TokenPair) {
+	c.Header("Authorization", fmt.Sprintf("Bearer %s", pair.AccessToken))
+	c.JSON(http.StatusOK, pair)
 }
 
 func getCurrentUser(c *gin.Context) (model.User, error) {
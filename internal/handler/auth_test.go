@@ -2,16 +2,21 @@ package handler
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Sadere/gophermart/internal/auth"
-	"github.com/Sadere/gophermart/internal/config"
+	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/repository"
 	"github.com/Sadere/gophermart/internal/service"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -24,8 +29,8 @@ func TestAuthHandlers(t *testing.T) {
 	repo := &repository.TestUserRepository{
 		RegisteredUserPwHash: registeredUserPwHash,
 	}
-	service := service.NewUserService(repo)
-	authHandler := NewAuthHandler(service, config.Config{})
+	userService := service.NewUserService(repo)
+	authHandler := NewAuthHandler(userService, newTestTokenService())
 
 	r := gin.New()
 	r.POST("/api/user/register", authHandler.Register)
@@ -178,9 +183,123 @@ func TestAuthHandlers(t *testing.T) {
 
 			if tt.want.authorizationHeader {
 				assert.NotEmpty(t, result.Header.Get("Authorization"))
+
+				var pair model.TokenPair
+				assert.NoError(t, json.NewDecoder(result.Body).Decode(&pair))
+				assert.NotEmpty(t, pair.RefreshToken)
 			} else {
 				assert.Empty(t, result.Header.Get("Authorization"))
 			}
 		})
 	}
 }
+
+var testKeys, _ = auth.NewKeySet(auth.NewHMACKey([]byte("test_secret_key")))
+
+func newTestTokenService() *service.TokenService {
+	return service.NewTokenService(
+		repository.NewTestTokenRepository(),
+		testKeys,
+		time.Minute,
+		time.Hour,
+	)
+}
+
+func TestRefreshAndLogout(t *testing.T) {
+	tokenService := newTestTokenService()
+	authHandler := NewAuthHandler(service.NewUserService(&repository.TestUserRepository{}), tokenService)
+
+	r := gin.New()
+	r.POST("/api/user/token/refresh", authHandler.Refresh)
+	r.POST("/api/user/logout", func(c *gin.Context) {
+		c.Set("session_id", c.Query("sid"))
+	}, authHandler.Logout)
+
+	refresh := func(refreshToken string) (int, model.TokenPair) {
+		body := fmt.Sprintf(`{"refresh_token":"%s"}`, refreshToken)
+		request := httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", bytes.NewBufferString(body))
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, request)
+
+		result := w.Result()
+		defer result.Body.Close()
+
+		var pair model.TokenPair
+		if result.StatusCode == http.StatusOK {
+			assert.NoError(t, json.NewDecoder(result.Body).Decode(&pair))
+			assert.Equal(t, "Bearer "+pair.AccessToken, result.Header.Get("Authorization"))
+		}
+
+		return result.StatusCode, pair
+	}
+
+	t.Run("rotate refresh token", func(t *testing.T) {
+		pair, err := tokenService.IssueTokens(context.Background(), 111)
+		assert.NoError(t, err)
+
+		code, rotated := refresh(pair.RefreshToken)
+		assert.Equal(t, http.StatusOK, code)
+		assert.NotEqual(t, pair.RefreshToken, rotated.RefreshToken)
+
+		code, _ = refresh(rotated.RefreshToken)
+		assert.Equal(t, http.StatusOK, code)
+	})
+
+	t.Run("reused refresh token revokes session", func(t *testing.T) {
+		pair, err := tokenService.IssueTokens(context.Background(), 111)
+		assert.NoError(t, err)
+
+		code, rotated := refresh(pair.RefreshToken)
+		assert.Equal(t, http.StatusOK, code)
+
+		code, _ = refresh(pair.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, code)
+
+		code, _ = refresh(rotated.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("unknown refresh token", func(t *testing.T) {
+		code, _ := refresh("unknown")
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("empty request", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/api/user/token/refresh", bytes.NewBufferString(`{}`))
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, request)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("logout revokes refresh token", func(t *testing.T) {
+		pair, err := tokenService.IssueTokens(context.Background(), 111)
+		assert.NoError(t, err)
+
+		token, err := auth.VerifyToken(pair.AccessToken, testKeys)
+		assert.NoError(t, err)
+
+		claims := token.Claims.(jwt.MapClaims)
+
+		request := httptest.NewRequest(http.MethodPost, "/api/user/logout?sid="+claims["sid"].(string), nil)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, request)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		code, _ := refresh(pair.RefreshToken)
+		assert.Equal(t, http.StatusUnauthorized, code)
+	})
+
+	t.Run("logout without session", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodPost, "/api/user/logout", nil)
+		w := httptest.NewRecorder()
+
+		r.ServeHTTP(w, request)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
@@ -5,14 +5,16 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/service"
 	"github.com/Sadere/gophermart/internal/structs"
 	"github.com/gin-gonic/gin"
 )
 
 type RegisterWithdrawRequest struct {
-	Order string  `json:"order" binding:"required"`
-	Sum   float64 `json:"sum" binding:"required,gt=0"`
+	Order string        `json:"order" binding:"required"`
+	Sum   structs.Money `json:"sum" binding:"required,gt=0"`
+	Hold  bool          `json:"hold"` // Зарезервировать баллы до подтверждения
 }
 
 type BalanceHandler struct {
@@ -41,7 +43,7 @@ func (h *BalanceHandler) RegisterWithdraw(c *gin.Context) {
 		return
 	}
 
-	err = h.balanceService.RegisterWithdraw(currentUser.ID, request.Order, request.Sum)
+	err = h.balanceService.RegisterWithdraw(c.Request.Context(), currentUser.ID, request.Order, request.Sum, request.Hold)
 
 	// Невалидный номер заказа на вывод
 	if errors.Is(err, service.ErrOrderInvalidNumber) {
@@ -55,6 +57,12 @@ func (h *BalanceHandler) RegisterWithdraw(c *gin.Context) {
 		return
 	}
 
+	// Заказ уже оплачен баллами
+	if errors.Is(err, service.ErrWithdrawalExists) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Неизвестная ошибка
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -65,9 +73,19 @@ func (h *BalanceHandler) RegisterWithdraw(c *gin.Context) {
 }
 
 type ListWithdrawalItem struct {
-	Order       string          `json:"order"`
-	Sum         float64         `json:"sum"`
-	ProcessedAt structs.RFCTime `json:"processed_at"`
+	Order       string                 `json:"order"`
+	Sum         structs.Money          `json:"sum"`
+	Status      model.WithdrawalStatus `json:"status"`
+	ProcessedAt structs.RFCTime        `json:"processed_at"`
+}
+
+func newListWithdrawalItem(withdrawal model.Withdrawal) ListWithdrawalItem {
+	return ListWithdrawalItem{
+		Order:       withdrawal.Number,
+		Sum:         withdrawal.Amount,
+		Status:      withdrawal.Status,
+		ProcessedAt: withdrawal.CreatedAt,
+	}
 }
 
 type ListWithdrawalsResponse []ListWithdrawalItem
@@ -79,7 +97,24 @@ func (h *BalanceHandler) ListUserWithdrawals(c *gin.Context) {
 		return
 	}
 
-	withdrawals, err := h.balanceService.ListUserWithdrawals(currentUser.ID)
+	page, err := pageParams(c, 0)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, err := dateRangeParams(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	withdrawals, nextCursor, err := h.balanceService.ListUserWithdrawals(c.Request.Context(), model.WithdrawalFilter{
+		UserID: currentUser.ID,
+		From:   from,
+		To:     to,
+		Page:   page,
+	})
 
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -94,16 +129,95 @@ func (h *BalanceHandler) ListUserWithdrawals(c *gin.Context) {
 	response := ListWithdrawalsResponse{}
 
 	for _, withdrawal := range withdrawals {
-		response = append(response, ListWithdrawalItem{
-			Order:       withdrawal.Number,
-			Sum:         withdrawal.Amount,
-			ProcessedAt: withdrawal.CreatedAt,
-		})
+		response = append(response, newListWithdrawalItem(withdrawal))
 	}
 
+	setNextCursor(c, nextCursor)
+
 	c.JSON(http.StatusOK, response)
 }
 
+// Подтверждение зарезервированного списания
+func (h *BalanceHandler) ConfirmWithdrawal(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	withdrawal, err := h.balanceService.ConfirmWithdrawal(c.Request.Context(), currentUser.ID, c.Param("number"))
+
+	if errors.Is(err, service.ErrWithdrawalNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Списание уже подтверждено, отменено или возвращено
+	if errors.Is(err, service.ErrWithdrawalNotPending) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newListWithdrawalItem(withdrawal))
+}
+
+// Отмена неподтвержденного списания с возвратом баллов на баланс
+func (h *BalanceHandler) CancelWithdrawal(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	withdrawal, err := h.balanceService.CancelWithdrawal(c.Request.Context(), currentUser.ID, c.Param("number"))
+
+	if errors.Is(err, service.ErrWithdrawalNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Списание уже подтверждено, отменено или возвращено
+	if errors.Is(err, service.ErrWithdrawalNotReturned) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newListWithdrawalItem(withdrawal))
+}
+
+// Возврат оплаты завершенного списания, доступен только на служебном адресе
+func (h *BalanceHandler) RefundWithdrawal(c *gin.Context) {
+	withdrawal, err := h.balanceService.RefundWithdrawal(c.Request.Context(), c.Param("number"))
+
+	if errors.Is(err, service.ErrWithdrawalNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Списание еще не подтверждено, отменено или уже возвращено
+	if errors.Is(err, service.ErrWithdrawalNotReturned) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, newListWithdrawalItem(withdrawal))
+}
+
 func (h *BalanceHandler) GetUserBalance(c *gin.Context) {
 	currentUser, err := getCurrentUser(c)
 	if err != nil {
@@ -111,7 +225,7 @@ func (h *BalanceHandler) GetUserBalance(c *gin.Context) {
 		return
 	}
 
-	balance, err := h.balanceService.GetUserBalance(currentUser.ID)
+	balance, err := h.balanceService.GetUserBalance(c.Request.Context(), currentUser.ID)
 
 	if err != nil {
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -120,3 +234,55 @@ func (h *BalanceHandler) GetUserBalance(c *gin.Context) {
 
 	c.JSON(http.StatusOK, balance)
 }
+
+type BalanceHistoryItem struct {
+	Type        string          `json:"type"`
+	Order       *string         `json:"order,omitempty"`
+	Amount      structs.Money   `json:"amount"`
+	Balance     structs.Money   `json:"balance"`
+	ProcessedAt structs.RFCTime `json:"processed_at"`
+}
+
+type BalanceHistoryResponse []BalanceHistoryItem
+
+func (h *BalanceHandler) GetBalanceHistory(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := pageParams(c, DefaultPageLimit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	history, nextCursor, err := h.balanceService.GetBalanceHistory(c.Request.Context(), currentUser.ID, page)
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(history) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	response := BalanceHistoryResponse{}
+
+	for _, entry := range history {
+		response = append(response, BalanceHistoryItem{
+			Type:        string(entry.Type),
+			Order:       entry.OrderNumber,
+			Amount:      entry.Amount,
+			Balance:     entry.Balance,
+			ProcessedAt: entry.CreatedAt,
+		})
+	}
+
+	setNextCursor(c, nextCursor)
+
+	c.JSON(http.StatusOK, response)
+}
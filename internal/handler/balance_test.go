@@ -62,6 +62,14 @@ func TestRegisterWithdraw(t *testing.T) {
 			body:     []byte(`{"order":"41004","sum":100}`),
 			wantCode: http.StatusOK,
 		},
+		{
+			name:     "withdraw on hold",
+			request:  "/api/user/balance/withdraw",
+			userID:   111,
+			method:   http.MethodPost,
+			body:     []byte(`{"order":"41004","sum":100,"hold":true}`),
+			wantCode: http.StatusOK,
+		},
 		{
 			name:     "unauthorized",
 			request:  "/api/user/balance/withdraw",
@@ -94,6 +102,14 @@ func TestRegisterWithdraw(t *testing.T) {
 			body:     []byte(`{"order":"41004","sum":100}`),
 			wantCode: http.StatusPaymentRequired,
 		},
+		{
+			name:     "order already paid",
+			request:  "/api/user/balance/withdraw",
+			userID:   666,
+			method:   http.MethodPost,
+			body:     []byte(`{"order":"41004","sum":100}`),
+			wantCode: http.StatusConflict,
+		},
 		{
 			name:     "unexpected error",
 			request:  "/api/user/balance/withdraw",
@@ -151,7 +167,7 @@ func TestListUserWithdrawals(t *testing.T) {
 			method:  http.MethodGet,
 			want: want{
 				code: http.StatusOK,
-				body: `[{"order":"78477","sum":200,"processed_at":"2024-01-01T00:00:00Z"}]`,
+				body: `[{"order":"78477","sum":200,"status":"COMPLETED","processed_at":"2024-01-01T00:00:00Z"}]`,
 			},
 		},
 		{
@@ -211,6 +227,230 @@ func TestListUserWithdrawals(t *testing.T) {
 	}
 }
 
+func TestCancelWithdrawal(t *testing.T) {
+	balanceHandler := setupBalanceHandler()
+
+	r := gin.New()
+	r.Use(authMiddleware())
+
+	r.POST("/api/user/withdrawals/:number/cancel", balanceHandler.CancelWithdrawal)
+
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name   string
+		number string
+		userID int
+		want   want
+	}{
+		{
+			name:   "cancel pending withdrawal",
+			number: "89920",
+			userID: 111,
+			want: want{
+				code: http.StatusOK,
+				body: `{"order":"89920","sum":100,"status":"CANCELLED","processed_at":"2024-01-01T00:00:00Z"}`,
+			},
+		},
+		{
+			name:   "completed withdrawal",
+			number: "78477",
+			userID: 111,
+			want: want{
+				code: http.StatusConflict,
+			},
+		},
+		{
+			name:   "unknown withdrawal",
+			number: "41004",
+			userID: 111,
+			want: want{
+				code: http.StatusNotFound,
+			},
+		},
+		{
+			name:   "unauthorized",
+			number: "78477",
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+		{
+			name:   "unexpected error",
+			number: "78477",
+			userID: 222,
+			want: want{
+				code: http.StatusInternalServerError,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("/api/user/withdrawals/%s/cancel", tt.number)
+
+			if tt.userID > 0 {
+				target += fmt.Sprintf("?user_id=%d", tt.userID)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, target, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			result := w.Result()
+
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.want.code, result.StatusCode)
+
+			if len(tt.want.body) > 0 {
+				resultBody, err := io.ReadAll(result.Body)
+				assert.NoError(t, err)
+
+				assert.Equal(t, tt.want.body, string(resultBody))
+			}
+		})
+	}
+}
+
+func TestConfirmWithdrawal(t *testing.T) {
+	balanceHandler := setupBalanceHandler()
+
+	r := gin.New()
+	r.Use(authMiddleware())
+
+	r.POST("/api/user/withdrawals/:number/confirm", balanceHandler.ConfirmWithdrawal)
+
+	tests := []struct {
+		name   string
+		number string
+		userID int
+		code   int
+	}{
+		{
+			name:   "confirm pending withdrawal",
+			number: "89920",
+			userID: 111,
+			code:   http.StatusOK,
+		},
+		{
+			name:   "not pending",
+			number: "78477",
+			userID: 111,
+			code:   http.StatusConflict,
+		},
+		{
+			name:   "unknown withdrawal",
+			number: "89920",
+			userID: 333,
+			code:   http.StatusNotFound,
+		},
+		{
+			name:   "unauthorized",
+			number: "89920",
+			code:   http.StatusUnauthorized,
+		},
+		{
+			name:   "unexpected error",
+			number: "89920",
+			userID: 777,
+			code:   http.StatusInternalServerError,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("/api/user/withdrawals/%s/confirm", tt.number)
+
+			if tt.userID > 0 {
+				target += fmt.Sprintf("?user_id=%d", tt.userID)
+			}
+
+			request := httptest.NewRequest(http.MethodPost, target, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			result := w.Result()
+
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.code, result.StatusCode)
+		})
+	}
+}
+
+func TestRefundWithdrawal(t *testing.T) {
+	balanceHandler := setupBalanceHandler()
+
+	r := gin.New()
+
+	r.POST("/internal/withdrawals/:number/refund", balanceHandler.RefundWithdrawal)
+
+	type want struct {
+		code int
+		body string
+	}
+	tests := []struct {
+		name   string
+		number string
+		want   want
+	}{
+		{
+			name:   "refund completed withdrawal",
+			number: "78477",
+			want: want{
+				code: http.StatusOK,
+				body: `{"order":"78477","sum":200,"status":"REFUNDED","processed_at":"2024-01-01T00:00:00Z"}`,
+			},
+		},
+		{
+			name:   "already refunded",
+			number: "2377225624",
+			want: want{
+				code: http.StatusConflict,
+			},
+		},
+		{
+			name:   "unknown withdrawal",
+			number: "89920",
+			want: want{
+				code: http.StatusNotFound,
+			},
+		},
+		{
+			name:   "unexpected error",
+			number: "41004",
+			want: want{
+				code: http.StatusInternalServerError,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := fmt.Sprintf("/internal/withdrawals/%s/refund", tt.number)
+
+			request := httptest.NewRequest(http.MethodPost, target, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			result := w.Result()
+
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.want.code, result.StatusCode)
+
+			if len(tt.want.body) > 0 {
+				resultBody, err := io.ReadAll(result.Body)
+				assert.NoError(t, err)
+
+				assert.Equal(t, tt.want.body, string(resultBody))
+			}
+		})
+	}
+}
 
 func TestGetUserBalance(t *testing.T) {
 	balanceHandler := setupBalanceHandler()
@@ -288,3 +528,99 @@ func TestGetUserBalance(t *testing.T) {
 		})
 	}
 }
+
+func TestGetBalanceHistory(t *testing.T) {
+	balanceHandler := setupBalanceHandler()
+
+	r := gin.New()
+	r.Use(authMiddleware())
+
+	r.GET("/api/user/balance/history", balanceHandler.GetBalanceHistory)
+
+	type want struct {
+		code       int
+		body       string
+		nextCursor string
+	}
+	tests := []struct {
+		name    string
+		request string
+		want    want
+	}{
+		{
+			name:    "first page",
+			request: "/api/user/balance/history?user_id=111&limit=2",
+			want: want{
+				code: http.StatusOK,
+				body: `[{"type":"ACCRUAL","order":"12345678903","amount":500.5,"balance":500.5,"processed_at":"2024-01-01T00:00:00Z"},` +
+					`{"type":"WITHDRAWAL","order":"2377225624","amount":-200,"balance":300.5,"processed_at":"2024-01-02T00:00:00Z"}]`,
+				nextCursor: "2",
+			},
+		},
+		{
+			name:    "last page",
+			request: "/api/user/balance/history?user_id=111&limit=2&cursor=2",
+			want: want{
+				code: http.StatusOK,
+				body: `[{"type":"ADJUSTMENT","amount":0.25,"balance":300.75,"processed_at":"2024-01-03T00:00:00Z"}]`,
+			},
+		},
+		{
+			name:    "invalid limit",
+			request: "/api/user/balance/history?user_id=111&limit=0",
+			want: want{
+				code: http.StatusBadRequest,
+			},
+		},
+		{
+			name:    "invalid cursor",
+			request: "/api/user/balance/history?user_id=111&cursor=abc",
+			want: want{
+				code: http.StatusBadRequest,
+			},
+		},
+		{
+			name:    "empty history",
+			request: "/api/user/balance/history?user_id=333",
+			want: want{
+				code: http.StatusNoContent,
+			},
+		},
+		{
+			name:    "unexpected error",
+			request: "/api/user/balance/history?user_id=222",
+			want: want{
+				code: http.StatusInternalServerError,
+			},
+		},
+		{
+			name:    "unauthorized",
+			request: "/api/user/balance/history",
+			want: want{
+				code: http.StatusUnauthorized,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			result := w.Result()
+
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.want.code, result.StatusCode)
+			assert.Equal(t, tt.want.nextCursor, result.Header.Get(NextCursorHeader))
+
+			if len(tt.want.body) > 0 {
+				resultBody, err := io.ReadAll(result.Body)
+				assert.NoError(t, err)
+
+				assert.Equal(t, tt.want.body, string(resultBody))
+			}
+		})
+	}
+}
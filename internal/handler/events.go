@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/pubsub"
+	"github.com/gin-gonic/gin"
+)
+
+// Как часто отправляем комментарий, чтобы прокси не закрывали простаивающее соединение
+const eventsKeepAlive = 15 * time.Second
+
+type EventsHandler struct {
+	broker *pubsub.Broker
+}
+
+func NewEventsHandler(broker *pubsub.Broker) *EventsHandler {
+	return &EventsHandler{
+		broker: broker,
+	}
+}
+
+// Поток Server-Sent Events об изменениях заказов и начислениях пользователя.
+// Соединение закрывается при отключении клиента или остановке сервера
+func (h *EventsHandler) StreamOrderEvents(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	notifications, unsubscribe := h.broker.Subscribe(currentUser.ID)
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case notification, ok := <-notifications:
+			if !ok {
+				return false
+			}
+
+			c.SSEvent(string(notification.Type), notification)
+		case <-keepAlive.C:
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return false
+			}
+		}
+
+		return true
+	})
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/pubsub"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStreamOrderEvents(t *testing.T) {
+	broker := pubsub.NewBroker()
+	eventsHandler := NewEventsHandler(broker)
+
+	r := gin.New()
+
+	authMiddleware := func(c *gin.Context) {
+		c.Set("user", model.User{
+			ID:    111,
+			Login: "registered_user",
+		})
+	}
+
+	r.GET("/api/user/orders/events", authMiddleware, eventsHandler.StreamOrderEvents)
+	r.GET("/api/user/orders/events/unauth", eventsHandler.StreamOrderEvents)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	t.Run("unauthorized request", func(t *testing.T) {
+		result, err := http.Get(srv.URL + "/api/user/orders/events/unauth")
+		require.NoError(t, err)
+		defer result.Body.Close()
+
+		assert.Equal(t, http.StatusUnauthorized, result.StatusCode)
+	})
+
+	t.Run("order notification", func(t *testing.T) {
+		result, err := http.Get(srv.URL + "/api/user/orders/events")
+		require.NoError(t, err)
+		defer result.Body.Close()
+
+		assert.Equal(t, http.StatusOK, result.StatusCode)
+		assert.Equal(t, "text/event-stream", result.Header.Get("Content-Type"))
+
+		// Ждем, пока обработчик подпишется, и публикуем уведомления
+		go func() {
+			for i := 0; i < 50; i++ {
+				broker.Publish(model.Notification{UserID: 222, Type: model.NotificationBalance})
+				broker.Publish(model.Notification{
+					UserID: 111,
+					Type:   model.NotificationOrder,
+					Order:  &model.Order{Number: "56317", Status: model.OrderProcessed},
+				})
+				time.Sleep(10 * time.Millisecond)
+			}
+		}()
+
+		reader := bufio.NewReader(result.Body)
+
+		event, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "event:order\n", event)
+
+		data, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(data, "data:"))
+		assert.Contains(t, data, `"number":"56317"`)
+		assert.Contains(t, data, `"status":"PROCESSED"`)
+	})
+
+	t.Run("stream closes with broker", func(t *testing.T) {
+		result, err := http.Get(srv.URL + "/api/user/orders/events")
+		require.NoError(t, err)
+		defer result.Body.Close()
+
+		broker.Close()
+
+		_, err = bufio.NewReader(result.Body).ReadString('\n')
+		assert.Error(t, err)
+	})
+}
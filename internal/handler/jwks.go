@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/Sadere/gophermart/internal/auth"
+	"github.com/gin-gonic/gin"
+)
+
+type JWKSHandler struct {
+	keys *auth.KeySet
+}
+
+func NewJWKSHandler(keys *auth.KeySet) *JWKSHandler {
+	return &JWKSHandler{
+		keys: keys,
+	}
+}
+
+// Открытые ключи для проверки access токенов сторонними сервисами
+func (h *JWKSHandler) GetKeys(c *gin.Context) {
+	c.JSON(http.StatusOK, h.keys.JWKS())
+}
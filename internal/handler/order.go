@@ -1,15 +1,25 @@
 package handler
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"strings"
 
+	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/service"
 	"github.com/Sadere/gophermart/internal/utils"
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	ErrInvalidOrderStatus = errors.New("unknown order status")
+	ErrInvalidOrderBatch  = errors.New("order numbers must be a JSON array or newline-delimited text")
+)
+
 type OrderHandler struct {
 	orderService *service.OrderService
 }
@@ -47,7 +57,7 @@ func (o *OrderHandler) SaveOrder(c *gin.Context) {
 	}
 
 	var isLoaded bool
-	isLoaded, err = o.orderService.SaveOrderForUser(currentUser.ID, orderNumber)
+	isLoaded, err = o.orderService.SaveOrderForUser(c.Request.Context(), currentUser.ID, orderNumber)
 
 	if errors.Is(err, service.ErrOrderInvalidNumber) {
 		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
@@ -72,6 +82,78 @@ func (o *OrderHandler) SaveOrder(c *gin.Context) {
 
 }
 
+// Загрузка пачки номеров заказов: JSON массив или текст, по номеру на строку
+func (o *OrderHandler) SaveOrdersBatch(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	numbers, err := orderBatchNumbers(c.ContentType(), body)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	results, err := o.orderService.SaveOrdersForUser(c.Request.Context(), currentUser.ID, numbers)
+
+	if errors.Is(err, service.ErrOrderBatchEmpty) || errors.Is(err, service.ErrOrderBatchTooLarge) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "unexpected error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, results)
+}
+
+// Номера заказов из тела запроса. В JSON массиве номера могут быть строками или числами
+func orderBatchNumbers(contentType string, body []byte) ([]string, error) {
+	var numbers []string
+
+	if contentType != "application/json" {
+		for _, line := range strings.Split(string(body), "\n") {
+			if number := strings.TrimSpace(line); len(number) > 0 {
+				numbers = append(numbers, number)
+			}
+		}
+
+		return numbers, nil
+	}
+
+	var items []interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	if err := decoder.Decode(&items); err != nil {
+		return nil, ErrInvalidOrderBatch
+	}
+
+	for _, item := range items {
+		switch number := item.(type) {
+		case string:
+			numbers = append(numbers, strings.TrimSpace(number))
+		case json.Number:
+			numbers = append(numbers, number.String())
+		default:
+			return nil, ErrInvalidOrderBatch
+		}
+	}
+
+	return numbers, nil
+}
+
 func (o *OrderHandler) ListOrders(c *gin.Context) {
 	currentUser, err := getCurrentUser(c)
 	if err != nil {
@@ -79,7 +161,31 @@ func (o *OrderHandler) ListOrders(c *gin.Context) {
 		return
 	}
 
-	orders, err := o.orderService.GetOrdersByUser(currentUser.ID)
+	page, err := pageParams(c, 0)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	from, to, err := dateRangeParams(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	statuses, err := orderStatusParams(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	orders, nextCursor, err := o.orderService.GetOrdersByUser(c.Request.Context(), model.OrderFilter{
+		UserID:   currentUser.ID,
+		Statuses: statuses,
+		From:     from,
+		To:       to,
+		Page:     page,
+	})
 	if errors.Is(err, service.ErrOrdersNotAdded) {
 		c.JSON(http.StatusNoContent, gin.H{"error": err.Error()})
 		return
@@ -90,5 +196,53 @@ func (o *OrderHandler) ListOrders(c *gin.Context) {
 		return
 	}
 
+	setNextCursor(c, nextCursor)
+
 	c.JSON(http.StatusOK, orders)
 }
+
+// Заказ пользователя вместе с историей опроса accrual
+func (o *OrderHandler) GetOrder(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	details, err := o.orderService.GetOrderForUser(c.Request.Context(), currentUser.ID, c.Param("number"))
+
+	if errors.Is(err, service.ErrOrderNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "unexpected error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, details)
+}
+
+// Статусы заказов из query через запятую: status=NEW,PROCESSING
+func orderStatusParams(c *gin.Context) ([]model.OrderStatus, error) {
+	rawStatuses := c.Query("status")
+	if len(rawStatuses) == 0 {
+		return nil, nil
+	}
+
+	var statuses []model.OrderStatus
+
+	for _, rawStatus := range strings.Split(rawStatuses, ",") {
+		status := model.OrderStatus(strings.ToUpper(strings.TrimSpace(rawStatus)))
+
+		switch status {
+		case model.OrderNew, model.OrderProcessing, model.OrderInvalid, model.OrderProcessed:
+			statuses = append(statuses, status)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrInvalidOrderStatus, rawStatus)
+		}
+	}
+
+	return statuses, nil
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/Sadere/gophermart/internal/model"
@@ -131,6 +132,112 @@ func TestSaveOrder(t *testing.T) {
 	}
 }
 
+func TestSaveOrdersBatch(t *testing.T) {
+	repo := &repository.TestOrderRepository{}
+	orderService := service.NewOrderService(repo)
+	orderHandler := NewOrderHandler(orderService)
+
+	r := gin.New()
+
+	authMiddleware := func(c *gin.Context) {
+		c.Set("user", model.User{
+			ID:    111,
+			Login: "registered_user",
+		})
+	}
+
+	r.POST("/api/user/orders/batch", authMiddleware, orderHandler.SaveOrdersBatch)
+
+	type want struct {
+		statusCode int
+		body       string
+	}
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        want
+	}{
+		{
+			name:        "json array",
+			contentType: "application/json",
+			body:        `["84913", 56317, "24844", "54362"]`,
+			want: want{
+				statusCode: http.StatusOK,
+				body: `[{"number":"84913","status":"accepted"},` +
+					`{"number":"56317","status":"already_uploaded"},` +
+					`{"number":"24844","status":"uploaded_by_another_user"},` +
+					`{"number":"54362","status":"invalid"}]`,
+			},
+		},
+		{
+			name:        "newline delimited text",
+			contentType: "text/plain",
+			body:        "84913\r\n\n test_order\n84913\n",
+			want: want{
+				statusCode: http.StatusOK,
+				body: `[{"number":"84913","status":"accepted"},` +
+					`{"number":"test_order","status":"invalid"},` +
+					`{"number":"84913","status":"already_uploaded"}]`,
+			},
+		},
+		{
+			name:        "malformed json",
+			contentType: "application/json",
+			body:        `["84913", {"number":"56317"}]`,
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name:        "empty batch",
+			contentType: "application/json",
+			body:        `[]`,
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name:        "too many numbers",
+			contentType: "text/plain",
+			body:        strings.Repeat("84913\n", service.MaxOrderBatchSize+1),
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name:        "unexpected error",
+			contentType: "text/plain",
+			body:        "84913\n27078",
+			want: want{
+				statusCode: http.StatusInternalServerError,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/user/orders/batch", bytes.NewBufferString(tt.body))
+			request.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			result := w.Result()
+
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+
+			if len(tt.want.body) > 0 {
+				resultBody, err := io.ReadAll(result.Body)
+				assert.NoError(t, err)
+
+				assert.JSONEq(t, tt.want.body, string(resultBody))
+			}
+		})
+	}
+}
+
 func TestListOrders(t *testing.T) {
 	repo := &repository.TestOrderRepository{}
 	orderService := service.NewOrderService(repo)
@@ -156,6 +263,7 @@ func TestListOrders(t *testing.T) {
 	type want struct {
 		statusCode int
 		body       string
+		nextCursor string
 	}
 	tests := []struct {
 		name    string
@@ -188,6 +296,40 @@ func TestListOrders(t *testing.T) {
 				statusCode: http.StatusInternalServerError,
 			},
 		},
+		{
+			name:    "paginated list orders",
+			request: "/api/user/orders?user_id=666&limit=1&status=processed,NEW&sort=desc",
+			method:  http.MethodGet,
+			want: want{
+				statusCode: http.StatusOK,
+				body:       `[{"uploaded_at":"0001-01-01T00:00:00Z","number":"346436439","status":"PROCESSED"}]`,
+				nextCursor: "3",
+			},
+		},
+		{
+			name:    "invalid status filter",
+			request: "/api/user/orders?user_id=111&status=UNKNOWN",
+			method:  http.MethodGet,
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name:    "invalid date filter",
+			request: "/api/user/orders?user_id=111&from=yesterday",
+			method:  http.MethodGet,
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
+		{
+			name:    "invalid sort",
+			request: "/api/user/orders?user_id=111&sort=random",
+			method:  http.MethodGet,
+			want: want{
+				statusCode: http.StatusBadRequest,
+			},
+		},
 		{
 			name:    "unauthorized request",
 			request: "/api/user/orders",
@@ -208,6 +350,87 @@ func TestListOrders(t *testing.T) {
 
 			defer result.Body.Close()
 
+			assert.Equal(t, tt.want.statusCode, result.StatusCode)
+			assert.Equal(t, tt.want.nextCursor, result.Header.Get(NextCursorHeader))
+
+			if len(tt.want.body) > 0 {
+				resultBody, err := io.ReadAll(result.Body)
+				assert.NoError(t, err)
+
+				assert.Equal(t, tt.want.body, string(resultBody))
+			}
+		})
+	}
+}
+
+func TestGetOrder(t *testing.T) {
+	repo := &repository.TestOrderRepository{}
+	orderService := service.NewOrderService(repo)
+	orderHandler := NewOrderHandler(orderService)
+
+	r := gin.New()
+
+	authMiddleware := func(c *gin.Context) {
+		c.Set("user", model.User{
+			ID:    111,
+			Login: "registered_user",
+		})
+	}
+
+	r.GET("/api/user/orders/:number", authMiddleware, orderHandler.GetOrder)
+
+	type want struct {
+		statusCode int
+		body       string
+	}
+	tests := []struct {
+		name    string
+		request string
+		want    want
+	}{
+		{
+			name:    "order with events",
+			request: "/api/user/orders/56317",
+			want: want{
+				statusCode: http.StatusOK,
+				body: `{"uploaded_at":"0001-01-01T00:00:00Z","number":"56317","status":"PROCESSING","events":[` +
+					`{"status":"NEW","created_at":"0001-01-01T00:00:00Z"},` +
+					`{"from_status":"NEW","status":"PROCESSING","accrual_result":"REGISTERED","created_at":"0001-01-01T00:00:00Z"}]}`,
+			},
+		},
+		{
+			name:    "order of another user",
+			request: "/api/user/orders/24844",
+			want: want{
+				statusCode: http.StatusNotFound,
+			},
+		},
+		{
+			name:    "unknown order",
+			request: "/api/user/orders/84913",
+			want: want{
+				statusCode: http.StatusNotFound,
+			},
+		},
+		{
+			name:    "unexpected error",
+			request: "/api/user/orders/43513",
+			want: want{
+				statusCode: http.StatusInternalServerError,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, tt.request, nil)
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			result := w.Result()
+
+			defer result.Body.Close()
+
 			assert.Equal(t, tt.want.statusCode, result.StatusCode)
 
 			if len(tt.want.body) > 0 {
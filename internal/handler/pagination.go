@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// Лимит по умолчанию для новых списков. Списки заказов и списаний
+	// без limit отдаются целиком, как до появления постраничного вывода
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+
+	// Заголовок с курсором следующей страницы
+	NextCursorHeader = "X-Next-Cursor"
+)
+
+var (
+	ErrInvalidLimit  = errors.New("limit must be a number between 1 and 500")
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("sort must be either asc or desc")
+	ErrInvalidDate   = errors.New("from and to must be dates in RFC3339 format")
+)
+
+// Параметры страницы из query: limit, cursor и sort.
+// Без limit используется defaultLimit, 0 - без ограничения
+func pageParams(c *gin.Context, defaultLimit int) (model.Page, error) {
+	page := model.Page{
+		Limit: defaultLimit,
+		Sort:  model.SortAsc,
+	}
+
+	if rawLimit := c.Query("limit"); len(rawLimit) > 0 {
+		limit, err := strconv.Atoi(rawLimit)
+		if err != nil || limit < 1 || limit > MaxPageLimit {
+			return page, ErrInvalidLimit
+		}
+
+		page.Limit = limit
+	}
+
+	if rawCursor := c.Query("cursor"); len(rawCursor) > 0 {
+		cursor, err := strconv.ParseUint(rawCursor, 10, 64)
+		if err != nil {
+			return page, ErrInvalidCursor
+		}
+
+		page.Cursor = cursor
+	}
+
+	if rawSort := c.Query("sort"); len(rawSort) > 0 {
+		sort := model.SortOrder(rawSort)
+		if sort != model.SortAsc && sort != model.SortDesc {
+			return page, ErrInvalidSort
+		}
+
+		page.Sort = sort
+	}
+
+	return page, nil
+}
+
+// Период из query: from (включительно) и to (не включительно)
+func dateRangeParams(c *gin.Context) (*time.Time, *time.Time, error) {
+	var from, to *time.Time
+
+	if rawFrom := c.Query("from"); len(rawFrom) > 0 {
+		parsed, err := time.Parse(time.RFC3339, rawFrom)
+		if err != nil {
+			return nil, nil, ErrInvalidDate
+		}
+
+		from = &parsed
+	}
+
+	if rawTo := c.Query("to"); len(rawTo) > 0 {
+		parsed, err := time.Parse(time.RFC3339, rawTo)
+		if err != nil {
+			return nil, nil, ErrInvalidDate
+		}
+
+		to = &parsed
+	}
+
+	return from, to, nil
+}
+
+// Отдаем курсор следующей страницы в заголовке, тело ответа остается списком
+func setNextCursor(c *gin.Context, cursor uint64) {
+	if cursor > 0 {
+		c.Header(NextCursorHeader, strconv.FormatUint(cursor, 10))
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPageParams(t *testing.T) {
+	tests := []struct {
+		name         string
+		query        string
+		defaultLimit int
+		want         model.Page
+		wantErr      error
+	}{
+		{
+			name:         "full list without limit",
+			query:        "",
+			defaultLimit: 0,
+			want:         model.Page{Sort: model.SortAsc},
+		},
+		{
+			name:         "default limit",
+			query:        "",
+			defaultLimit: DefaultPageLimit,
+			want:         model.Page{Limit: DefaultPageLimit, Sort: model.SortAsc},
+		},
+		{
+			name:         "requested page",
+			query:        "limit=10&cursor=5&sort=desc",
+			defaultLimit: 0,
+			want:         model.Page{Limit: 10, Cursor: 5, Sort: model.SortDesc},
+		},
+		{
+			name:         "limit too big",
+			query:        "limit=1000",
+			defaultLimit: 0,
+			wantErr:      ErrInvalidLimit,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/?"+tt.query, nil)
+
+			page, err := pageParams(c, tt.defaultLimit)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, page)
+		})
+	}
+}
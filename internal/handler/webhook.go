@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/service"
+	"github.com/gin-gonic/gin"
+)
+
+type CreateWebhookRequest struct {
+	URL    string                   `json:"url" binding:"required"`
+	Events []model.WebhookEventType `json:"events"`
+}
+
+type WebhookHandler struct {
+	webhookService *service.WebhookService
+}
+
+func NewWebhookHandler(webhookService *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{
+		webhookService: webhookService,
+	}
+}
+
+// Регистрация webhook, секрет для проверки подписи отдается только в этом ответе
+func (h *WebhookHandler) CreateWebhook(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	request := CreateWebhookRequest{}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
+			"error": fmt.Sprintf("failed to parse request: %v", err),
+		})
+		return
+	}
+
+	webhook, err := h.webhookService.CreateWebhook(c.Request.Context(), currentUser.ID, request.URL, request.Events)
+
+	if errors.Is(err, service.ErrWebhookInvalidURL) ||
+		errors.Is(err, service.ErrWebhookForbiddenURL) ||
+		errors.Is(err, service.ErrWebhookInvalidEvent) {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if errors.Is(err, service.ErrWebhookLimit) {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "unexpected error"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, webhook)
+}
+
+func (h *WebhookHandler) ListWebhooks(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhooks, err := h.webhookService.ListWebhooks(c.Request.Context(), currentUser.ID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "unexpected error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhooks)
+}
+
+func (h *WebhookHandler) DeleteWebhook(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	webhookID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": service.ErrWebhookNotFound.Error()})
+		return
+	}
+
+	err = h.webhookService.DeleteWebhook(c.Request.Context(), currentUser.ID, webhookID)
+
+	if errors.Is(err, service.ErrWebhookNotFound) {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "unexpected error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// События, которые не удалось доставить после всех попыток
+func (h *WebhookHandler) ListDeadDeliveries(c *gin.Context) {
+	currentUser, err := getCurrentUser(c)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := pageParams(c, DefaultPageLimit)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	deliveries, nextCursor, err := h.webhookService.ListDeadDeliveries(c.Request.Context(), currentUser.ID, page)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "unexpected error"})
+		return
+	}
+
+	setNextCursor(c, nextCursor)
+
+	c.JSON(http.StatusOK, deliveries)
+}
@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/Sadere/gophermart/internal/service"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhooks(t *testing.T) {
+	repo := repository.NewTestWebhookRepository()
+	repo.Deliveries = []model.WebhookDelivery{
+		{ID: 1, UserID: 111, EventType: model.WebhookOrderInvalid, Payload: []byte(`{}`), Status: model.WebhookDeliveryDead},
+		{ID: 2, UserID: 111, EventType: model.WebhookOrderProcessed, Payload: []byte(`{}`), Status: model.WebhookDeliveryDelivered},
+		{ID: 3, UserID: 111, EventType: model.WebhookBalanceWithdrawn, Payload: []byte(`{}`), Status: model.WebhookDeliveryDead},
+	}
+
+	webhookHandler := NewWebhookHandler(service.NewWebhookService(repo))
+
+	r := gin.New()
+
+	authMiddleware := func(c *gin.Context) {
+		uid := c.Query("user_id")
+
+		if len(uid) > 0 {
+			userID, _ := strconv.Atoi(uid)
+
+			c.Set("user", model.User{
+				ID:    uint64(userID),
+				Login: "registered_user",
+			})
+		}
+	}
+
+	r.POST("/api/user/webhooks", authMiddleware, webhookHandler.CreateWebhook)
+	r.GET("/api/user/webhooks", authMiddleware, webhookHandler.ListWebhooks)
+	r.DELETE("/api/user/webhooks/:id", authMiddleware, webhookHandler.DeleteWebhook)
+	r.GET("/api/user/webhooks/deliveries/dead", authMiddleware, webhookHandler.ListDeadDeliveries)
+
+	tests := []struct {
+		name       string
+		method     string
+		request    string
+		body       string
+		statusCode int
+		nextCursor string
+	}{
+		{
+			name:       "create webhook",
+			method:     http.MethodPost,
+			request:    "/api/user/webhooks?user_id=111",
+			body:       `{"url":"https://203.0.113.10/hooks","events":["order.processed"]}`,
+			statusCode: http.StatusCreated,
+		},
+		{
+			name:       "invalid url",
+			method:     http.MethodPost,
+			request:    "/api/user/webhooks?user_id=111",
+			body:       `{"url":"crm.example.com"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "internal url",
+			method:     http.MethodPost,
+			request:    "/api/user/webhooks?user_id=111",
+			body:       `{"url":"http://127.0.0.1:8080/hooks"}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown event",
+			method:     http.MethodPost,
+			request:    "/api/user/webhooks?user_id=111",
+			body:       `{"url":"https://203.0.113.10/hooks","events":["order.created"]}`,
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "create error",
+			method:     http.MethodPost,
+			request:    "/api/user/webhooks?user_id=222",
+			body:       `{"url":"https://203.0.113.10/hooks"}`,
+			statusCode: http.StatusInternalServerError,
+		},
+		{
+			name:       "list webhooks",
+			method:     http.MethodGet,
+			request:    "/api/user/webhooks?user_id=111",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "delete webhook of another user",
+			method:     http.MethodDelete,
+			request:    "/api/user/webhooks/1?user_id=333",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "delete webhook",
+			method:     http.MethodDelete,
+			request:    "/api/user/webhooks/1?user_id=111",
+			statusCode: http.StatusNoContent,
+		},
+		{
+			name:       "delete invalid id",
+			method:     http.MethodDelete,
+			request:    "/api/user/webhooks/abc?user_id=111",
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "dead deliveries",
+			method:     http.MethodGet,
+			request:    "/api/user/webhooks/deliveries/dead?user_id=111&limit=1",
+			statusCode: http.StatusOK,
+			nextCursor: "1",
+		},
+		{
+			name:       "dead deliveries error",
+			method:     http.MethodGet,
+			request:    "/api/user/webhooks/deliveries/dead?user_id=222",
+			statusCode: http.StatusInternalServerError,
+		},
+		{
+			name:       "unauthorized request",
+			method:     http.MethodGet,
+			request:    "/api/user/webhooks",
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(tt.method, tt.request, strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			result := w.Result()
+
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.statusCode, result.StatusCode)
+			assert.Equal(t, tt.nextCursor, result.Header.Get(NextCursorHeader))
+		})
+	}
+
+	t.Run("secret is returned only on create", func(t *testing.T) {
+		request := httptest.NewRequest(
+			http.MethodPost,
+			"/api/user/webhooks?user_id=444",
+			strings.NewReader(`{"url":"https://203.0.113.10/hooks"}`),
+		)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+
+		var created model.Webhook
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		assert.NotEmpty(t, created.Secret)
+
+		request = httptest.NewRequest(http.MethodGet, "/api/user/webhooks?user_id=444", nil)
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, request)
+
+		var listed []model.Webhook
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+		if assert.Len(t, listed, 1) {
+			assert.Empty(t, listed[0].Secret)
+			assert.Equal(t, model.WebhookEvents(model.WebhookEventTypes), listed[0].Events)
+		}
+	})
+}
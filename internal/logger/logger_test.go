@@ -0,0 +1,57 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+
+	log, err := New(&buf, "warn", "json")
+	require.NoError(t, err)
+
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: traceID,
+		SpanID:  spanID,
+	}))
+	ctx = WithRequestID(ctx, "abc123")
+
+	log.InfoContext(ctx, "skipped")
+	log.With("component", "poller").WarnContext(ctx, "order failed", slog.String("order", "12345678903"))
+
+	var record map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+
+	// Запись ниже уровня отброшена, в оставшуюся добавлен идентификатор запроса
+	assert.Equal(t, "order failed", record["msg"])
+	assert.Equal(t, "WARN", record["level"])
+	assert.Equal(t, "abc123", record["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", record["trace_id"])
+	assert.Equal(t, "poller", record["component"])
+	assert.Equal(t, "12345678903", record["order"])
+
+	_, err = New(&buf, "info", "xml")
+	assert.ErrorIs(t, err, ErrUnknownFormat)
+
+	_, err = New(&buf, "verbose", "json")
+	assert.Error(t, err)
+}
+
+func TestRequestID(t *testing.T) {
+	assert.Empty(t, RequestID(context.Background()))
+	assert.Equal(t, "abc123", RequestID(WithRequestID(context.Background(), "abc123")))
+}
@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "gophermart"
+
+var (
+	// Время обработки HTTP запросов по маршруту, методу и коду ответа
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "HTTP request latency by route, method and status code.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	// Длительность одного цикла опроса accrual
+	AccrualPollDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "poll_duration_seconds",
+		Help:      "Duration of one accrual poll cycle.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+	})
+
+	// Заказы, ожидающие расчета в accrual
+	PendingOrders = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "pending_orders",
+		Help:      "Orders waiting for accrual calculation.",
+	})
+
+	// Ответы accrual по коду, code="error" - запрос не дошел до accrual
+	AccrualResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "accrual",
+		Name:      "responses_total",
+		Help:      "Accrual responses by HTTP status code.",
+	}, []string{"code"})
+
+	// Начисления баллов за заказы
+	Deposits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "balance",
+		Name:      "deposits_total",
+		Help:      "Number of accruals credited to user balances.",
+	})
+
+	DepositedPoints = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "balance",
+		Name:      "deposited_points_total",
+		Help:      "Points credited to user balances.",
+	})
+
+	// Списания баллов в счет оплаты заказов
+	Withdrawals = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "balance",
+		Name:      "withdrawals_total",
+		Help:      "Number of withdrawals from user balances.",
+	})
+
+	WithdrawnPoints = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "balance",
+		Name:      "withdrawn_points_total",
+		Help:      "Points withdrawn from user balances.",
+	})
+)
+
+// Статистика пула соединений из sqlx.DB.Stats()
+func RegisterDB(db *sqlx.DB) error {
+	return prometheus.Register(collectors.NewDBStatsCollector(db.DB, namespace))
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
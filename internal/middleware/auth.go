@@ -1,7 +1,7 @@
 package middleware
 
 import (
-	"context"
+	"crypto/subtle"
 	"net/http"
 	"strings"
 	"time"
@@ -14,16 +14,18 @@ import (
 )
 
 type Middleware struct {
-	userRepo repository.UserRepository
+	userRepo  repository.UserRepository
+	tokenRepo repository.TokenRepository
 }
 
-func NewMiddleware(userRepo repository.UserRepository) *Middleware {
+func NewMiddleware(userRepo repository.UserRepository, tokenRepo repository.TokenRepository) *Middleware {
 	return &Middleware{
-		userRepo: userRepo,
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
 	}
 }
 
-func (m *Middleware) AuthCheck(secretKey []byte) gin.HandlerFunc {
+func (m *Middleware) AuthCheck(keys *auth.KeySet) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 
@@ -40,7 +42,7 @@ func (m *Middleware) AuthCheck(secretKey []byte) gin.HandlerFunc {
 
 		tokenString := authToken[1]
 
-		token, err := auth.VerifyToken(tokenString, secretKey)
+		token, err := auth.VerifyToken(tokenString, keys)
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			return
@@ -52,20 +54,67 @@ func (m *Middleware) AuthCheck(secretKey []byte) gin.HandlerFunc {
 			return
 		}
 
-		if float64(time.Now().Unix()) > claims["exp"].(float64) {
+		// Числовые claims после разбора JSON приходят как float64
+		exp, ok := claims["exp"].(float64)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		if float64(time.Now().Unix()) > exp {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
 			return
 		}
 
+		// Проверяем, что сессия токена не отозвана
+		sessionID, ok := claims["sid"].(string)
+		if !ok || len(sessionID) == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
+		revoked, err := m.tokenRepo.IsFamilyRevoked(c.Request.Context(), sessionID)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check session"})
+			return
+		}
+
+		if revoked {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token revoked"})
+			return
+		}
+
+		userID, ok := claims["user_id"].(float64)
+		if !ok || userID < 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+
 		var authUser model.User
 
-		userID := claims["user_id"].(float64)
-		authUser, err = m.userRepo.GetUserByID(context.Background(), uint64(userID))
+		authUser, err = m.userRepo.GetUserByID(c.Request.Context(), uint64(userID))
 		if err != nil {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			return
 		}
 
 		c.Set("user", authUser)
+		c.Set("session_id", sessionID)
+	}
+}
+
+// Проверка служебного токена для внутренних методов: Authorization: Bearer <token>
+func ServiceToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authToken := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(authToken) != 2 || authToken[0] != "Bearer" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
+			return
+		}
+
+		if len(token) == 0 || subtle.ConstantTimeCompare([]byte(authToken[1]), []byte(token)) != 1 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
 	}
 }
@@ -0,0 +1,194 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/auth"
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthCheck(t *testing.T) {
+	keys, err := auth.NewKeySet(auth.NewHMACKey([]byte("test_secret_key")))
+	assert.NoError(t, err)
+
+	tokenRepo := repository.NewTestTokenRepository()
+	m := NewMiddleware(&repository.TestUserRepository{}, tokenRepo)
+
+	activeSession := "active"
+	revokedSession := "revoked"
+
+	for _, sessionID := range []string{activeSession, revokedSession} {
+		err := tokenRepo.CreateFamily(
+			context.Background(),
+			model.TokenFamily{ID: sessionID, UserID: 111},
+			model.RefreshToken{FamilyID: sessionID, TokenHash: sessionID},
+		)
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tokenRepo.RevokeFamily(context.Background(), revokedSession))
+
+	r := gin.New()
+	r.GET("/example", m.AuthCheck(keys), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("session_id"))
+	})
+
+	newToken := func(sessionID string) string {
+		token, err := auth.CreateToken(111, sessionID, time.Now().Add(time.Minute), keys)
+		assert.NoError(t, err)
+		return token
+	}
+
+	// Токен с произвольными claims, подписанный текущим ключом
+	signClaims := func(claims jwt.MapClaims) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		token.Header["kid"] = keys.Current().ID
+
+		tokenString, err := token.SignedString([]byte("test_secret_key"))
+		assert.NoError(t, err)
+		return tokenString
+	}
+
+	tests := []struct {
+		name     string
+		header   string
+		wantCode int
+	}{
+		{
+			name:     "active session",
+			header:   "Bearer " + newToken(activeSession),
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "revoked session",
+			header:   "Bearer " + newToken(revokedSession),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown session",
+			header:   "Bearer " + newToken("unknown"),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "token without session",
+			header:   "Bearer " + newToken(""),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "token without exp",
+			header: "Bearer " + signClaims(jwt.MapClaims{
+				"user_id": 111,
+				"sid":     activeSession,
+			}),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "token without user",
+			header: "Bearer " + signClaims(jwt.MapClaims{
+				"sid": activeSession,
+				"exp": time.Now().Add(time.Minute).Unix(),
+			}),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "token with malformed user",
+			header: "Bearer " + signClaims(jwt.MapClaims{
+				"user_id": "111",
+				"sid":     activeSession,
+				"exp":     time.Now().Add(time.Minute).Unix(),
+			}),
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "missing header",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "invalid format",
+			header:   "Token abc",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/example", nil)
+			if len(tt.header) > 0 {
+				request.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+}
+
+func TestServiceToken(t *testing.T) {
+	r := gin.New()
+	r.POST("/internal", ServiceToken("service_token"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name     string
+		header   string
+		wantCode int
+	}{
+		{
+			name:     "valid token",
+			header:   "Bearer service_token",
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "wrong token",
+			header:   "Bearer other_token",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "no header",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "invalid format",
+			header:   "service_token",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/internal", nil)
+			if len(tt.header) > 0 {
+				request.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+		})
+	}
+
+	// Пустой токен не пропускает никого
+	r = gin.New()
+	r.POST("/internal", ServiceToken(""), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/internal", nil)
+	request.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,172 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotencyReplayedHeader = "Idempotency-Replayed"
+
+	maxIdempotencyKeyLength = 255
+
+	// Через сколько резервация ключа без ответа считается брошенной и может быть
+	// перехвачена повтором того же запроса. Должно быть больше времени выполнения запроса
+	IdempotencyReservationTTL = 5 * time.Minute
+)
+
+// Запоминаем тело ответа, чтобы сохранить его для повторов
+type bodyRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *bodyRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Выполняем запрос с заголовком Idempotency-Key не больше одного раза:
+// повтор с тем же ключом и тем же запросом получает сохраненный ответ,
+// повтор с тем же ключом и другим запросом отклоняется с кодом 422.
+// Должен стоять после AuthCheck, ключи хранятся отдельно для каждого пользователя
+func Idempotency(repo repository.IdempotencyRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if len(key) == 0 {
+			c.Next()
+			return
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+
+		value, _ := c.Get("user")
+		user, ok := value.(model.User)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		fingerprint := requestFingerprint(c, body)
+
+		now := time.Now()
+
+		// По токену ответ сохранит только этот запрос, даже если его резервацию перехватят
+		token := newRequestID()
+
+		record, reserved, err := repo.Reserve(c.Request.Context(), model.IdempotencyKey{
+			UserID:      user.ID,
+			Key:         key,
+			RequestHash: fingerprint,
+			CreatedAt:   now,
+			Token:       token,
+		}, now.Add(-IdempotencyReservationTTL))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			return
+		}
+
+		if !reserved {
+			replayResponse(c, record, fingerprint)
+			return
+		}
+
+		recorder := &bodyRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+
+		// Сохраняем ответ, даже если клиент уже отключился
+		ctx := context.WithoutCancel(c.Request.Context())
+
+		// Recovery стоит снаружи, поэтому при панике освобождаем ключ сами,
+		// иначе повторы получали бы 409 до истечения резервации
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if err := repo.Release(ctx, user.ID, key, token); err != nil {
+					slog.ErrorContext(ctx, "failed to release idempotency key", slog.Any("error", err))
+				}
+
+				panic(recovered)
+			}
+		}()
+
+		c.Next()
+		code := recorder.Status()
+
+		// Ошибку сервера не запоминаем, чтобы запрос можно было повторить
+		if code >= http.StatusInternalServerError {
+			err = repo.Release(ctx, user.ID, key, token)
+		} else {
+			err = repo.Complete(ctx, user.ID, key, token, code, recorder.body.Bytes())
+		}
+
+		switch {
+		case errors.Is(err, repository.ErrIdempotencyReservationLost):
+			slog.WarnContext(ctx, "idempotency key was taken over, response not saved", slog.String("key", key))
+		case err != nil:
+			slog.ErrorContext(ctx, "failed to save idempotent response", slog.Any("error", err))
+		}
+	}
+}
+
+func replayResponse(c *gin.Context, record model.IdempotencyKey, fingerprint string) {
+	if record.RequestHash != fingerprint {
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{
+			"error": "Idempotency-Key has already been used with a different request",
+		})
+		return
+	}
+
+	if !record.Completed() {
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{
+			"error": "request with this Idempotency-Key is still in progress",
+		})
+		return
+	}
+
+	c.Header(IdempotencyReplayedHeader, "true")
+
+	if len(record.ResponseBody) == 0 {
+		c.AbortWithStatus(*record.ResponseCode)
+		return
+	}
+
+	c.Abort()
+	c.Data(*record.ResponseCode, "application/json; charset=utf-8", record.ResponseBody)
+}
+
+// Отпечаток запроса: метод, путь и тело
+func requestFingerprint(c *gin.Context, body []byte) string {
+	hash := sha256.New()
+
+	hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+	hash.Write(body)
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
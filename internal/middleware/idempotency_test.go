@@ -0,0 +1,244 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotency(t *testing.T) {
+	repo := repository.NewTestIdempotencyRepository()
+
+	calls := 0
+
+	r := gin.New()
+	r.Use(gin.RecoveryWithWriter(io.Discard))
+	r.POST("/withdraw", func(c *gin.Context) {
+		c.Set("user", model.User{ID: 111})
+	}, Idempotency(repo), func(c *gin.Context) {
+		calls++
+
+		body, _ := c.GetRawData()
+		switch string(body) {
+		case "fail":
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed"})
+		case "panic":
+			panic("handler failed")
+		case "poor":
+			c.AbortWithStatusJSON(http.StatusPaymentRequired, gin.H{"error": "insufficient funds"})
+		default:
+			c.Status(http.StatusOK)
+		}
+	})
+
+	okFingerprint := requestFingerprint(&gin.Context{Request: httptest.NewRequest(http.MethodPost, "/withdraw", nil)}, []byte("ok"))
+
+	// Ключ, запрос по которому еще выполняется
+	_, _, err := repo.Reserve(context.Background(), model.IdempotencyKey{
+		UserID:      111,
+		Key:         "in-progress",
+		RequestHash: okFingerprint,
+		CreatedAt:   time.Now(),
+	}, time.Now().Add(-IdempotencyReservationTTL))
+	assert.NoError(t, err)
+
+	// Ключ, запрос по которому так и не получил ответа
+	_, _, err = repo.Reserve(context.Background(), model.IdempotencyKey{
+		UserID:      111,
+		Key:         "stale",
+		RequestHash: okFingerprint,
+		CreatedAt:   time.Now().Add(-2 * IdempotencyReservationTTL),
+	}, time.Now().Add(-IdempotencyReservationTTL))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name         string
+		key          string
+		body         string
+		wantCode     int
+		wantCalls    int
+		wantReplayed bool
+	}{
+		{
+			name:      "without key",
+			body:      "ok",
+			wantCode:  http.StatusOK,
+			wantCalls: 1,
+		},
+		{
+			name:      "without key repeated",
+			body:      "ok",
+			wantCode:  http.StatusOK,
+			wantCalls: 2,
+		},
+		{
+			name:      "first request",
+			key:       "first",
+			body:      "ok",
+			wantCode:  http.StatusOK,
+			wantCalls: 3,
+		},
+		{
+			name:         "replayed request",
+			key:          "first",
+			body:         "ok",
+			wantCode:     http.StatusOK,
+			wantCalls:    3,
+			wantReplayed: true,
+		},
+		{
+			name:      "mismatched reuse",
+			key:       "first",
+			body:      "other",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantCalls: 3,
+		},
+		{
+			name:      "client error stored",
+			key:       "poor",
+			body:      "poor",
+			wantCode:  http.StatusPaymentRequired,
+			wantCalls: 4,
+		},
+		{
+			name:         "client error replayed",
+			key:          "poor",
+			body:         "poor",
+			wantCode:     http.StatusPaymentRequired,
+			wantCalls:    4,
+			wantReplayed: true,
+		},
+		{
+			name:      "server error not stored",
+			key:       "fail",
+			body:      "fail",
+			wantCode:  http.StatusInternalServerError,
+			wantCalls: 5,
+		},
+		{
+			name:      "server error retried",
+			key:       "fail",
+			body:      "fail",
+			wantCode:  http.StatusInternalServerError,
+			wantCalls: 6,
+		},
+		{
+			name:      "request in progress",
+			key:       "in-progress",
+			body:      "ok",
+			wantCode:  http.StatusConflict,
+			wantCalls: 6,
+		},
+		{
+			name:      "repository error",
+			key:       "error",
+			body:      "ok",
+			wantCode:  http.StatusInternalServerError,
+			wantCalls: 6,
+		},
+		{
+			name:      "stale reservation taken over",
+			key:       "stale",
+			body:      "ok",
+			wantCode:  http.StatusOK,
+			wantCalls: 7,
+		},
+		{
+			name:      "in progress with other request",
+			key:       "in-progress",
+			body:      "other",
+			wantCode:  http.StatusUnprocessableEntity,
+			wantCalls: 7,
+		},
+		{
+			name:      "panic releases key",
+			key:       "panic",
+			body:      "panic",
+			wantCode:  http.StatusInternalServerError,
+			wantCalls: 8,
+		},
+		{
+			name:      "panic retried",
+			key:       "panic",
+			body:      "panic",
+			wantCode:  http.StatusInternalServerError,
+			wantCalls: 9,
+		},
+	}
+
+	var firstBody string
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/withdraw", bytes.NewBufferString(tt.body))
+			if len(tt.key) > 0 {
+				request.Header.Set(IdempotencyKeyHeader, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			r.ServeHTTP(w, request)
+
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Equal(t, tt.wantCalls, calls)
+
+			if tt.wantReplayed {
+				assert.Equal(t, "true", w.Header().Get(IdempotencyReplayedHeader))
+			} else {
+				assert.Empty(t, w.Header().Get(IdempotencyReplayedHeader))
+			}
+
+			// Повтор получает то же тело ответа
+			if tt.key == "poor" {
+				if len(firstBody) == 0 {
+					firstBody = w.Body.String()
+				}
+				assert.Equal(t, firstBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestIdempotencyTakenOver(t *testing.T) {
+	repo := repository.NewTestIdempotencyRepository()
+
+	r := gin.New()
+	r.POST("/withdraw", func(c *gin.Context) {
+		c.Set("user", model.User{ID: 111})
+	}, Idempotency(repo), func(c *gin.Context) {
+		// Пока запрос выполняется, его резервацию перехватывает повтор
+		_, reserved, err := repo.Reserve(c.Request.Context(), model.IdempotencyKey{
+			UserID:      111,
+			Key:         "slow",
+			RequestHash: requestFingerprint(c, []byte("ok")),
+			CreatedAt:   time.Now(),
+			Token:       "retry",
+		}, time.Now().Add(time.Hour))
+		assert.NoError(t, err)
+		assert.True(t, reserved)
+
+		c.Status(http.StatusOK)
+	})
+
+	request := httptest.NewRequest(http.MethodPost, "/withdraw", bytes.NewBufferString("ok"))
+	request.Header.Set(IdempotencyKeyHeader, "slow")
+	w := httptest.NewRecorder()
+
+	r.ServeHTTP(w, request)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Ответ брошенного запроса не затирает резервацию нового владельца
+	record, ok := repo.Get("slow")
+	assert.True(t, ok)
+	assert.Equal(t, "retry", record.Token)
+	assert.False(t, record.Completed())
+}
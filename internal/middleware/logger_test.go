@@ -0,0 +1,70 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Sadere/gophermart/internal/logger"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	var tests = []struct {
+		name     string
+		header   string
+		expectID string
+	}{
+		{
+			name:     "from header",
+			header:   "req-42",
+			expectID: "req-42",
+		},
+		{
+			name:   "generated",
+			header: "",
+		},
+		{
+			name:   "invalid header",
+			header: "bad id",
+		},
+		{
+			name:   "too long header",
+			header: strings.Repeat("a", maxRequestIDLength+1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID string
+
+			r := gin.New()
+			r.Use(RequestID())
+			r.GET("/", func(c *gin.Context) {
+				ctxID = logger.RequestID(c.Request.Context())
+				c.Status(http.StatusOK)
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if len(tt.header) > 0 {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+
+			r.ServeHTTP(w, req)
+
+			responseID := w.Header().Get(RequestIDHeader)
+
+			assert.NotEmpty(t, responseID)
+			assert.Equal(t, responseID, ctxID)
+
+			if len(tt.expectID) > 0 {
+				assert.Equal(t, tt.expectID, responseID)
+			} else {
+				assert.NotEqual(t, tt.header, responseID)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Sadere/gophermart/internal/metrics"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// Количество наблюдений гистограммы с заданными метками
+func requestCount(t *testing.T, route, method, status string) uint64 {
+	t.Helper()
+
+	observer, err := metrics.HTTPRequestDuration.GetMetricWithLabelValues(route, method, status)
+	require.NoError(t, err)
+
+	var metric dto.Metric
+	require.NoError(t, observer.(prometheus.Metric).Write(&metric))
+
+	return metric.GetHistogram().GetSampleCount()
+}
+
+func TestMetrics(t *testing.T) {
+	r := gin.New()
+	r.Use(Metrics())
+	r.GET("/api/user/orders/:number", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	orderBefore := requestCount(t, "/api/user/orders/:number", http.MethodGet, "200")
+	unmatchedBefore := requestCount(t, "unmatched", http.MethodGet, "404")
+
+	for _, path := range []string{"/api/user/orders/12345678903", "/api/user/orders/9278923470", "/unknown"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	// Запросы к разным заказам попадают в одну серию маршрута
+	assert.Equal(t, orderBefore+2, requestCount(t, "/api/user/orders/:number", http.MethodGet, "200"))
+	assert.Equal(t, unmatchedBefore+1, requestCount(t, "unmatched", http.MethodGet, "404"))
+}
+
+func TestMetricsPanic(t *testing.T) {
+	r := gin.New()
+	r.Use(Metrics(), gin.Recovery())
+	r.GET("/api/panic", func(c *gin.Context) {
+		panic("handler failed")
+	})
+
+	before := requestCount(t, "/api/panic", http.MethodGet, "500")
+
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/panic", nil))
+
+	// Recovery стоит внутри Metrics, поэтому запрос учтен с кодом 500
+	assert.Equal(t, before+1, requestCount(t, "/api/panic", http.MethodGet, "500"))
+}
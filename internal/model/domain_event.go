@@ -0,0 +1,41 @@
+package model
+
+import (
+	"encoding/json"
+
+	"github.com/Sadere/gophermart/internal/structs"
+)
+
+type DomainEventType string
+
+// Доменные события, которые публикуются из outbox
+const (
+	EventOrderStatusChanged DomainEventType = "order.status_changed" // — заказ перешел в другой статус;
+	EventBalanceChanged     DomainEventType = "balance.changed"      // — изменился баланс пользователя.
+)
+
+// Событие из outbox. ID уникален, но не задает порядок: порядок событий
+// пользователя задает Seq, он растет на единицу без пропусков
+type DomainEvent struct {
+	ID        uint64          `json:"id" db:"id"`
+	Type      DomainEventType `json:"type" db:"type"`
+	UserID    uint64          `json:"user_id" db:"user_id"`
+	Seq       uint64          `json:"seq" db:"seq"`
+	Payload   json.RawMessage `json:"payload" db:"payload"`
+	CreatedAt structs.RFCTime `json:"created_at" db:"created_at"`
+}
+
+// Данные события order.status_changed, FromStatus пустой у нового заказа
+type OrderStatusChanged struct {
+	Number     string         `json:"number"`
+	FromStatus *OrderStatus   `json:"from_status,omitempty"`
+	Status     OrderStatus    `json:"status"`
+	Accrual    *structs.Money `json:"accrual,omitempty"`
+}
+
+// Данные события balance.changed
+type BalanceChanged struct {
+	EntryType   LedgerEntryType `json:"entry_type"`
+	Amount      structs.Money   `json:"amount"`
+	OrderNumber *string         `json:"order_number,omitempty"`
+}
@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"  // — сначала старые записи;
+	SortDesc SortOrder = "desc" // — сначала новые записи.
+)
+
+// Параметры страницы списка. Cursor - ID последней записи предыдущей страницы
+type Page struct {
+	Cursor uint64
+	Limit  int
+	Sort   SortOrder
+}
+
+// Фильтр списка заказов пользователя
+type OrderFilter struct {
+	UserID   uint64
+	Statuses []OrderStatus
+	From     *time.Time // Загружены не раньше
+	To       *time.Time // Загружены раньше
+	Page
+}
+
+// Фильтр списка списаний пользователя
+type WithdrawalFilter struct {
+	UserID uint64
+	From   *time.Time // Списаны не раньше
+	To     *time.Time // Списаны раньше
+	Page
+}
@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+// Ключ идемпотентности с отпечатком запроса и сохраненным ответом
+type IdempotencyKey struct {
+	UserID       uint64    `db:"user_id"`
+	Key          string    `db:"key"`
+	RequestHash  string    `db:"request_hash"`
+	ResponseCode *int      `db:"response_code"`
+	ResponseBody []byte    `db:"response_body"`
+	CreatedAt    time.Time `db:"created_at"`
+	Token        string    `db:"token"` // Токен резервации, известен только ее владельцу
+}
+
+// Запрос с этим ключом уже выполнен и ответ сохранен
+func (k IdempotencyKey) Completed() bool {
+	return k.ResponseCode != nil
+}
@@ -0,0 +1,56 @@
+package model
+
+import "github.com/Sadere/gophermart/internal/structs"
+
+type LedgerEntryType string
+
+const (
+	LedgerAccrual    LedgerEntryType = "ACCRUAL"    // — начисление баллов за заказ;
+	LedgerWithdrawal LedgerEntryType = "WITHDRAWAL" // — списание баллов в счет оплаты заказа;
+	LedgerAdjustment LedgerEntryType = "ADJUSTMENT" // — ручная корректировка баланса;
+	LedgerRefund     LedgerEntryType = "REFUND"     // — возврат баллов по отмененному списанию.
+)
+
+// Счета, между которыми перемещаются баллы
+const (
+	LedgerAccountUser        = "user"        // Баланс пользователя
+	LedgerAccountAccrual     = "accrual"     // Источник начислений от accrual
+	LedgerAccountWithdrawals = "withdrawals" // Списанные в счет оплаты баллы
+	LedgerAccountAdjustments = "adjustments" // Корректировки
+)
+
+// Запись в журнале движения баллов. Каждая операция состоит из двух записей
+// с общим TransactionID: по счету пользователя и по встречному системному счету,
+// сумма записей одной операции всегда равна нулю
+type LedgerEntry struct {
+	ID            uint64          `json:"-" db:"id"`
+	TransactionID uint64          `json:"-" db:"transaction_id"`
+	Account       string          `json:"-" db:"account"`
+	UserID        uint64          `json:"-" db:"user_id"`
+	Type          LedgerEntryType `json:"type" db:"type"`
+	Amount        structs.Money   `json:"amount" db:"amount"`
+	OrderNumber   *string         `json:"order,omitempty" db:"order_number"`
+	CreatedAt     structs.RFCTime `json:"created_at" db:"created_at"`
+}
+
+// Встречный системный счет для типа операции
+func (t LedgerEntryType) CounterAccount() string {
+	switch t {
+	case LedgerAccrual:
+		return LedgerAccountAccrual
+	case LedgerWithdrawal, LedgerRefund:
+		return LedgerAccountWithdrawals
+	default:
+		return LedgerAccountAdjustments
+	}
+}
+
+// Запись истории баланса пользователя с балансом после операции
+type BalanceHistoryEntry struct {
+	ID          uint64          `json:"-" db:"id"`
+	Type        LedgerEntryType `json:"type" db:"type"`
+	OrderNumber *string         `json:"order,omitempty" db:"order_number"`
+	Amount      structs.Money   `json:"amount" db:"amount"`
+	Balance     structs.Money   `json:"balance" db:"balance"`
+	CreatedAt   structs.RFCTime `json:"processed_at" db:"created_at"`
+}
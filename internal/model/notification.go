@@ -0,0 +1,20 @@
+package model
+
+import "github.com/Sadere/gophermart/internal/structs"
+
+type NotificationType string
+
+// Типы уведомлений пользователя
+const (
+	NotificationOrder   NotificationType = "order"   // — изменился статус заказа;
+	NotificationBalance NotificationType = "balance" // — на баланс начислены баллы.
+)
+
+// Уведомление пользователю об изменениях, сделанных при опросе accrual
+type Notification struct {
+	Type      NotificationType `json:"type"`
+	UserID    uint64           `json:"-"`
+	Order     *Order           `json:"order,omitempty"`
+	Amount    *structs.Money   `json:"amount,omitempty"`
+	CreatedAt structs.RFCTime  `json:"created_at"`
+}
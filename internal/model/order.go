@@ -1,6 +1,10 @@
 package model
 
-import "github.com/Sadere/gophermart/internal/structs"
+import (
+	"time"
+
+	"github.com/Sadere/gophermart/internal/structs"
+)
 
 type OrderStatus string
 
@@ -17,11 +21,36 @@ type Order struct {
 	CreatedAt structs.RFCTime `json:"uploaded_at" db:"created_at"`
 	Number    string          `json:"number" db:"number"`
 	Status    OrderStatus     `json:"status" db:"status"`
-	Accrual   *float64        `json:"accrual,omitempty" db:"accrual"`
+	Accrual   *structs.Money  `json:"accrual,omitempty" db:"accrual"`
+
+	Attempts      uint       `json:"-" db:"attempts"`        // Количество попыток, когда accrual не знал о заказе
+	NextAttemptAt *time.Time `json:"-" db:"next_attempt_at"` // Время следующего опроса accrual
+	LockedUntil   *time.Time `json:"-" db:"locked_until"`    // До какого времени заказ захвачен одной из реплик
 }
 
 type AccOrder struct {
-	Number  string   `json:"number"`
-	Status  string   `json:"status"`
-	Accrual *float64 `json:"accrual,omitempty"`
+	Number  string         `json:"number"`
+	Status  string         `json:"status"`
+	Accrual *structs.Money `json:"accrual,omitempty"`
+}
+
+// Заказ, сохраненный при загрузке, и признак, что он добавлен этой загрузкой
+type StoredOrder struct {
+	Order
+	Inserted bool `db:"inserted"`
+}
+
+type OrderUploadStatus string
+
+const (
+	OrderUploadAccepted        OrderUploadStatus = "accepted"                 // — заказ принят в обработку;
+	OrderUploadAlreadyUploaded OrderUploadStatus = "already_uploaded"         // — заказ уже загружен этим пользователем;
+	OrderUploadOwnedByAnother  OrderUploadStatus = "uploaded_by_another_user" // — заказ загружен другим пользователем;
+	OrderUploadInvalid         OrderUploadStatus = "invalid"                  // — неверный номер заказа.
+)
+
+// Результат загрузки одного номера из пачки
+type OrderUploadResult struct {
+	Number string            `json:"number"`
+	Status OrderUploadStatus `json:"status"`
 }
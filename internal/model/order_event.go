@@ -0,0 +1,28 @@
+package model
+
+import "github.com/Sadere/gophermart/internal/structs"
+
+// Результаты опроса accrual помимо статусов самого accrual
+const (
+	AccrualResultNotRegistered = "NOT_REGISTERED" // — accrual еще не знает о заказе;
+	AccrualResultError         = "ERROR"          // — опрос не удался, подробности в Details.
+)
+
+// Событие в истории заказа: смена статуса или очередной опрос accrual.
+// Result - статус заказа в accrual или один из AccrualResult*, пустой, если accrual не опрашивался
+type OrderEvent struct {
+	ID         uint64          `json:"-" db:"id"`
+	OrderID    uint64          `json:"-" db:"order_id"`
+	FromStatus *OrderStatus    `json:"from_status,omitempty" db:"from_status"`
+	Status     OrderStatus     `json:"status" db:"status"`
+	Result     string          `json:"accrual_result,omitempty" db:"result"`
+	Details    string          `json:"details,omitempty" db:"details"`
+	Accrual    *structs.Money  `json:"accrual,omitempty" db:"accrual"`
+	CreatedAt  structs.RFCTime `json:"created_at" db:"created_at"`
+}
+
+// Заказ вместе с историей его обработки
+type OrderDetails struct {
+	Order
+	Events []OrderEvent `json:"events"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Семейство refresh токенов, выданных в рамках одного входа пользователя
+type TokenFamily struct {
+	ID        string     `db:"id"`
+	UserID    uint64     `db:"user_id"`
+	CreatedAt time.Time  `db:"created_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+}
+
+type RefreshToken struct {
+	ID        uint64     `db:"id"`
+	FamilyID  string     `db:"family_id"`
+	UserID    uint64     `db:"user_id"`
+	TokenHash string     `db:"token_hash"`
+	CreatedAt time.Time  `db:"created_at"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	RevokedAt *time.Time `db:"revoked_at"`
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"` // Время жизни access токена в секундах
+}
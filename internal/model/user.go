@@ -1,6 +1,10 @@
 package model
 
-import "time"
+import (
+	"time"
+
+	"github.com/Sadere/gophermart/internal/structs"
+)
 
 type User struct {
 	ID           uint64    `json:"id" db:"id"`
@@ -10,6 +14,6 @@ type User struct {
 }
 
 type UserBalance struct {
-	Balance   float64 `json:"current" db:"balance"`
-	Withdrawn float64 `json:"withdrawn" db:"withdrawn"`
+	Balance   structs.Money `json:"current" db:"balance"`
+	Withdrawn structs.Money `json:"withdrawn" db:"withdrawn"`
 }
@@ -0,0 +1,142 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/structs"
+)
+
+type WebhookEventType string
+
+// События, на которые можно подписать webhook
+const (
+	WebhookOrderProcessed   WebhookEventType = "order.processed"   // — за заказ начислены баллы;
+	WebhookOrderInvalid     WebhookEventType = "order.invalid"     // — заказ не будет обработан;
+	WebhookBalanceWithdrawn WebhookEventType = "balance.withdrawn" // — баллы списаны в счет оплаты заказа.
+)
+
+var WebhookEventTypes = []WebhookEventType{
+	WebhookOrderProcessed,
+	WebhookOrderInvalid,
+	WebhookBalanceWithdrawn,
+}
+
+// Типы событий webhook, в базе хранятся строкой через запятую
+type WebhookEvents []WebhookEventType
+
+func (e *WebhookEvents) Scan(src interface{}) error {
+	var value string
+
+	switch src := src.(type) {
+	case string:
+		value = src
+	case []byte:
+		value = string(src)
+	default:
+		return fmt.Errorf("unsupported webhook events type %T", src)
+	}
+
+	*e = nil
+	for _, event := range strings.Split(value, ",") {
+		if len(event) > 0 {
+			*e = append(*e, WebhookEventType(event))
+		}
+	}
+
+	return nil
+}
+
+func (e WebhookEvents) Value() (driver.Value, error) {
+	events := make([]string, 0, len(e))
+	for _, event := range e {
+		events = append(events, string(event))
+	}
+
+	return strings.Join(events, ","), nil
+}
+
+// Адрес, на который доставляются события пользователя. Секрет
+// для проверки подписи отдается только при регистрации
+type Webhook struct {
+	ID        uint64          `json:"id" db:"id"`
+	UserID    uint64          `json:"-" db:"user_id"`
+	URL       string          `json:"url" db:"url"`
+	Secret    string          `json:"secret,omitempty" db:"secret"`
+	Events    WebhookEvents   `json:"events" db:"events"`
+	CreatedAt structs.RFCTime `json:"created_at" db:"created_at"`
+}
+
+// Событие для внешних систем, сохраняется в outbox в одной транзакции с изменением
+type WebhookEvent struct {
+	Type      WebhookEventType `json:"event"`
+	CreatedAt structs.RFCTime  `json:"created_at"`
+	Data      interface{}      `json:"data"`
+}
+
+// Данные событий о заказе. В отличие от Order в ответах API, содержат
+// пользователя: получатель может обслуживать несколько аккаунтов
+type WebhookOrderData struct {
+	UserID     uint64          `json:"user_id"`
+	Number     string          `json:"number"`
+	Status     OrderStatus     `json:"status"`
+	Accrual    *structs.Money  `json:"accrual,omitempty"`
+	UploadedAt structs.RFCTime `json:"uploaded_at"`
+}
+
+func NewWebhookOrderData(order Order) WebhookOrderData {
+	return WebhookOrderData{
+		UserID:     order.UserID,
+		Number:     order.Number,
+		Status:     order.Status,
+		Accrual:    order.Accrual,
+		UploadedAt: order.CreatedAt,
+	}
+}
+
+// Данные события о списании, тоже с пользователем
+type WebhookWithdrawalData struct {
+	UserID      uint64           `json:"user_id"`
+	Number      string           `json:"order"`
+	Status      WithdrawalStatus `json:"status"`
+	Amount      structs.Money    `json:"sum"`
+	ProcessedAt structs.RFCTime  `json:"processed_at"`
+}
+
+func NewWebhookWithdrawalData(withdrawal Withdrawal) WebhookWithdrawalData {
+	return WebhookWithdrawalData{
+		UserID:      withdrawal.UserID,
+		Number:      withdrawal.Number,
+		Status:      withdrawal.Status,
+		Amount:      withdrawal.Amount,
+		ProcessedAt: withdrawal.CreatedAt,
+	}
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "PENDING"   // — ждет доставки или повтора;
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "DELIVERED" // — получатель ответил 2xx;
+	WebhookDeliveryDead      WebhookDeliveryStatus = "DEAD"      // — попытки исчерпаны, больше не доставляется.
+)
+
+// Доставка события на один webhook
+type WebhookDelivery struct {
+	ID            uint64                `json:"id" db:"id"`
+	WebhookID     uint64                `json:"webhook_id" db:"webhook_id"`
+	UserID        uint64                `json:"-" db:"user_id"`
+	URL           string                `json:"url" db:"url"`
+	Secret        string                `json:"-" db:"secret"`
+	EventType     WebhookEventType      `json:"event" db:"event_type"`
+	Payload       json.RawMessage       `json:"payload" db:"payload"`
+	Status        WebhookDeliveryStatus `json:"status" db:"status"`
+	Attempts      uint                  `json:"attempts" db:"attempts"`
+	NextAttemptAt time.Time             `json:"-" db:"next_attempt_at"`
+	LastError     string                `json:"last_error,omitempty" db:"last_error"`
+	CreatedAt     structs.RFCTime       `json:"created_at" db:"created_at"`
+	DeliveredAt   *time.Time            `json:"-" db:"delivered_at"`
+}
@@ -2,10 +2,20 @@ package model
 
 import "github.com/Sadere/gophermart/internal/structs"
 
+type WithdrawalStatus string
+
+const (
+	WithdrawalPending   WithdrawalStatus = "PENDING"   // — баллы зарезервированы, оплата заказа не подтверждена;
+	WithdrawalCompleted WithdrawalStatus = "COMPLETED" // — заказ оплачен баллами;
+	WithdrawalCancelled WithdrawalStatus = "CANCELLED" // — списание отменено до подтверждения, баллы возвращены;
+	WithdrawalRefunded  WithdrawalStatus = "REFUNDED"  // — оплата возвращена, баллы возвращены на баланс.
+)
+
 type Withdrawal struct {
-	ID        uint64          `json:"-" db:"id"`
-	UserID    uint64          `json:"-" db:"user_id"`
-	Number    string          `json:"order" db:"number"`
-	CreatedAt structs.RFCTime `json:"processed_at" db:"created_at"`
-	Amount    float64         `json:"sum" db:"amount"`
+	ID        uint64           `json:"-" db:"id"`
+	UserID    uint64           `json:"-" db:"user_id"`
+	Number    string           `json:"order" db:"number"`
+	Status    WithdrawalStatus `json:"status" db:"status"`
+	CreatedAt structs.RFCTime  `json:"processed_at" db:"created_at"`
+	Amount    structs.Money    `json:"sum" db:"amount"`
 }
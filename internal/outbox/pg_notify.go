@@ -0,0 +1,64 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+// Postgres ограничивает размер сообщения NOTIFY 8000 байтами
+const maxNotifyPayload = 7999
+
+// Публикуем события через NOTIFY, подписчики слушают канал командой LISTEN.
+// Событие, не помещающееся в сообщение, отправляется без payload,
+// полные данные подписчик читает из таблицы events по id
+type PgNotifyPublisher struct {
+	db      *sqlx.DB
+	channel string
+}
+
+func NewPgNotifyPublisher(db *sqlx.DB, channel string) *PgNotifyPublisher {
+	return &PgNotifyPublisher{
+		db:      db,
+		channel: channel,
+	}
+}
+
+func (p *PgNotifyPublisher) Publish(ctx context.Context, events []model.DomainEvent) error {
+	for _, event := range events {
+		message, err := notifyMessage(event)
+		if err != nil {
+			return err
+		}
+
+		if _, err := p.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", p.channel, message); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *PgNotifyPublisher) Close() error {
+	return nil
+}
+
+func notifyMessage(event model.DomainEvent) (string, error) {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return "", err
+	}
+
+	if len(message) > maxNotifyPayload {
+		event.Payload = nil
+
+		message, err = json.Marshal(event)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return string(message), nil
+}
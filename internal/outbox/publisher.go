@@ -0,0 +1,39 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrUnknownSink = errors.New("unknown events sink")
+
+// Приемник событий из outbox. События передаются пачками в порядке записи,
+// ошибка означает, что пачка будет передана повторно
+type Publisher interface {
+	Publish(ctx context.Context, events []model.DomainEvent) error
+	Close() error
+}
+
+// Приемник по строке из конфига:
+//
+//	stdout       — JSON строки в стандартный вывод;
+//	file:<путь>  — JSON строки в конец файла;
+//	postgres     — NOTIFY в канал channel.
+func NewPublisher(sink string, db *sqlx.DB, channel string) (Publisher, error) {
+	switch {
+	case sink == "stdout":
+		return NewWriterPublisher(os.Stdout), nil
+	case strings.HasPrefix(sink, "file:"):
+		return NewFilePublisher(strings.TrimPrefix(sink, "file:"))
+	case sink == "postgres":
+		return NewPgNotifyPublisher(db, channel), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSink, sink)
+	}
+}
@@ -0,0 +1,93 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEvents() []model.DomainEvent {
+	return []model.DomainEvent{
+		{ID: 1, Type: model.EventOrderStatusChanged, UserID: 111, Seq: 1, Payload: json.RawMessage(`{"number":"12345678903","status":"NEW"}`)},
+		{ID: 2, Type: model.EventBalanceChanged, UserID: 111, Seq: 2, Payload: json.RawMessage(`{"entry_type":"ACCRUAL","amount":10}`)},
+	}
+}
+
+func TestWriterPublisher(t *testing.T) {
+	var buf bytes.Buffer
+
+	publisher := NewWriterPublisher(&buf)
+	require.NoError(t, publisher.Publish(context.Background(), testEvents()))
+	require.NoError(t, publisher.Close())
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Len(t, lines, 2) {
+		assert.Equal(t,
+			`{"id":1,"type":"order.status_changed","user_id":111,"seq":1,"payload":{"number":"12345678903","status":"NEW"},"created_at":"0001-01-01T00:00:00Z"}`,
+			lines[0],
+		)
+	}
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	publisher, err := NewPublisher("file:"+path, nil, "")
+	require.NoError(t, err)
+
+	require.NoError(t, publisher.Publish(context.Background(), testEvents()[:1]))
+	require.NoError(t, publisher.Publish(context.Background(), testEvents()[1:]))
+	require.NoError(t, publisher.Close())
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	// События дописываются в порядке публикации
+	var ids []uint64
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event model.DomainEvent
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		ids = append(ids, event.ID)
+	}
+	assert.Equal(t, []uint64{1, 2}, ids)
+}
+
+func TestNewPublisher(t *testing.T) {
+	publisher, err := NewPublisher("stdout", nil, "")
+	require.NoError(t, err)
+	assert.IsType(t, &WriterPublisher{}, publisher)
+
+	publisher, err = NewPublisher("postgres", nil, "events")
+	require.NoError(t, err)
+	assert.IsType(t, &PgNotifyPublisher{}, publisher)
+
+	_, err = NewPublisher("kafka", nil, "")
+	assert.ErrorIs(t, err, ErrUnknownSink)
+}
+
+func TestNotifyMessage(t *testing.T) {
+	event := testEvents()[0]
+
+	message, err := notifyMessage(event)
+	require.NoError(t, err)
+	assert.Contains(t, message, `"payload":{"number":"12345678903"`)
+
+	// Слишком большое событие отправляется без payload
+	event.Payload = json.RawMessage(`"` + strings.Repeat("x", maxNotifyPayload) + `"`)
+
+	message, err = notifyMessage(event)
+	require.NoError(t, err)
+	assert.Contains(t, message, `"payload":null`)
+	assert.LessOrEqual(t, len(message), maxNotifyPayload)
+}
@@ -0,0 +1,71 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/Sadere/gophermart/internal/model"
+)
+
+// Пишем события JSON строками, по одной на событие
+type WriterPublisher struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterPublisher(w io.Writer) *WriterPublisher {
+	return &WriterPublisher{
+		w: w,
+	}
+}
+
+// Дописываем события в конец файла, файл создается при необходимости
+func NewFilePublisher(path string) (*WriterPublisher, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterPublisher(file), nil
+}
+
+// Пачка записывается одним вызовом Write, чтобы не оставлять половину пачки при ошибке
+func (p *WriterPublisher) Publish(ctx context.Context, events []model.DomainEvent) error {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	// Файл сбрасываем на диск до того, как события будут отмечены опубликованными
+	if file, ok := p.w.(*os.File); ok && file != os.Stdout {
+		return file.Sync()
+	}
+
+	return nil
+}
+
+func (p *WriterPublisher) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if file, ok := p.w.(*os.File); ok && file != os.Stdout {
+		return file.Close()
+	}
+
+	return nil
+}
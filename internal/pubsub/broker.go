@@ -0,0 +1,95 @@
+package pubsub
+
+import (
+	"sync"
+
+	"github.com/Sadere/gophermart/internal/model"
+)
+
+// Сколько уведомлений ждут отправки одному подписчику,
+// остальные отбрасываются, чтобы медленный клиент не тормозил опрос accrual
+const subscriberBuffer = 16
+
+// Брокер уведомлений внутри процесса: опрос accrual публикует изменения,
+// открытые SSE соединения пользователя их получают
+type Broker struct {
+	mu          sync.Mutex
+	closed      bool
+	subscribers map[uint64]map[chan model.Notification]struct{}
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		subscribers: make(map[uint64]map[chan model.Notification]struct{}),
+	}
+}
+
+// Подписываемся на уведомления пользователя. Канал закрывается после
+// вызова возвращенной функции отписки или закрытия брокера
+func (b *Broker) Subscribe(userID uint64) (<-chan model.Notification, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ch := make(chan model.Notification, subscriberBuffer)
+
+	if b.closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[chan model.Notification]struct{})
+	}
+	b.subscribers[userID][ch] = struct{}{}
+
+	var once sync.Once
+	unsubscribe := func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			if _, ok := b.subscribers[userID][ch]; !ok {
+				return
+			}
+
+			delete(b.subscribers[userID], ch)
+			if len(b.subscribers[userID]) == 0 {
+				delete(b.subscribers, userID)
+			}
+			close(ch)
+		})
+	}
+
+	return ch, unsubscribe
+}
+
+// Отправляем уведомление всем подписчикам пользователя без ожидания
+func (b *Broker) Publish(notification model.Notification) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[notification.UserID] {
+		select {
+		case ch <- notification:
+		default:
+		}
+	}
+}
+
+// Закрываем все подписки, после этого уведомления не доставляются
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+
+	for _, channels := range b.subscribers {
+		for ch := range channels {
+			close(ch)
+		}
+	}
+	b.subscribers = nil
+}
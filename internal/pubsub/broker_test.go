@@ -0,0 +1,69 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBroker(t *testing.T) {
+	broker := NewBroker()
+
+	first, unsubscribeFirst := broker.Subscribe(111)
+	second, unsubscribeSecond := broker.Subscribe(111)
+	other, unsubscribeOther := broker.Subscribe(222)
+	defer unsubscribeOther()
+
+	broker.Publish(model.Notification{Type: model.NotificationOrder, UserID: 111})
+
+	// Уведомление получают только подписчики пользователя
+	assert.Equal(t, model.NotificationOrder, (<-first).Type)
+	assert.Equal(t, model.NotificationOrder, (<-second).Type)
+	assert.Empty(t, other)
+
+	unsubscribeFirst()
+	unsubscribeFirst()
+
+	_, ok := <-first
+	assert.False(t, ok)
+
+	broker.Publish(model.Notification{Type: model.NotificationBalance, UserID: 111})
+	assert.Equal(t, model.NotificationBalance, (<-second).Type)
+
+	unsubscribeSecond()
+}
+
+func TestBrokerSlowSubscriber(t *testing.T) {
+	broker := NewBroker()
+
+	ch, unsubscribe := broker.Subscribe(111)
+	defer unsubscribe()
+
+	// Лишние уведомления отбрасываются, публикация не блокируется
+	for i := 0; i < subscriberBuffer*2; i++ {
+		broker.Publish(model.Notification{UserID: 111})
+	}
+
+	assert.Len(t, ch, subscriberBuffer)
+}
+
+func TestBrokerClose(t *testing.T) {
+	broker := NewBroker()
+
+	ch, unsubscribe := broker.Subscribe(111)
+
+	broker.Close()
+	broker.Close()
+
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	// После закрытия отписка и публикация ничего не делают
+	unsubscribe()
+	broker.Publish(model.Notification{UserID: 111})
+
+	late, _ := broker.Subscribe(111)
+	_, ok = <-late
+	assert.False(t, ok)
+}
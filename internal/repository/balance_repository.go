@@ -2,40 +2,62 @@ package repository
 
 import (
 	"context"
+	"database/sql"
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/Sadere/gophermart/internal/database"
 	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/structs"
 	"github.com/jmoiron/sqlx"
 )
 
-var ErrInsufficientFunds = errors.New("requested sum is greater than available accrual")
+var (
+	ErrInsufficientFunds     = errors.New("requested sum is greater than available accrual")
+	ErrWithdrawalExists      = errors.New("order has already been paid with points")
+	ErrWithdrawalNotFound    = errors.New("withdrawal not found")
+	ErrWithdrawalNotReturned = errors.New("withdrawal can't be cancelled in its current status")
+	ErrWithdrawalNotPending  = errors.New("withdrawal is not pending")
+)
 
 type BalanceRepository interface {
+	WithTx(tx *sqlx.Tx) BalanceRepository
 	Withdraw(ctx context.Context, withdraw model.Withdrawal) error
-	GetUserWithdrawals(ctx context.Context, userID uint64) ([]model.Withdrawal, error)
+	GetUserWithdrawals(ctx context.Context, filter model.WithdrawalFilter) ([]model.Withdrawal, error)
 	GetUserBalance(ctx context.Context, userID uint64) (*model.UserBalance, error)
-	Deposit(ctx context.Context, userID uint64, sum float64) error
+	GetBalanceHistory(ctx context.Context, userID uint64, page model.Page) ([]model.BalanceHistoryEntry, error)
+	Deposit(ctx context.Context, userID uint64, sum structs.Money) error
+	CompleteWithdrawal(ctx context.Context, userID uint64, number string) (model.Withdrawal, error)
+	CancelWithdrawal(ctx context.Context, userID uint64, number string) (model.Withdrawal, error)
+	RefundWithdrawal(ctx context.Context, number string) (model.Withdrawal, error)
+	CancelStaleWithdrawals(ctx context.Context, createdBefore time.Time, limit int) (int, error)
 }
 
 type PgBalanceRepository struct {
-	db *sqlx.DB
+	db database.Querier
 }
 
-func NewPgBalanceRepository(db *sqlx.DB) BalanceRepository {
+func NewPgBalanceRepository(db database.Querier) BalanceRepository {
 	return &PgBalanceRepository{
 		db: db,
 	}
 }
 
+// Репозиторий, выполняющий запросы в переданной транзакции
+func (r *PgBalanceRepository) WithTx(tx *sqlx.Tx) BalanceRepository {
+	return NewPgBalanceRepository(tx)
+}
+
+// Списываем баллы с баланса. Завершенное списание проводится сразу,
+// неподтвержденное держит баллы до CompleteWithdrawal или отмены
 func (r *PgBalanceRepository) Withdraw(ctx context.Context, withdraw model.Withdrawal) error {
-	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
-		// Блокируем баланс пользователя
-		var balance float64
-		userQuery := "SELECT balance FROM users WHERE id = $1 FOR UPDATE"
-		err := r.db.QueryRowContext(ctx, userQuery, withdraw.UserID).Scan(&balance)
+	withdraw.CreatedAt = structs.RFCTime{Time: time.Now()}
 
+	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		// Блокируем баланс пользователя до конца транзакции,
+		// параллельные списания того же пользователя ждут здесь
+		balance, err := lockUserBalance(ctx, tx, withdraw.UserID)
 		if err != nil {
 			return err
 		}
@@ -44,63 +66,53 @@ func (r *PgBalanceRepository) Withdraw(ctx context.Context, withdraw model.Withd
 			return ErrInsufficientFunds
 		}
 
-		// Снимаем баланс пользователя
-		updateBalanceQuery := "UPDATE users SET balance = balance - $1 WHERE id = $2"
-		_, err = r.db.ExecContext(ctx, updateBalanceQuery, withdraw.Amount, withdraw.UserID)
-
-		if err != nil {
-			return err
-		}
-
 		// Добавляем запись о выводе средств
-		insertWithdrawalQuery := `INSERT INTO withdrawals
-			(user_id, number, created_at, amount)
-				VALUES
-			($1, $2, $3, $4)`
-		_, err = r.db.ExecContext(
-			ctx,
-			insertWithdrawalQuery,
-			withdraw.UserID,
-			withdraw.Number,
-			time.Now(),
-			withdraw.Amount,
-		)
+		err = insertWithdrawal(ctx, tx, withdraw)
 		if err != nil {
 			return err
 		}
 
-		// Увеличиваем сумму выведенных средств пользователя
-		updateWithdrawnQuery := "UPDATE users SET withdrawn = withdrawn + $1 WHERE id = $2"
-		_, err = r.db.ExecContext(ctx, updateWithdrawnQuery, withdraw.Amount, withdraw.UserID)
-
-		if err != nil {
+		// Списываем баллы с баланса пользователя
+		err = postLedgerTransaction(ctx, tx, withdraw.UserID, model.LedgerWithdrawal, -withdraw.Amount, &withdraw.Number)
+		if err != nil || withdraw.Status != model.WithdrawalCompleted {
 			return err
 		}
 
-		return nil
+		return enqueueWebhookEvent(ctx, tx, withdraw.UserID, model.WebhookEvent{
+			Type:      model.WebhookBalanceWithdrawn,
+			CreatedAt: withdraw.CreatedAt,
+			Data:      model.NewWebhookWithdrawalData(withdraw),
+		})
 	})
 
-	return err
+	return mapConstraintError(err)
 }
 
-func (r *PgBalanceRepository) GetUserWithdrawals(ctx context.Context, userID uint64) ([]model.Withdrawal, error) {
+// Списания пользователя по фильтру, постранично в порядке списания
+func (r *PgBalanceRepository) GetUserWithdrawals(ctx context.Context, filter model.WithdrawalFilter) ([]model.Withdrawal, error) {
 	var withdrawals []model.Withdrawal
 
-	selectWithdrawalsQuery := `
+	var query strings.Builder
+	args := []interface{}{filter.UserID}
+
+	query.WriteString(`
 		SELECT
 			id,
 			user_id,
 			number,
+			status,
 			created_at,
 			amount
 		FROM withdrawals
-		WHERE user_id = $1
-	`
+		WHERE user_id = ?`)
+
+	args = applyPage(&query, args, filter.From, filter.To, filter.Page)
+
 	err := r.db.SelectContext(
 		ctx,
 		&withdrawals,
-		selectWithdrawalsQuery,
-		userID,
+		r.db.Rebind(query.String()),
+		args...,
 	)
 
 	if err != nil {
@@ -110,10 +122,23 @@ func (r *PgBalanceRepository) GetUserWithdrawals(ctx context.Context, userID uin
 	return withdrawals, nil
 }
 
+// Баланс и сумма списаний считаются по журналу операций
 func (r *PgBalanceRepository) GetUserBalance(ctx context.Context, userID uint64) (*model.UserBalance, error) {
 	var balance model.UserBalance
 
-	err := r.db.QueryRowxContext(ctx, "SELECT balance, withdrawn FROM users WHERE id = $1", userID).
+	balanceQuery := `SELECT
+			COALESCE(SUM(amount), 0)::bigint AS balance,
+			COALESCE(-SUM(amount) FILTER (WHERE type IN ($1, $2)), 0)::bigint AS withdrawn
+		FROM ledger_entries
+		WHERE user_id = $3 AND account = $4`
+	err := r.db.QueryRowxContext(
+		ctx,
+		balanceQuery,
+		model.LedgerWithdrawal,
+		model.LedgerRefund,
+		userID,
+		model.LedgerAccountUser,
+	).
 		StructScan(&balance)
 	if err != nil {
 		return nil, err
@@ -122,12 +147,242 @@ func (r *PgBalanceRepository) GetUserBalance(ctx context.Context, userID uint64)
 	return &balance, nil
 }
 
-func (r *PgBalanceRepository) Deposit(ctx context.Context, userID uint64, sum float64) error {
-	_, err := r.db.ExecContext(
+// История операций по счету пользователя постранично. Баланс после каждой
+// операции считается нарастающим итогом по всему журналу пользователя
+func (r *PgBalanceRepository) GetBalanceHistory(
+	ctx context.Context,
+	userID uint64,
+	page model.Page,
+) ([]model.BalanceHistoryEntry, error) {
+	var history []model.BalanceHistoryEntry
+
+	var query strings.Builder
+	args := []interface{}{userID, model.LedgerAccountUser}
+
+	query.WriteString(`SELECT id, type, order_number, amount, balance, created_at
+		FROM (
+			SELECT
+				id,
+				type,
+				order_number,
+				amount,
+				(SUM(amount) OVER (ORDER BY id))::bigint AS balance,
+				created_at
+			FROM ledger_entries
+			WHERE user_id = ? AND account = ?
+		) h
+		WHERE TRUE`)
+
+	args = applyPage(&query, args, nil, nil, page)
+
+	err := r.db.SelectContext(
 		ctx,
-		"UPDATE users SET balance = balance + $1 WHERE id = $2",
-		sum,
-		userID,
+		&history,
+		r.db.Rebind(query.String()),
+		args...,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// Ручное начисление баллов пользователю, проводится по журналу как корректировка
+func (r *PgBalanceRepository) Deposit(ctx context.Context, userID uint64, sum structs.Money) error {
+	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		return postLedgerTransaction(ctx, tx, userID, model.LedgerAdjustment, sum, nil)
+	})
+
+	return mapConstraintError(err)
+}
+
+// Подтверждаем неподтвержденное списание пользователя, зарезервированные баллы остаются списанными
+func (r *PgBalanceRepository) CompleteWithdrawal(ctx context.Context, userID uint64, number string) (model.Withdrawal, error) {
+	var withdrawal model.Withdrawal
+
+	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		selectQuery := `SELECT id, user_id, number, status, created_at, amount
+			FROM withdrawals
+			WHERE user_id = $1 AND number = $2
+			ORDER BY id DESC
+			LIMIT 1
+			FOR UPDATE`
+		err := tx.QueryRowxContext(ctx, selectQuery, userID, number).StructScan(&withdrawal)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWithdrawalNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if withdrawal.Status != model.WithdrawalPending {
+			return ErrWithdrawalNotPending
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			"UPDATE withdrawals SET status = $1, updated_at = $2 WHERE id = $3",
+			model.WithdrawalCompleted,
+			time.Now(),
+			withdrawal.ID,
+		)
+		if err != nil {
+			return err
+		}
+
+		withdrawal.Status = model.WithdrawalCompleted
+
+		return enqueueWebhookEvent(ctx, tx, userID, model.WebhookEvent{
+			Type:      model.WebhookBalanceWithdrawn,
+			CreatedAt: withdrawal.CreatedAt,
+			Data:      model.NewWebhookWithdrawalData(withdrawal),
+		})
+	})
+
+	return withdrawal, err
+}
+
+// Отменяем неподтвержденное списание пользователя и возвращаем баллы на баланс
+func (r *PgBalanceRepository) CancelWithdrawal(ctx context.Context, userID uint64, number string) (model.Withdrawal, error) {
+	selectQuery := `SELECT id, user_id, number, status, created_at, amount
+		FROM withdrawals
+		WHERE user_id = $1 AND number = $2
+		ORDER BY id DESC
+		LIMIT 1
+		FOR UPDATE`
+
+	return r.returnWithdrawal(ctx, model.WithdrawalPending, model.WithdrawalCancelled, selectQuery, userID, number)
+}
+
+// Возврат оплаты завершенного списания, доступен только из служебного API
+func (r *PgBalanceRepository) RefundWithdrawal(ctx context.Context, number string) (model.Withdrawal, error) {
+	selectQuery := `SELECT id, user_id, number, status, created_at, amount
+		FROM withdrawals
+		WHERE number = $1
+		ORDER BY id DESC
+		LIMIT 1
+		FOR UPDATE`
+
+	return r.returnWithdrawal(ctx, model.WithdrawalCompleted, model.WithdrawalRefunded, selectQuery, number)
+}
+
+// Переводим последнее списание по выборке из статуса from в статус to
+// и возвращаем баллы на баланс одной транзакцией
+func (r *PgBalanceRepository) returnWithdrawal(
+	ctx context.Context,
+	from model.WithdrawalStatus,
+	to model.WithdrawalStatus,
+	selectQuery string,
+	args ...interface{},
+) (model.Withdrawal, error) {
+	var withdrawal model.Withdrawal
+
+	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		err := tx.QueryRowxContext(ctx, selectQuery, args...).StructScan(&withdrawal)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrWithdrawalNotFound
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if withdrawal.Status != from {
+			return ErrWithdrawalNotReturned
+		}
+
+		_, err = tx.ExecContext(
+			ctx,
+			"UPDATE withdrawals SET status = $1, updated_at = $2 WHERE id = $3",
+			to,
+			time.Now(),
+			withdrawal.ID,
+		)
+		if err != nil {
+			return err
+		}
+
+		withdrawal.Status = to
+
+		return postLedgerTransaction(ctx, tx, withdrawal.UserID, model.LedgerRefund, withdrawal.Amount, &withdrawal.Number)
+	})
+
+	return withdrawal, err
+}
+
+// Отменяем неподтвержденные списания, созданные раньше createdBefore, и возвращаем
+// баллы на баланс, не больше limit за вызов. Списания, занятые другой транзакцией,
+// пропускаем. Возвращает количество отмененных списаний
+func (r *PgBalanceRepository) CancelStaleWithdrawals(ctx context.Context, createdBefore time.Time, limit int) (int, error) {
+	var withdrawals []model.Withdrawal
+
+	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		selectQuery := `SELECT id, user_id, number, status, created_at, amount
+			FROM withdrawals
+			WHERE status = $1 AND created_at < $2
+			ORDER BY id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED`
+		err := tx.SelectContext(ctx, &withdrawals, selectQuery, model.WithdrawalPending, createdBefore, limit)
+		if err != nil {
+			return err
+		}
+
+		for _, withdrawal := range withdrawals {
+			_, err = tx.ExecContext(
+				ctx,
+				"UPDATE withdrawals SET status = $1, updated_at = $2 WHERE id = $3",
+				model.WithdrawalCancelled,
+				time.Now(),
+				withdrawal.ID,
+			)
+			if err != nil {
+				return err
+			}
+
+			err = postLedgerTransaction(ctx, tx, withdrawal.UserID, model.LedgerRefund, withdrawal.Amount, &withdrawal.Number)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(withdrawals), nil
+}
+
+// Читаем кеш баланса пользователя с блокировкой строки до конца транзакции
+func lockUserBalance(ctx context.Context, q database.Querier, userID uint64) (structs.Money, error) {
+	var balance structs.Money
+
+	err := q.QueryRowxContext(ctx, "SELECT balance FROM users WHERE id = $1 FOR UPDATE", userID).Scan(&balance)
+	if errors.Is(err, sql.ErrNoRows) {
+		return balance, ErrUserNotFound
+	}
+
+	return balance, err
+}
+
+func insertWithdrawal(ctx context.Context, q database.Querier, withdraw model.Withdrawal) error {
+	insertWithdrawalQuery := `INSERT INTO withdrawals
+		(user_id, number, status, created_at, amount)
+			VALUES
+		($1, $2, $3, $4, $5)`
+	_, err := q.ExecContext(
+		ctx,
+		insertWithdrawalQuery,
+		withdraw.UserID,
+		withdraw.Number,
+		withdraw.Status,
+		withdraw.CreatedAt.Time,
+		withdraw.Amount,
 	)
 
 	return err
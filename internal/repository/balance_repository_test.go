@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/database"
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/structs"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Тесты с настоящей БД запускаются, только если задан TEST_DATABASE_URI
+func testDB(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URI")
+	if len(dsn) == 0 {
+		t.Skip("TEST_DATABASE_URI is not set")
+	}
+
+	require.NoError(t, database.MigrateUp(dsn))
+
+	db, err := database.NewConnection("pgx", dsn)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		db.Close()
+	})
+
+	return db
+}
+
+func TestPgBalanceRepositoryConcurrentWithdraw(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+
+	userID, err := NewPgUserRepository(db).Create(ctx, model.User{
+		Login:        fmt.Sprintf("withdraw_race_%d", suffix),
+		PasswordHash: "hash",
+		CreatedAt:    time.Now(),
+	})
+	require.NoError(t, err)
+
+	repo := NewPgBalanceRepository(db)
+	require.NoError(t, repo.Deposit(ctx, userID, structs.NewMoney(100)))
+
+	// 20 списаний по 10 баллов при балансе 100: пройти должна ровно половина
+	const withdrawals = 20
+	sum := structs.NewMoney(10)
+
+	var (
+		wg           sync.WaitGroup
+		mu           sync.Mutex
+		succeeded    int
+		insufficient int
+		otherErrs    []error
+	)
+
+	start := make(chan struct{})
+
+	for i := 0; i < withdrawals; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			<-start
+
+			err := repo.Withdraw(ctx, model.Withdrawal{
+				UserID: userID,
+				Number: fmt.Sprintf("%d%02d", suffix, i),
+				Status: model.WithdrawalCompleted,
+				Amount: sum,
+			})
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, ErrInsufficientFunds):
+				insufficient++
+			default:
+				otherErrs = append(otherErrs, err)
+			}
+		}(i)
+	}
+
+	close(start)
+	wg.Wait()
+
+	require.Empty(t, otherErrs)
+	assert.Equal(t, 10, succeeded)
+	assert.Equal(t, withdrawals-10, insufficient)
+
+	balance, err := repo.GetUserBalance(ctx, userID)
+	require.NoError(t, err)
+
+	assert.Equal(t, structs.Money(0), balance.Balance)
+	assert.Equal(t, structs.NewMoney(100), balance.Withdrawn)
+
+	// Кеш баланса совпадает с журналом и не уходит в минус
+	var cached structs.Money
+	require.NoError(t, db.GetContext(ctx, &cached, "SELECT balance FROM users WHERE id = $1", userID))
+
+	assert.Equal(t, balance.Balance, cached)
+	assert.GreaterOrEqual(t, cached, structs.Money(0))
+}
+
+func TestPgBalanceRepositoryWithdrawalLifecycle(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+
+	userID, err := NewPgUserRepository(db).Create(ctx, model.User{
+		Login:        fmt.Sprintf("withdraw_lifecycle_%d", suffix),
+		PasswordHash: "hash",
+		CreatedAt:    time.Now(),
+	})
+	require.NoError(t, err)
+
+	repo := NewPgBalanceRepository(db)
+	require.NoError(t, repo.Deposit(ctx, userID, structs.NewMoney(100)))
+
+	withdraw := func(number string) {
+		require.NoError(t, repo.Withdraw(ctx, model.Withdrawal{
+			UserID: userID,
+			Number: number,
+			Status: model.WithdrawalPending,
+			Amount: structs.NewMoney(40),
+		}))
+	}
+
+	pending := fmt.Sprintf("%d01", suffix)
+	completed := fmt.Sprintf("%d02", suffix)
+
+	withdraw(pending)
+	withdraw(completed)
+
+	withdrawal, err := repo.CompleteWithdrawal(ctx, userID, completed)
+	require.NoError(t, err)
+	assert.Equal(t, model.WithdrawalCompleted, withdrawal.Status)
+
+	// Подтвердить можно только неподтвержденное списание
+	_, err = repo.CompleteWithdrawal(ctx, userID, completed)
+	assert.ErrorIs(t, err, ErrWithdrawalNotPending)
+
+	// Пользователь не может отменить завершенное списание
+	_, err = repo.CancelWithdrawal(ctx, userID, completed)
+	assert.ErrorIs(t, err, ErrWithdrawalNotReturned)
+
+	withdrawal, err = repo.CancelWithdrawal(ctx, userID, pending)
+	require.NoError(t, err)
+	assert.Equal(t, model.WithdrawalCancelled, withdrawal.Status)
+
+	// Отмененное списание нельзя вернуть повторно
+	_, err = repo.RefundWithdrawal(ctx, pending)
+	assert.ErrorIs(t, err, ErrWithdrawalNotReturned)
+
+	withdrawal, err = repo.RefundWithdrawal(ctx, completed)
+	require.NoError(t, err)
+	assert.Equal(t, model.WithdrawalRefunded, withdrawal.Status)
+
+	_, err = repo.RefundWithdrawal(ctx, completed)
+	assert.ErrorIs(t, err, ErrWithdrawalNotReturned)
+
+	balance, err := repo.GetUserBalance(ctx, userID)
+	require.NoError(t, err)
+
+	assert.Equal(t, structs.NewMoney(100), balance.Balance)
+	assert.Equal(t, structs.Money(0), balance.Withdrawn)
+}
+
+func TestPgRepositoriesWithTx(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+
+	userRepo := NewPgUserRepository(db)
+	balanceRepo := NewPgBalanceRepository(db)
+
+	// Ошибка откатывает изменения всех репозиториев транзакции
+	rollback := errors.New("rollback")
+	err := database.WrapTx(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+		userID, err := userRepo.WithTx(tx).Create(ctx, model.User{
+			Login:        fmt.Sprintf("with_tx_rollback_%d", suffix),
+			PasswordHash: "hash",
+			CreatedAt:    time.Now(),
+		})
+		require.NoError(t, err)
+
+		require.NoError(t, balanceRepo.WithTx(tx).Deposit(ctx, userID, structs.NewMoney(100)))
+
+		return rollback
+	})
+	require.ErrorIs(t, err, rollback)
+
+	_, err = userRepo.GetUserByLogin(ctx, fmt.Sprintf("with_tx_rollback_%d", suffix))
+	assert.Error(t, err)
+
+	// Ошибка вложенного вызова откатывает только его изменения
+	var userID uint64
+	err = database.WrapTx(ctx, db, func(ctx context.Context, tx *sqlx.Tx) error {
+		userID, err = userRepo.WithTx(tx).Create(ctx, model.User{
+			Login:        fmt.Sprintf("with_tx_commit_%d", suffix),
+			PasswordHash: "hash",
+			CreatedAt:    time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+
+		txBalanceRepo := balanceRepo.WithTx(tx)
+		if err := txBalanceRepo.Deposit(ctx, userID, structs.NewMoney(100)); err != nil {
+			return err
+		}
+
+		err = txBalanceRepo.Withdraw(ctx, model.Withdrawal{
+			UserID: userID,
+			Number: fmt.Sprintf("%d", suffix),
+			Status: model.WithdrawalPending,
+			Amount: structs.NewMoney(500),
+		})
+		assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+		return nil
+	})
+	require.NoError(t, err)
+
+	balance, err := balanceRepo.GetUserBalance(ctx, userID)
+	require.NoError(t, err)
+
+	assert.Equal(t, structs.NewMoney(100), balance.Balance)
+}
+
+func TestPgBalanceRepositoryCancelStaleWithdrawals(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+
+	userID, err := NewPgUserRepository(db).Create(ctx, model.User{
+		Login:        fmt.Sprintf("withdraw_stale_%d", suffix),
+		PasswordHash: "hash",
+		CreatedAt:    time.Now(),
+	})
+	require.NoError(t, err)
+
+	repo := NewPgBalanceRepository(db)
+	require.NoError(t, repo.Deposit(ctx, userID, structs.NewMoney(100)))
+
+	number := fmt.Sprintf("%d", suffix)
+	require.NoError(t, repo.Withdraw(ctx, model.Withdrawal{
+		UserID: userID,
+		Number: number,
+		Status: model.WithdrawalPending,
+		Amount: structs.NewMoney(40),
+	}))
+
+	// Свежее списание не трогаем
+	_, err = repo.CancelStaleWithdrawals(ctx, time.Now().Add(-time.Hour), 100)
+	require.NoError(t, err)
+
+	withdrawals, err := repo.GetUserWithdrawals(ctx, model.WithdrawalFilter{UserID: userID, Page: model.Page{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, model.WithdrawalPending, withdrawals[0].Status)
+
+	cancelled, err := repo.CancelStaleWithdrawals(ctx, time.Now().Add(time.Minute), 100)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, cancelled, 1)
+
+	withdrawals, err = repo.GetUserWithdrawals(ctx, model.WithdrawalFilter{UserID: userID, Page: model.Page{Limit: 10}})
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, model.WithdrawalCancelled, withdrawals[0].Status)
+
+	balance, err := repo.GetUserBalance(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, structs.NewMoney(100), balance.Balance)
+}
@@ -0,0 +1,66 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+var (
+	ErrUserExists    = errors.New("user with this login already exists")
+	ErrUserNotFound  = errors.New("user not found")
+	ErrOrderExists   = errors.New("order with this number already exists")
+	ErrInvalidAmount = errors.New("amount must be positive")
+
+	ErrIdempotencyKeyContended    = errors.New("idempotency key is being reserved and released concurrently")
+	ErrIdempotencyReservationLost = errors.New("idempotency key reservation has been taken over")
+)
+
+// Коды ошибок postgres при нарушении ограничений
+const (
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+	pgCheckViolation      = "23514"
+)
+
+// Ограничения таблиц, нарушения которых переводятся в ошибки репозиториев
+const (
+	usersLoginKey          = "users_login_key"
+	usersBalanceCheck      = "users_balance_check"
+	ordersNumberKey        = "orders_number_key"
+	ordersUserFK           = "orders_user_id_fkey"
+	withdrawalNumberIndex  = "withdrawals_number_idx"
+	withdrawalsAmountCheck = "withdrawals_amount_check"
+	withdrawalsUserFK      = "withdrawals_user_id_fkey"
+)
+
+var constraintErrors = map[string]map[string]error{
+	pgUniqueViolation: {
+		usersLoginKey:         ErrUserExists,
+		ordersNumberKey:       ErrOrderExists,
+		withdrawalNumberIndex: ErrWithdrawalExists,
+	},
+	pgForeignKeyViolation: {
+		ordersUserFK:      ErrUserNotFound,
+		withdrawalsUserFK: ErrUserNotFound,
+	},
+	pgCheckViolation: {
+		usersBalanceCheck:      ErrInsufficientFunds,
+		withdrawalsAmountCheck: ErrInvalidAmount,
+	},
+}
+
+// Переводим нарушение ограничения БД в ошибку репозитория,
+// остальные ошибки возвращаем как есть
+func mapConstraintError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) {
+		return err
+	}
+
+	if mapped, ok := constraintErrors[pgErr.Code][pgErr.ConstraintName]; ok {
+		return mapped
+	}
+
+	return err
+}
@@ -0,0 +1,65 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMapConstraintError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{
+			name: "duplicate order number",
+			err:  &pgconn.PgError{Code: pgUniqueViolation, ConstraintName: ordersNumberKey},
+			want: ErrOrderExists,
+		},
+		{
+			name: "wrapped duplicate login",
+			err:  fmt.Errorf("insert: %w", &pgconn.PgError{Code: pgUniqueViolation, ConstraintName: usersLoginKey}),
+			want: ErrUserExists,
+		},
+		{
+			name: "negative balance",
+			err:  &pgconn.PgError{Code: pgCheckViolation, ConstraintName: usersBalanceCheck},
+			want: ErrInsufficientFunds,
+		},
+		{
+			name: "unknown user",
+			err:  &pgconn.PgError{Code: pgForeignKeyViolation, ConstraintName: withdrawalsUserFK},
+			want: ErrUserNotFound,
+		},
+		{
+			name: "non positive amount",
+			err:  &pgconn.PgError{Code: pgCheckViolation, ConstraintName: withdrawalsAmountCheck},
+			want: ErrInvalidAmount,
+		},
+		{
+			name: "unknown constraint",
+			err:  &pgconn.PgError{Code: pgUniqueViolation, ConstraintName: "other_key"},
+		},
+		{
+			name: "not a postgres error",
+			err:  sql.ErrNoRows,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mapConstraintError(tt.err)
+
+			if tt.want == nil {
+				assert.Equal(t, tt.err, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
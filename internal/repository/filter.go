@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+)
+
+// Добавляем к запросу условия по времени создания и курсору, сортировку и лимит.
+// Запрос строится с плейсхолдерами "?", перед выполнением его нужно пропустить через Rebind
+func applyPage(
+	query *strings.Builder,
+	args []interface{},
+	from, to *time.Time,
+	page model.Page,
+) []interface{} {
+	if from != nil {
+		query.WriteString(" AND created_at >= ?")
+		args = append(args, *from)
+	}
+
+	if to != nil {
+		query.WriteString(" AND created_at < ?")
+		args = append(args, *to)
+	}
+
+	desc := page.Sort == model.SortDesc
+
+	if page.Cursor > 0 {
+		if desc {
+			query.WriteString(" AND id < ?")
+		} else {
+			query.WriteString(" AND id > ?")
+		}
+		args = append(args, page.Cursor)
+	}
+
+	if desc {
+		query.WriteString(" ORDER BY id DESC")
+	} else {
+		query.WriteString(" ORDER BY id ASC")
+	}
+
+	if page.Limit > 0 {
+		query.WriteString(" LIMIT ?")
+		args = append(args, page.Limit)
+	}
+
+	return args
+}
@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/database"
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type IdempotencyRepository interface {
+	WithTx(tx *sqlx.Tx) IdempotencyRepository
+	Reserve(ctx context.Context, key model.IdempotencyKey, staleBefore time.Time) (model.IdempotencyKey, bool, error)
+	Complete(ctx context.Context, userID uint64, key, token string, code int, body []byte) error
+	Release(ctx context.Context, userID uint64, key, token string) error
+	PurgeExpired(ctx context.Context, createdBefore time.Time, limit int) (int, error)
+}
+
+// Сколько раз пробуем занять ключ, если его освобождают между вставкой и чтением
+const reserveAttempts = 3
+
+type PgIdempotencyRepository struct {
+	db database.Querier
+}
+
+func NewPgIdempotencyRepository(db database.Querier) IdempotencyRepository {
+	return &PgIdempotencyRepository{
+		db: db,
+	}
+}
+
+// Репозиторий, выполняющий запросы в переданной транзакции
+func (r *PgIdempotencyRepository) WithTx(tx *sqlx.Tx) IdempotencyRepository {
+	return NewPgIdempotencyRepository(tx)
+}
+
+// Занимаем ключ под выполнение запроса. Если ключ уже занят, возвращаем
+// сохраненную запись и false. Резервация без ответа, сделанная раньше staleBefore,
+// считается брошенной (сервер упал, не дождавшись ответа) - ее перехватывает
+// повтор того же запроса. Перехват меняет токен резервации, поэтому ответ
+// брошенного запроса, если он все же завершится, уже не сохранится
+func (r *PgIdempotencyRepository) Reserve(ctx context.Context, key model.IdempotencyKey, staleBefore time.Time) (model.IdempotencyKey, bool, error) {
+	insertQuery := `INSERT INTO idempotency_keys
+		(user_id, key, request_hash, created_at, token)
+			VALUES
+		($1, $2, $3, $4, $5)
+		ON CONFLICT (user_id, key) DO UPDATE SET created_at = EXCLUDED.created_at, token = EXCLUDED.token
+			WHERE idempotency_keys.response_code IS NULL
+				AND idempotency_keys.request_hash = EXCLUDED.request_hash
+				AND idempotency_keys.created_at < $6`
+
+	selectQuery := `SELECT user_id, key, request_hash, response_code, response_body, created_at
+		FROM idempotency_keys
+		WHERE user_id = $1 AND key = $2`
+
+	var existing model.IdempotencyKey
+
+	for attempt := 0; attempt < reserveAttempts; attempt++ {
+		result, err := r.db.ExecContext(ctx, insertQuery, key.UserID, key.Key, key.RequestHash, key.CreatedAt, key.Token, staleBefore)
+		if err != nil {
+			return key, false, err
+		}
+
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return key, false, err
+		}
+
+		if inserted > 0 {
+			return key, true, nil
+		}
+
+		err = r.db.QueryRowxContext(ctx, selectQuery, key.UserID, key.Key).StructScan(&existing)
+
+		// Ключ освободили между вставкой и чтением, пробуем занять заново
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+
+		return existing, false, err
+	}
+
+	return key, false, ErrIdempotencyKeyContended
+}
+
+// Сохраняем ответ на выполненный запрос, если резервация все еще наша
+func (r *PgIdempotencyRepository) Complete(ctx context.Context, userID uint64, key, token string, code int, body []byte) error {
+	result, err := r.db.ExecContext(
+		ctx,
+		`UPDATE idempotency_keys SET response_code = $1, response_body = $2
+			WHERE user_id = $3 AND key = $4 AND token = $5 AND response_code IS NULL`,
+		code,
+		body,
+		userID,
+		key,
+		token,
+	)
+	if err != nil {
+		return err
+	}
+
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if updated == 0 {
+		return ErrIdempotencyReservationLost
+	}
+
+	return nil
+}
+
+// Освобождаем ключ незавершенного запроса, чтобы клиент мог его повторить.
+// Резервацию, перехваченную другим запросом, не трогаем
+func (r *PgIdempotencyRepository) Release(ctx context.Context, userID uint64, key, token string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"DELETE FROM idempotency_keys WHERE user_id = $1 AND key = $2 AND token = $3 AND response_code IS NULL",
+		userID,
+		key,
+		token,
+	)
+
+	return err
+}
+
+// Удаляем ключи, созданные раньше createdBefore, не больше limit за вызов.
+// Возвращает количество удаленных ключей
+func (r *PgIdempotencyRepository) PurgeExpired(ctx context.Context, createdBefore time.Time, limit int) (int, error) {
+	result, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM idempotency_keys WHERE (user_id, key) IN (
+			SELECT user_id, key FROM idempotency_keys
+			WHERE created_at < $1
+			LIMIT $2
+		)`,
+		createdBefore,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+
+	return int(purged), err
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgIdempotencyRepositoryReserve(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	repo := NewPgIdempotencyRepository(db)
+
+	now := time.Now().Truncate(time.Microsecond)
+	key := model.IdempotencyKey{
+		UserID:      111,
+		Key:         fmt.Sprintf("reserve_%d", now.UnixNano()),
+		RequestHash: "hash",
+		CreatedAt:   now.Add(-time.Hour),
+		Token:       "first",
+	}
+
+	_, reserved, err := repo.Reserve(ctx, key, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	// Свежая резервация не перехватывается
+	key.CreatedAt = now
+	_, reserved, err = repo.Reserve(ctx, key, now.Add(-2*time.Hour))
+	require.NoError(t, err)
+	assert.False(t, reserved)
+
+	// Брошенную резервацию перехватывает только тот же запрос
+	other := key
+	other.RequestHash = "other"
+	_, reserved, err = repo.Reserve(ctx, other, now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.False(t, reserved)
+
+	key.Token = "second"
+	_, reserved, err = repo.Reserve(ctx, key, now.Add(-time.Minute))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	// Перехваченная резервация не сохраняет ответ и не освобождается прежним владельцем
+	assert.ErrorIs(t, repo.Complete(ctx, key.UserID, key.Key, "first", 200, nil), ErrIdempotencyReservationLost)
+	require.NoError(t, repo.Release(ctx, key.UserID, key.Key, "first"))
+
+	// Завершенный запрос не перехватывается никогда
+	require.NoError(t, repo.Complete(ctx, key.UserID, key.Key, "second", 200, nil))
+
+	record, reserved, err := repo.Reserve(ctx, key, now.Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, reserved)
+	assert.True(t, record.Completed())
+}
+
+func TestPgIdempotencyRepositoryPurgeExpired(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	repo := NewPgIdempotencyRepository(db)
+
+	now := time.Now().Truncate(time.Microsecond)
+
+	old := model.IdempotencyKey{
+		UserID:      111,
+		Key:         fmt.Sprintf("purge_old_%d", now.UnixNano()),
+		RequestHash: "hash",
+		CreatedAt:   now.Add(-48 * time.Hour),
+		Token:       "old",
+	}
+	fresh := old
+	fresh.Key = fmt.Sprintf("purge_fresh_%d", now.UnixNano())
+	fresh.CreatedAt = now
+	fresh.Token = "fresh"
+
+	for _, key := range []model.IdempotencyKey{old, fresh} {
+		_, reserved, err := repo.Reserve(ctx, key, now.Add(-time.Hour))
+		require.NoError(t, err)
+		require.True(t, reserved)
+	}
+
+	_, err := repo.PurgeExpired(ctx, now.Add(-24*time.Hour), 1000)
+	require.NoError(t, err)
+
+	// Старый ключ удален, его можно занять заново, свежий остался
+	_, reserved, err := repo.Reserve(ctx, old, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.True(t, reserved)
+
+	_, reserved, err = repo.Reserve(ctx, fresh, now.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.False(t, reserved)
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/database"
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/structs"
+)
+
+// Проводим операцию по журналу баллов: записываем сумму на счет пользователя
+// и встречную сумму на системный счет, после чего обновляем кеш текущего баланса
+// пользователя. Положительная сумма - начисление, отрицательная - списание.
+// Вызывается внутри транзакции, чтобы обе записи и кеш менялись вместе
+func postLedgerTransaction(
+	ctx context.Context,
+	q database.Querier,
+	userID uint64,
+	entryType model.LedgerEntryType,
+	amount structs.Money,
+	orderNumber *string,
+) error {
+	insertEntriesQuery := `WITH t AS (SELECT nextval('ledger_transaction_seq') AS id)
+		INSERT INTO ledger_entries
+			(transaction_id, account, user_id, type, amount, order_number, created_at)
+		SELECT t.id, $1::varchar, $2::integer, $3::ledger_entry_type, $4::bigint, $5::varchar, $6::timestamp FROM t
+		UNION ALL
+		SELECT t.id, $7::varchar, $2::integer, $3::ledger_entry_type, $8::bigint, $5::varchar, $6::timestamp FROM t`
+	_, err := q.ExecContext(
+		ctx,
+		insertEntriesQuery,
+		model.LedgerAccountUser,
+		userID,
+		entryType,
+		amount,
+		orderNumber,
+		time.Now(),
+		entryType.CounterAccount(),
+		-amount,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Обновляем кеш баланса пользователя
+	_, err = q.ExecContext(ctx, "UPDATE users SET balance = balance + $1 WHERE id = $2", amount, userID)
+	if err != nil {
+		return err
+	}
+
+	return insertDomainEvent(ctx, q, userID, model.EventBalanceChanged, model.BalanceChanged{
+		EntryType:   entryType,
+		Amount:      amount,
+		OrderNumber: orderNumber,
+	})
+}
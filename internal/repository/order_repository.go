@@ -2,46 +2,146 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"strings"
 	"time"
 
+	"github.com/Sadere/gophermart/internal/database"
 	"github.com/Sadere/gophermart/internal/model"
 	"github.com/jmoiron/sqlx"
 )
 
 type OrderRepository interface {
-	Create(ctx context.Context, order model.Order) (uint64, error)
+	WithTx(tx *sqlx.Tx) OrderRepository
+	Create(ctx context.Context, order model.Order) (model.Order, bool, error)
+	CreateBatch(ctx context.Context, orders []model.Order) ([]model.StoredOrder, error)
 	GetOrderByNumber(ctx context.Context, number string) (model.Order, error)
-	GetOrdersByUser(ctx context.Context, userID uint64) ([]model.Order, error)
-	GetPendingOrders(ctx context.Context) ([]model.Order, error)
-	UpdateOrder(ctx context.Context, order model.Order) error
+	GetOrdersByUser(ctx context.Context, filter model.OrderFilter) ([]model.Order, error)
+	ClaimPendingOrders(ctx context.Context, lockedUntil time.Time, limit int) ([]model.Order, error)
+	CountPendingOrders(ctx context.Context) (int, error)
+	RenewOrders(ctx context.Context, orderIDs []uint64, lockedUntil time.Time, renewedUntil time.Time) error
+	ReleaseOrders(ctx context.Context, orderIDs []uint64, lockedUntil time.Time) error
+	UpdateOrder(ctx context.Context, order model.Order, event model.OrderEvent) error
+	CompleteOrder(ctx context.Context, order model.Order, event model.OrderEvent) error
+	AddOrderEvent(ctx context.Context, event model.OrderEvent) error
+	GetOrderEvents(ctx context.Context, orderID uint64) ([]model.OrderEvent, error)
 }
 
+var ErrOrderAlreadyProcessed = errors.New("order is already processed")
+
+// Сколько раз повторяем вставку заказа, если конфликтующий заказ еще не виден в снимке запроса
+const insertOrderAttempts = 3
+
 type PgOrderRepository struct {
-	db *sqlx.DB
+	db database.Querier
 }
 
-func NewPgOrderRepository(db *sqlx.DB) OrderRepository {
+func NewPgOrderRepository(db database.Querier) OrderRepository {
 	return &PgOrderRepository{
 		db: db,
 	}
 }
 
-func (r *PgOrderRepository) Create(ctx context.Context, order model.Order) (uint64, error) {
-	var newOrderID uint64
+// Репозиторий, выполняющий запросы в переданной транзакции
+func (r *PgOrderRepository) WithTx(tx *sqlx.Tx) OrderRepository {
+	return NewPgOrderRepository(tx)
+}
 
-	result := r.db.QueryRowContext(ctx, "INSERT INTO orders (number, user_id, created_at) VALUES ($1, $2, $3) RETURNING id",
-		order.Number,
-		order.UserID,
-		time.Now(),
+// Добавляем заказ, если заказа с таким номером еще нет. Возвращает сохраненный
+// заказ (новый или загруженный ранее, в том числе другим пользователем)
+// и true, если заказ добавлен этим вызовом
+func (r *PgOrderRepository) Create(ctx context.Context, order model.Order) (model.Order, bool, error) {
+	var (
+		stored   model.Order
+		inserted bool
 	)
 
-	err := result.Scan(&newOrderID)
+	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		var err error
+
+		stored, inserted, err = insertOrder(ctx, tx, order)
+
+		return err
+	})
+
+	return stored, inserted, err
+}
+
+// Добавляем пачку заказов одной транзакцией, результаты идут в порядке orders.
+// Чтобы параллельные пачки с пересекающимися номерами не взаимоблокировались,
+// вызывающий код передает номера без повторов в отсортированном порядке
+func (r *PgOrderRepository) CreateBatch(ctx context.Context, orders []model.Order) ([]model.StoredOrder, error) {
+	stored := make([]model.StoredOrder, 0, len(orders))
+
+	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		for _, order := range orders {
+			storedOrder, inserted, err := insertOrder(ctx, tx, order)
+			if err != nil {
+				return err
+			}
+
+			stored = append(stored, model.StoredOrder{Order: storedOrder, Inserted: inserted})
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return stored, nil
+}
+
+func insertOrder(ctx context.Context, q database.Querier, order model.Order) (model.Order, bool, error) {
+	var stored model.StoredOrder
+
+	// Если номер уже занят, вставка ничего не делает и вторая часть запроса
+	// возвращает существующий заказ. Заказ, добавленный параллельной транзакцией
+	// после начала запроса, в его снимке не виден - тогда повторяем запрос
+	insertQuery := `WITH inserted AS (
+			INSERT INTO orders (number, user_id, created_at)
+				VALUES ($1, $2, $3)
+			ON CONFLICT (number) DO NOTHING
+			RETURNING *
+		)
+		SELECT *, TRUE AS inserted FROM inserted
+		UNION ALL
+		SELECT *, FALSE AS inserted FROM orders WHERE number = $1
+		LIMIT 1`
+
+	var err error
+
+	for attempt := 0; attempt < insertOrderAttempts; attempt++ {
+		err = q.QueryRowxContext(ctx, insertQuery, order.Number, order.UserID, time.Now()).StructScan(&stored)
+		if !errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+	}
 
 	if err != nil {
-		return 0, err
+		return order, false, mapConstraintError(err)
+	}
+
+	// Начинаем историю нового заказа
+	if stored.Inserted {
+		err = insertOrderEvent(ctx, q, model.OrderEvent{
+			OrderID:   stored.ID,
+			Status:    stored.Status,
+			CreatedAt: stored.CreatedAt,
+		})
+		if err != nil {
+			return order, false, err
+		}
+
+		err = insertOrderStatusChanged(ctx, q, stored.Order, nil)
+		if err != nil {
+			return order, false, err
+		}
 	}
 
-	return newOrderID, nil
+	return stored.Order, stored.Inserted, nil
 }
 
 func (r *PgOrderRepository) GetOrderByNumber(ctx context.Context, number string) (model.Order, error) {
@@ -52,11 +152,28 @@ func (r *PgOrderRepository) GetOrderByNumber(ctx context.Context, number string)
 	return order, err
 }
 
-func (r *PgOrderRepository) GetOrdersByUser(ctx context.Context, userID uint64) ([]model.Order, error) {
+// Заказы пользователя по фильтру, постранично в порядке загрузки
+func (r *PgOrderRepository) GetOrdersByUser(ctx context.Context, filter model.OrderFilter) ([]model.Order, error) {
 	var result []model.Order
 
-	sql := "SELECT * FROM orders WHERE user_id = $1 ORDER BY created_at ASC"
-	err := r.db.SelectContext(ctx, &result, sql, userID)
+	var query strings.Builder
+	args := []interface{}{filter.UserID}
+
+	query.WriteString("SELECT * FROM orders WHERE user_id = ?")
+
+	if len(filter.Statuses) > 0 {
+		query.WriteString(" AND status IN (?)")
+		args = append(args, filter.Statuses)
+	}
+
+	args = applyPage(&query, args, filter.From, filter.To, filter.Page)
+
+	sql, args, err := sqlx.In(query.String(), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = r.db.SelectContext(ctx, &result, r.db.Rebind(sql), args...)
 
 	if err != nil {
 		return nil, err
@@ -65,11 +182,48 @@ func (r *PgOrderRepository) GetOrdersByUser(ctx context.Context, userID uint64)
 	return result, nil
 }
 
-func (r *PgOrderRepository) GetPendingOrders(ctx context.Context) ([]model.Order, error) {
+// Сколько заказов ждут расчета в accrual
+func (r *PgOrderRepository) CountPendingOrders(ctx context.Context) (int, error) {
+	var count int
+
+	err := r.db.GetContext(
+		ctx,
+		&count,
+		"SELECT COUNT(*) FROM orders WHERE status IN ($1, $2)",
+		model.OrderNew,
+		model.OrderProcessing,
+	)
+
+	return count, err
+}
+
+// Захватываем пачку ожидающих опроса заказов до lockedUntil.
+// Заказы, захваченные другими репликами, пропускаются, поэтому каждый заказ
+// одновременно обрабатывается только одной репликой
+func (r *PgOrderRepository) ClaimPendingOrders(ctx context.Context, lockedUntil time.Time, limit int) ([]model.Order, error) {
 	var pendingOrders []model.Order
 
-	sql := "SELECT * FROM orders WHERE status IN ($1, $2)"
-	err := r.db.SelectContext(ctx, &pendingOrders, sql, model.OrderNew, model.OrderProcessing)
+	sql := `UPDATE orders SET locked_until = $1
+		WHERE id IN (
+			SELECT id FROM orders
+			WHERE status IN ($2, $3)
+				AND (next_attempt_at IS NULL OR next_attempt_at <= $4)
+				AND (locked_until IS NULL OR locked_until <= $4)
+			ORDER BY id
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`
+	err := r.db.SelectContext(
+		ctx,
+		&pendingOrders,
+		sql,
+		lockedUntil,
+		model.OrderNew,
+		model.OrderProcessing,
+		time.Now(),
+		limit,
+	)
 
 	if err != nil {
 		return nil, err
@@ -78,14 +232,224 @@ func (r *PgOrderRepository) GetPendingOrders(ctx context.Context) ([]model.Order
 	return pendingOrders, nil
 }
 
-func (r *PgOrderRepository) UpdateOrder(ctx context.Context, order model.Order) error {
-	_, err := r.db.ExecContext(
+// Продлеваем захват заказов до renewedUntil. Продлеваются только заказы, которые
+// все еще захвачены нами до lockedUntil: завершенные и перехваченные пропускаются
+func (r *PgOrderRepository) RenewOrders(ctx context.Context, orderIDs []uint64, lockedUntil time.Time, renewedUntil time.Time) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In(
+		"UPDATE orders SET locked_until = ? WHERE id IN (?) AND locked_until = ?",
+		renewedUntil,
+		orderIDs,
+		lockedUntil,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, r.db.Rebind(query), args...)
+
+	return err
+}
+
+// Снимаем захват с заказов, если он все еще принадлежит нам
+func (r *PgOrderRepository) ReleaseOrders(ctx context.Context, orderIDs []uint64, lockedUntil time.Time) error {
+	if len(orderIDs) == 0 {
+		return nil
+	}
+
+	query, args, err := sqlx.In(
+		"UPDATE orders SET locked_until = NULL WHERE id IN (?) AND locked_until = ?",
+		orderIDs,
+		lockedUntil,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.db.ExecContext(ctx, r.db.Rebind(query), args...)
+
+	return err
+}
+
+// Обновляем заказ и записываем событие в его историю.
+// Обработанный заказ не меняется, событие в этом случае не записывается
+func (r *PgOrderRepository) UpdateOrder(ctx context.Context, order model.Order, event model.OrderEvent) error {
+	return database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		err := tx.QueryRowContext(
+			ctx,
+			`UPDATE orders SET status = $1, accrual = $2, attempts = $3, next_attempt_at = $4
+				WHERE id = $5 AND status <> $6
+				RETURNING user_id`,
+			order.Status,
+			order.Accrual,
+			order.Attempts,
+			order.NextAttemptAt,
+			order.ID,
+			model.OrderProcessed,
+		).Scan(&order.UserID)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		event.OrderID = order.ID
+		if err := insertOrderEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		if event.FromStatus != nil {
+			if err := insertOrderStatusChanged(ctx, tx, order, event.FromStatus); err != nil {
+				return err
+			}
+		}
+
+		// Заказ только что признан невалидным
+		if order.Status == model.OrderInvalid && event.FromStatus != nil {
+			return enqueueWebhookEvent(ctx, tx, order.UserID, model.WebhookEvent{
+				Type:      model.WebhookOrderInvalid,
+				CreatedAt: event.CreatedAt,
+				Data:      model.NewWebhookOrderData(order),
+			})
+		}
+
+		return nil
+	})
+}
+
+// Записываем событие в историю заказа без изменения самого заказа
+func (r *PgOrderRepository) AddOrderEvent(ctx context.Context, event model.OrderEvent) error {
+	return insertOrderEvent(ctx, r.db, event)
+}
+
+// История заказа в порядке возникновения событий
+func (r *PgOrderRepository) GetOrderEvents(ctx context.Context, orderID uint64) ([]model.OrderEvent, error) {
+	var events []model.OrderEvent
+
+	err := r.db.SelectContext(
+		ctx,
+		&events,
+		`SELECT id, order_id, from_status, status, result, details, accrual, created_at
+			FROM order_events
+			WHERE order_id = $1
+			ORDER BY id`,
+		orderID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// Переводим заказ в статус PROCESSED и начисляем баллы пользователю в одной транзакции.
+// Уже обработанный заказ повторно не начисляется, в этом случае возвращается ErrOrderAlreadyProcessed
+func (r *PgOrderRepository) CompleteOrder(ctx context.Context, order model.Order, event model.OrderEvent) error {
+	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		// Обновляем заказ, только если он еще не был обработан
+		var userID uint64
+		updateOrderQuery := `UPDATE orders
+			SET status = $1, accrual = $2, attempts = 0, next_attempt_at = NULL, locked_until = NULL
+			WHERE id = $3 AND status <> $1
+			RETURNING user_id`
+		err := tx.QueryRowContext(ctx, updateOrderQuery, model.OrderProcessed, order.Accrual, order.ID).
+			Scan(&userID)
+
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrOrderAlreadyProcessed
+		}
+
+		if err != nil {
+			return err
+		}
+
+		event.OrderID = order.ID
+		if err := insertOrderEvent(ctx, tx, event); err != nil {
+			return err
+		}
+
+		order.UserID = userID
+		order.Status = model.OrderProcessed
+
+		if err := insertOrderStatusChanged(ctx, tx, order, event.FromStatus); err != nil {
+			return err
+		}
+
+		err = enqueueWebhookEvent(ctx, tx, userID, model.WebhookEvent{
+			Type:      model.WebhookOrderProcessed,
+			CreatedAt: event.CreatedAt,
+			Data:      model.NewWebhookOrderData(order),
+		})
+		if err != nil {
+			return err
+		}
+
+		if order.Accrual == nil || *order.Accrual <= 0 {
+			return nil
+		}
+
+		// Начисляем баллы пользователю
+		return postLedgerTransaction(ctx, tx, userID, model.LedgerAccrual, *order.Accrual, &order.Number)
+	})
+
+	return err
+}
+
+// Записываем событие в историю заказа. Повторный опрос без изменений не записывается:
+// событие без смены статуса пропускается, если последнее событие заказа
+// имеет тот же статус, результат и подробности, иначе история заказа,
+// который долго не регистрируется в accrual, росла бы с каждой попыткой
+func insertOrderEvent(ctx context.Context, q database.Querier, event model.OrderEvent) error {
+	if event.FromStatus == nil {
+		var last model.OrderEvent
+
+		err := q.GetContext(
+			ctx,
+			&last,
+			`SELECT status, result, details FROM order_events
+				WHERE order_id = $1
+				ORDER BY id DESC
+				LIMIT 1`,
+			event.OrderID,
+		)
+
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+
+		if err == nil && last.Status == event.Status && last.Result == event.Result && last.Details == event.Details {
+			return nil
+		}
+	}
+
+	_, err := q.ExecContext(
 		ctx,
-		"UPDATE orders SET status = $1, accrual = $2 WHERE id = $3",
-		order.Status,
-		order.Accrual,
-		order.ID,
+		`INSERT INTO order_events (order_id, from_status, status, result, details, accrual, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		event.OrderID,
+		event.FromStatus,
+		event.Status,
+		event.Result,
+		event.Details,
+		event.Accrual,
+		event.CreatedAt,
 	)
 
 	return err
-}
\ No newline at end of file
+}
+
+func insertOrderStatusChanged(ctx context.Context, q database.Querier, order model.Order, fromStatus *model.OrderStatus) error {
+	return insertDomainEvent(ctx, q, order.UserID, model.EventOrderStatusChanged, model.OrderStatusChanged{
+		Number:     order.Number,
+		FromStatus: fromStatus,
+		Status:     order.Status,
+		Accrual:    order.Accrual,
+	})
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgOrderRepositoryConcurrentCreate(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+	userRepo := NewPgUserRepository(db)
+
+	var userIDs []uint64
+	for i := 0; i < 2; i++ {
+		userID, err := userRepo.Create(ctx, model.User{
+			Login:        fmt.Sprintf("order_race_%d_%d", suffix, i),
+			PasswordHash: "hash",
+			CreatedAt:    time.Now(),
+		})
+		require.NoError(t, err)
+
+		userIDs = append(userIDs, userID)
+	}
+
+	repo := NewPgOrderRepository(db)
+	number := fmt.Sprint(suffix)
+
+	// Один и тот же номер загружают параллельно оба пользователя
+	const uploads = 20
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		inserted int
+		owners   = make(map[uint64]int)
+	)
+
+	start := make(chan struct{})
+
+	for i := 0; i < uploads; i++ {
+		wg.Add(1)
+
+		go func(userID uint64) {
+			defer wg.Done()
+
+			<-start
+
+			order, created, err := repo.Create(ctx, model.Order{UserID: userID, Number: number})
+			assert.NoError(t, err)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if created {
+				inserted++
+			}
+			owners[order.UserID]++
+		}(userIDs[i%2])
+	}
+
+	close(start)
+	wg.Wait()
+
+	assert.Equal(t, 1, inserted)
+
+	// Все загрузки видят одного и того же владельца
+	require.Len(t, owners, 1)
+	for _, count := range owners {
+		assert.Equal(t, uploads, count)
+	}
+}
+
+func TestPgOrderRepositoryEventsDeduplicated(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+
+	userID, err := NewPgUserRepository(db).Create(ctx, model.User{
+		Login:        fmt.Sprintf("order_events_%d", suffix),
+		PasswordHash: "hash",
+		CreatedAt:    time.Now(),
+	})
+	require.NoError(t, err)
+
+	repo := NewPgOrderRepository(db)
+
+	order, created, err := repo.Create(ctx, model.Order{UserID: userID, Number: fmt.Sprint(suffix), Status: model.OrderNew})
+	require.NoError(t, err)
+	require.True(t, created)
+
+	notRegistered := model.OrderEvent{Status: model.OrderNew, Result: model.AccrualResultNotRegistered}
+
+	// Повторные попытки без изменений дают одно событие
+	for i := 1; i <= 3; i++ {
+		order.Attempts = uint(i)
+		require.NoError(t, repo.UpdateOrder(ctx, order, notRegistered))
+	}
+
+	fromStatus := model.OrderNew
+	order.Status = model.OrderInvalid
+	require.NoError(t, repo.UpdateOrder(ctx, order, model.OrderEvent{
+		FromStatus: &fromStatus,
+		Status:     model.OrderInvalid,
+		Result:     model.AccrualResultNotRegistered,
+	}))
+
+	events, err := repo.GetOrderEvents(ctx, order.ID)
+	require.NoError(t, err)
+
+	// Загрузка, первый незарегистрированный опрос и смена статуса
+	if assert.Len(t, events, 3) {
+		assert.Equal(t, model.AccrualResultNotRegistered, events[1].Result)
+		assert.Equal(t, model.OrderInvalid, events[2].Status)
+	}
+}
+
+func TestPgOrderRepositoryLease(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	suffix := time.Now().UnixNano()
+
+	userID, err := NewPgUserRepository(db).Create(ctx, model.User{
+		Login:        fmt.Sprintf("order_lease_%d", suffix),
+		PasswordHash: "hash",
+		CreatedAt:    time.Now(),
+	})
+	require.NoError(t, err)
+
+	repo := NewPgOrderRepository(db)
+
+	order, _, err := repo.Create(ctx, model.Order{UserID: userID, Number: fmt.Sprint(suffix)})
+	require.NoError(t, err)
+
+	// Захватываем все ожидающие заказы, включая оставшиеся от других тестов
+	claim := func(lockedUntil time.Time) []uint64 {
+		orders, err := repo.ClaimPendingOrders(ctx, lockedUntil, 100000)
+		require.NoError(t, err)
+
+		var ids []uint64
+		for _, claimed := range orders {
+			ids = append(ids, claimed.ID)
+		}
+
+		return ids
+	}
+
+	firstUntil := time.Now().Add(200 * time.Millisecond).Truncate(time.Microsecond)
+	assert.Contains(t, claim(firstUntil), order.ID)
+
+	// Захваченный заказ другой реплике не достается
+	assert.NotContains(t, claim(time.Now().Add(time.Minute).Truncate(time.Microsecond)), order.ID)
+
+	// Продленный захват не истекает в исходный срок
+	renewedUntil := time.Now().Add(time.Minute).Truncate(time.Microsecond)
+	require.NoError(t, repo.RenewOrders(ctx, []uint64{order.ID}, firstUntil, renewedUntil))
+
+	time.Sleep(300 * time.Millisecond)
+	assert.NotContains(t, claim(time.Now().Add(time.Minute).Truncate(time.Microsecond)), order.ID)
+
+	// Освобождение по устаревшему сроку не снимает чужой захват
+	require.NoError(t, repo.ReleaseOrders(ctx, []uint64{order.ID}, firstUntil))
+	assert.NotContains(t, claim(time.Now().Add(time.Minute).Truncate(time.Microsecond)), order.ID)
+
+	require.NoError(t, repo.ReleaseOrders(ctx, []uint64{order.ID}, renewedUntil))
+
+	secondUntil := time.Now().Add(100 * time.Millisecond).Truncate(time.Microsecond)
+	assert.Contains(t, claim(secondUntil), order.ID)
+
+	// Истекший захват перехватывается
+	time.Sleep(200 * time.Millisecond)
+	assert.Contains(t, claim(time.Now().Add(time.Minute).Truncate(time.Microsecond)), order.ID)
+}
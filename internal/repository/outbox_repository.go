@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/database"
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+type OutboxRepository interface {
+	WithTx(tx *sqlx.Tx) OutboxRepository
+	PublishPending(ctx context.Context, limit int, publish func(ctx context.Context, events []model.DomainEvent) error) (int, error)
+	PurgePublished(ctx context.Context, publishedBefore time.Time, limit int) (int, error)
+}
+
+type PgOutboxRepository struct {
+	db database.Querier
+}
+
+func NewPgOutboxRepository(db database.Querier) OutboxRepository {
+	return &PgOutboxRepository{
+		db: db,
+	}
+}
+
+// Репозиторий, выполняющий запросы в переданной транзакции
+func (r *PgOutboxRepository) WithTx(tx *sqlx.Tx) OutboxRepository {
+	return NewPgOutboxRepository(tx)
+}
+
+// Публикуем неопубликованные события каждого пользователя в порядке seq.
+// Seq выдается под блокировкой строки пользователя, поэтому более поздний seq
+// не может закоммититься раньше предыдущего, и опубликованные события пользователя
+// не обгоняют еще не закоммиченные. События блокируются до конца транзакции,
+// поэтому реплики публикуют их по очереди, не нарушая порядок.
+// Если publish вернул ошибку, события остаются неопубликованными до следующего вызова
+func (r *PgOutboxRepository) PublishPending(
+	ctx context.Context,
+	limit int,
+	publish func(ctx context.Context, events []model.DomainEvent) error,
+) (int, error) {
+	var published int
+
+	err := database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		var events []model.DomainEvent
+
+		err := tx.SelectContext(
+			ctx,
+			&events,
+			`SELECT id, type, user_id, seq, payload, created_at FROM events
+				WHERE published_at IS NULL
+				ORDER BY user_id, seq
+				LIMIT $1
+				FOR UPDATE`,
+			limit,
+		)
+		if err != nil || len(events) == 0 {
+			return err
+		}
+
+		if err := publish(ctx, events); err != nil {
+			return err
+		}
+
+		eventIDs := make([]uint64, 0, len(events))
+		for _, event := range events {
+			eventIDs = append(eventIDs, event.ID)
+		}
+
+		query, args, err := sqlx.In("UPDATE events SET published_at = ? WHERE id IN (?)", time.Now(), eventIDs)
+		if err != nil {
+			return err
+		}
+
+		if _, err = tx.ExecContext(ctx, tx.Rebind(query), args...); err != nil {
+			return err
+		}
+
+		published = len(events)
+
+		return nil
+	})
+
+	return published, err
+}
+
+// Удаляем опубликованные раньше publishedBefore события, не больше limit за вызов.
+// Возвращает количество удаленных событий
+func (r *PgOutboxRepository) PurgePublished(ctx context.Context, publishedBefore time.Time, limit int) (int, error) {
+	result, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM events WHERE id IN (
+			SELECT id FROM events
+			WHERE published_at IS NOT NULL AND published_at < $1
+			LIMIT $2
+		)`,
+		publishedBefore,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+
+	return int(purged), err
+}
+
+// Записываем доменное событие в outbox, вызывается внутри транзакции изменения.
+// Seq события берется из счетчика пользователя, строка пользователя остается
+// заблокированной до конца транзакции
+func insertDomainEvent(ctx context.Context, q database.Querier, userID uint64, eventType model.DomainEventType, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(
+		ctx,
+		`WITH s AS (
+			UPDATE users SET events_seq = events_seq + 1 WHERE id = $2 RETURNING events_seq
+		)
+		INSERT INTO events (type, user_id, seq, payload, created_at)
+		SELECT $1::varchar, $2::integer, s.events_seq, $3::jsonb, $4::timestamp FROM s`,
+		eventType,
+		userID,
+		payload,
+		time.Now(),
+	)
+
+	return err
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgOutboxRepositoryPublishPending(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	userID, err := NewPgUserRepository(db).Create(ctx, model.User{
+		Login:        fmt.Sprintf("outbox_%d", time.Now().UnixNano()),
+		PasswordHash: "hash",
+		CreatedAt:    time.Now(),
+	})
+	require.NoError(t, err)
+
+	balanceRepo := NewPgBalanceRepository(db)
+	require.NoError(t, balanceRepo.Deposit(ctx, userID, structs.NewMoney(100)))
+	require.NoError(t, balanceRepo.Withdraw(ctx, model.Withdrawal{
+		UserID: userID,
+		Number: fmt.Sprintf("%d", time.Now().UnixNano()),
+		Status: model.WithdrawalCompleted,
+		Amount: structs.NewMoney(10),
+	}))
+
+	repo := NewPgOutboxRepository(db)
+
+	// Ошибка приемника оставляет события неопубликованными
+	_, err = repo.PublishPending(ctx, 100, func(ctx context.Context, events []model.DomainEvent) error {
+		return errors.New("sink is down")
+	})
+	assert.Error(t, err)
+
+	var userEvents []model.DomainEvent
+	for {
+		published, err := repo.PublishPending(ctx, 100, func(ctx context.Context, events []model.DomainEvent) error {
+			for _, event := range events {
+				if event.UserID == userID {
+					userEvents = append(userEvents, event)
+				}
+			}
+			return nil
+		})
+		require.NoError(t, err)
+
+		if published == 0 {
+			break
+		}
+	}
+
+	// Изменения баланса опубликованы в порядке записи
+	require.Len(t, userEvents, 2)
+
+	var entryTypes []model.LedgerEntryType
+	for _, event := range userEvents {
+		assert.Equal(t, model.EventBalanceChanged, event.Type)
+
+		var changed model.BalanceChanged
+		require.NoError(t, json.Unmarshal(event.Payload, &changed))
+		entryTypes = append(entryTypes, changed.EntryType)
+	}
+	assert.Equal(t, []model.LedgerEntryType{model.LedgerAdjustment, model.LedgerWithdrawal}, entryTypes)
+	assert.Equal(t, uint64(1), userEvents[0].Seq)
+	assert.Equal(t, uint64(2), userEvents[1].Seq)
+
+	// Опубликованные события удаляются по сроку хранения
+	for {
+		purged, err := repo.PurgePublished(ctx, time.Now().Add(time.Minute), 1000)
+		require.NoError(t, err)
+
+		if purged == 0 {
+			break
+		}
+	}
+
+	var left int
+	require.NoError(t, db.GetContext(ctx, &left, "SELECT count(*) FROM events WHERE user_id = $1", userID))
+	assert.Zero(t, left)
+}
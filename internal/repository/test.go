@@ -4,10 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/structs"
+	"github.com/jmoiron/sqlx"
 )
 
 // Test user repo
@@ -16,11 +19,19 @@ type TestUserRepository struct {
 	RegisteredUserPwHash string
 }
 
+func (tu *TestUserRepository) WithTx(tx *sqlx.Tx) UserRepository {
+	return tu
+}
+
 func (tu *TestUserRepository) Create(ctx context.Context, user model.User) (uint64, error) {
 	if user.Login == "invalid" {
 		return 0, errors.New("test error")
 	}
 
+	if user.Login == "concurrent_user" {
+		return 0, ErrUserExists
+	}
+
 	return 1000, nil
 }
 
@@ -57,18 +68,51 @@ func (tu *TestUserRepository) GetUserByLogin(ctx context.Context, login string)
 
 // Test Order repo
 
-type TestOrderRepository struct{}
+type TestOrderRepository struct {
+	mu            sync.Mutex
+	UpdatedOrders []model.Order
+	Events        []model.OrderEvent
+	Renewals      int
+	ReleasedUntil time.Time
+}
 
 func NewTestOrderRepository() OrderRepository {
 	return &TestOrderRepository{}
 }
 
-func (r *TestOrderRepository) Create(ctx context.Context, order model.Order) (uint64, error) {
-	if order.Number == "27078" {
-		return 0, errors.New("error create order")
+func (r *TestOrderRepository) WithTx(tx *sqlx.Tx) OrderRepository {
+	return r
+}
+
+func (r *TestOrderRepository) Create(ctx context.Context, order model.Order) (model.Order, bool, error) {
+	if order.Number == "27078" || order.Number == "43513" {
+		return order, false, errors.New("error create order")
+	}
+
+	existing, err := r.GetOrderByNumber(ctx, order.Number)
+	if err == nil {
+		return existing, false, nil
+	}
+
+	order.ID = 444
+	order.Status = model.OrderNew
+
+	return order, true, nil
+}
+
+func (r *TestOrderRepository) CreateBatch(ctx context.Context, orders []model.Order) ([]model.StoredOrder, error) {
+	var stored []model.StoredOrder
+
+	for _, order := range orders {
+		storedOrder, inserted, err := r.Create(ctx, order)
+		if err != nil {
+			return nil, err
+		}
+
+		stored = append(stored, model.StoredOrder{Order: storedOrder, Inserted: inserted})
 	}
 
-	return 444, nil
+	return stored, nil
 }
 
 func (r *TestOrderRepository) GetOrderByNumber(ctx context.Context, number string) (model.Order, error) {
@@ -79,7 +123,10 @@ func (r *TestOrderRepository) GetOrderByNumber(ctx context.Context, number strin
 	}
 
 	if number == "56317" {
+		order.ID = 1
+		order.Number = number
 		order.UserID = 111
+		order.Status = model.OrderProcessing
 		return order, nil
 	}
 
@@ -91,9 +138,47 @@ func (r *TestOrderRepository) GetOrderByNumber(ctx context.Context, number strin
 	return order, sql.ErrNoRows
 }
 
-func (r *TestOrderRepository) GetOrdersByUser(ctx context.Context, userID uint64) ([]model.Order, error) {
+func (r *TestOrderRepository) GetOrdersByUser(ctx context.Context, filter model.OrderFilter) ([]model.Order, error) {
 	var result []model.Order
 
+	userID := filter.UserID
+
+	// Несколько заказов для проверки фильтров и постраничного вывода
+	if userID == 666 {
+		orders := []model.Order{
+			{ID: 1, Number: "12345678903", Status: model.OrderProcessed},
+			{ID: 2, Number: "9278923470", Status: model.OrderNew},
+			{ID: 3, Number: "346436439", Status: model.OrderProcessed},
+		}
+
+		if filter.Sort == model.SortDesc {
+			slices.Reverse(orders)
+		}
+
+		for _, order := range orders {
+			if len(filter.Statuses) > 0 && !slices.Contains(filter.Statuses, order.Status) {
+				continue
+			}
+
+			if filter.Cursor > 0 {
+				if filter.Sort == model.SortDesc && order.ID >= filter.Cursor {
+					continue
+				}
+				if filter.Sort != model.SortDesc && order.ID <= filter.Cursor {
+					continue
+				}
+			}
+
+			if filter.Limit > 0 && len(result) == filter.Limit {
+				break
+			}
+
+			result = append(result, order)
+		}
+
+		return result, nil
+	}
+
 	if userID == 111 {
 		result = append(result, model.Order{
 			ID:     1,
@@ -115,25 +200,95 @@ func (r *TestOrderRepository) GetOrdersByUser(ctx context.Context, userID uint64
 	return result, nil
 }
 
-func (r *TestOrderRepository) GetPendingOrders(ctx context.Context) ([]model.Order, error) {
+func (r *TestOrderRepository) ClaimPendingOrders(ctx context.Context, lockedUntil time.Time, limit int) ([]model.Order, error) {
 	var pendingOrders []model.Order
 
 	return pendingOrders, nil
 }
 
-func (r *TestOrderRepository) UpdateOrder(ctx context.Context, order model.Order) error {
+func (r *TestOrderRepository) CountPendingOrders(ctx context.Context) (int, error) {
+	return 3, nil
+}
+
+func (r *TestOrderRepository) RenewOrders(ctx context.Context, orderIDs []uint64, lockedUntil time.Time, renewedUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Renewals++
+
+	return nil
+}
+
+func (r *TestOrderRepository) ReleaseOrders(ctx context.Context, orderIDs []uint64, lockedUntil time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ReleasedUntil = lockedUntil
+
+	return nil
+}
+
+func (r *TestOrderRepository) UpdateOrder(ctx context.Context, order model.Order, event model.OrderEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	event.OrderID = order.ID
+
+	r.UpdatedOrders = append(r.UpdatedOrders, order)
+	r.Events = append(r.Events, event)
+
+	return nil
+}
+
+func (r *TestOrderRepository) CompleteOrder(ctx context.Context, order model.Order, event model.OrderEvent) error {
+	if order.Number == "90340" {
+		return ErrOrderAlreadyProcessed
+	}
+
+	order.Status = model.OrderProcessed
+
+	return r.UpdateOrder(ctx, order, event)
+}
+
+func (r *TestOrderRepository) AddOrderEvent(ctx context.Context, event model.OrderEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Events = append(r.Events, event)
 
 	return nil
 }
 
+func (r *TestOrderRepository) GetOrderEvents(ctx context.Context, orderID uint64) ([]model.OrderEvent, error) {
+	if orderID != 1 {
+		return nil, errors.New("GetOrderEvents() test error")
+	}
+
+	uploaded := model.OrderNew
+
+	return []model.OrderEvent{
+		{ID: 1, OrderID: 1, Status: model.OrderNew},
+		{ID: 2, OrderID: 1, FromStatus: &uploaded, Status: model.OrderProcessing, Result: "REGISTERED"},
+	}, nil
+}
+
 // Test Balance repo
 
-type TestBalanceRepository struct{}
+type TestBalanceRepository struct {
+	Withdrawn   []model.Withdrawal // Проведенные списания
+	Completed   []string           // Номера подтвержденных списаний
+	Stale       int                // Сколько неподтвержденных списаний отменит CancelStaleWithdrawals
+	StaleBefore time.Time          // Граница последнего вызова CancelStaleWithdrawals
+}
 
 func NewTestBalanceRepository() BalanceRepository {
 	return &TestBalanceRepository{}
 }
 
+func (r *TestBalanceRepository) WithTx(tx *sqlx.Tx) BalanceRepository {
+	return r
+}
+
 func (r *TestBalanceRepository) Withdraw(ctx context.Context, withdraw model.Withdrawal) error {
 	if withdraw.UserID == 444 {
 		return ErrInsufficientFunds
@@ -143,21 +298,30 @@ func (r *TestBalanceRepository) Withdraw(ctx context.Context, withdraw model.Wit
 		return errors.New("Withdraw() test error")
 	}
 
+	if withdraw.UserID == 666 {
+		return ErrWithdrawalExists
+	}
+
+	r.Withdrawn = append(r.Withdrawn, withdraw)
+
 	return nil
 }
 
-func (r *TestBalanceRepository) GetUserWithdrawals(ctx context.Context, userID uint64) ([]model.Withdrawal, error) {
+func (r *TestBalanceRepository) GetUserWithdrawals(ctx context.Context, filter model.WithdrawalFilter) ([]model.Withdrawal, error) {
 	var withdrawals []model.Withdrawal
 
+	userID := filter.UserID
+
 	if userID == 111 {
 		withdrawals = append(withdrawals, model.Withdrawal{
 			ID:     1,
 			UserID: 111,
 			Number: "78477",
+			Status: model.WithdrawalCompleted,
 			CreatedAt: structs.RFCTime{
 				Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
 			},
-			Amount: 200,
+			Amount: structs.NewMoney(200),
 		})
 	}
 
@@ -171,8 +335,8 @@ func (r *TestBalanceRepository) GetUserWithdrawals(ctx context.Context, userID u
 func (r *TestBalanceRepository) GetUserBalance(ctx context.Context, userID uint64) (*model.UserBalance, error) {
 	var balance model.UserBalance
 
-	balance.Balance = 200
-	balance.Withdrawn = 200
+	balance.Balance = structs.NewMoney(200)
+	balance.Withdrawn = structs.NewMoney(200)
 
 	if userID == 222 {
 		balance.Balance = 0
@@ -186,7 +350,569 @@ func (r *TestBalanceRepository) GetUserBalance(ctx context.Context, userID uint6
 	return &balance, nil
 }
 
-func (r *TestBalanceRepository) Deposit(ctx context.Context, userID uint64, sum float64) error {
+func (r *TestBalanceRepository) GetBalanceHistory(
+	ctx context.Context,
+	userID uint64,
+	page model.Page,
+) ([]model.BalanceHistoryEntry, error) {
+	var history []model.BalanceHistoryEntry
+
+	if userID == 222 {
+		return nil, errors.New("GetBalanceHistory() test error")
+	}
+
+	if userID != 111 {
+		return history, nil
+	}
+
+	accrualOrder := "12345678903"
+	withdrawalOrder := "2377225624"
+
+	entries := []model.BalanceHistoryEntry{
+		{
+			ID:          1,
+			Type:        model.LedgerAccrual,
+			OrderNumber: &accrualOrder,
+			Amount:      structs.NewMoney(500.5),
+			Balance:     structs.NewMoney(500.5),
+			CreatedAt:   structs.RFCTime{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			ID:          2,
+			Type:        model.LedgerWithdrawal,
+			OrderNumber: &withdrawalOrder,
+			Amount:      structs.NewMoney(-200),
+			Balance:     structs.NewMoney(300.5),
+			CreatedAt:   structs.RFCTime{Time: time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)},
+		},
+		{
+			ID:        3,
+			Type:      model.LedgerAdjustment,
+			Amount:    structs.NewMoney(0.25),
+			Balance:   structs.NewMoney(300.75),
+			CreatedAt: structs.RFCTime{Time: time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+		},
+	}
+
+	for _, entry := range entries {
+		if entry.ID > page.Cursor && len(history) < page.Limit {
+			history = append(history, entry)
+		}
+	}
+
+	return history, nil
+}
+
+func (r *TestBalanceRepository) Deposit(ctx context.Context, userID uint64, sum structs.Money) error {
+
+	return nil
+}
+
+func (r *TestBalanceRepository) CompleteWithdrawal(ctx context.Context, userID uint64, number string) (model.Withdrawal, error) {
+	if userID == 777 {
+		return model.Withdrawal{}, errors.New("CompleteWithdrawal() test error")
+	}
+
+	if userID != 111 {
+		return model.Withdrawal{}, ErrWithdrawalNotFound
+	}
+
+	if number == "78477" {
+		return model.Withdrawal{}, ErrWithdrawalNotPending
+	}
+
+	r.Completed = append(r.Completed, number)
+
+	return model.Withdrawal{
+		UserID: userID,
+		Number: number,
+		Status: model.WithdrawalCompleted,
+	}, nil
+}
+
+func (r *TestBalanceRepository) CancelWithdrawal(ctx context.Context, userID uint64, number string) (model.Withdrawal, error) {
+	if userID == 222 {
+		return model.Withdrawal{}, errors.New("CancelWithdrawal() test error")
+	}
+
+	if userID != 111 {
+		return model.Withdrawal{}, ErrWithdrawalNotFound
+	}
+
+	switch number {
+	case "89920":
+		return model.Withdrawal{
+			ID:     2,
+			UserID: 111,
+			Number: "89920",
+			Status: model.WithdrawalCancelled,
+			CreatedAt: structs.RFCTime{
+				Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			Amount: structs.NewMoney(100),
+		}, nil
+	case "78477":
+		// Завершенное списание пользователь отменить не может
+		return model.Withdrawal{}, ErrWithdrawalNotReturned
+	default:
+		return model.Withdrawal{}, ErrWithdrawalNotFound
+	}
+}
+
+func (r *TestBalanceRepository) CancelStaleWithdrawals(ctx context.Context, createdBefore time.Time, limit int) (int, error) {
+	r.StaleBefore = createdBefore
+
+	cancelled := min(r.Stale, limit)
+	r.Stale -= cancelled
+
+	return cancelled, nil
+}
+
+func (r *TestBalanceRepository) RefundWithdrawal(ctx context.Context, number string) (model.Withdrawal, error) {
+	switch number {
+	case "78477":
+		return model.Withdrawal{
+			ID:     1,
+			UserID: 111,
+			Number: "78477",
+			Status: model.WithdrawalRefunded,
+			CreatedAt: structs.RFCTime{
+				Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			},
+			Amount: structs.NewMoney(200),
+		}, nil
+	case "2377225624":
+		return model.Withdrawal{}, ErrWithdrawalNotReturned
+	case "41004":
+		return model.Withdrawal{}, errors.New("RefundWithdrawal() test error")
+	default:
+		return model.Withdrawal{}, ErrWithdrawalNotFound
+	}
+}
+
+// Test Token repo
+
+type TestTokenRepository struct {
+	mu       sync.Mutex
+	families map[string]model.TokenFamily
+	tokens   map[string]model.RefreshToken
+	nextID   uint64
+}
+
+func NewTestTokenRepository() *TestTokenRepository {
+	return &TestTokenRepository{
+		families: make(map[string]model.TokenFamily),
+		tokens:   make(map[string]model.RefreshToken),
+	}
+}
+
+func (r *TestTokenRepository) WithTx(tx *sqlx.Tx) TokenRepository {
+	return r
+}
+
+func (r *TestTokenRepository) CreateFamily(ctx context.Context, family model.TokenFamily, token model.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if family.UserID == 0 {
+		return errors.New("CreateFamily() test error")
+	}
+
+	r.families[family.ID] = family
+	r.insertToken(token)
 
 	return nil
 }
+
+func (r *TestTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (model.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	token, ok := r.tokens[tokenHash]
+	if !ok {
+		return token, sql.ErrNoRows
+	}
+
+	family := r.families[token.FamilyID]
+	token.UserID = family.UserID
+	token.RevokedAt = family.RevokedAt
+
+	return token, nil
+}
+
+func (r *TestTokenRepository) RotateRefreshToken(ctx context.Context, usedID uint64, next model.RefreshToken) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for hash, token := range r.tokens {
+		if token.ID != usedID {
+			continue
+		}
+
+		if token.UsedAt != nil {
+			return ErrRefreshTokenUsed
+		}
+
+		now := time.Now()
+		token.UsedAt = &now
+		r.tokens[hash] = token
+
+		r.insertToken(next)
+
+		return nil
+	}
+
+	return sql.ErrNoRows
+}
+
+func (r *TestTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	family, ok := r.families[familyID]
+	if ok && family.RevokedAt == nil {
+		now := time.Now()
+		family.RevokedAt = &now
+		r.families[familyID] = family
+	}
+
+	return nil
+}
+
+func (r *TestTokenRepository) IsFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	family, ok := r.families[familyID]
+	if !ok {
+		return true, nil
+	}
+
+	return family.RevokedAt != nil, nil
+}
+
+func (r *TestTokenRepository) PurgeExpiredTokens(ctx context.Context, expiredBefore time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int
+
+	for hash, token := range r.tokens {
+		if purged < limit && token.ExpiresAt.Before(expiredBefore) {
+			delete(r.tokens, hash)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+func (r *TestTokenRepository) PurgeFamilies(ctx context.Context, before time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	withTokens := make(map[string]bool)
+	for _, token := range r.tokens {
+		withTokens[token.FamilyID] = true
+	}
+
+	var purged int
+
+	for id, family := range r.families {
+		if purged >= limit {
+			break
+		}
+
+		revoked := family.RevokedAt != nil && family.RevokedAt.Before(before)
+		empty := !withTokens[id] && family.CreatedAt.Before(before)
+
+		if revoked || empty {
+			delete(r.families, id)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// Есть ли сессия в репозитории
+func (r *TestTokenRepository) HasFamily(familyID string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.families[familyID]
+
+	return ok
+}
+
+func (r *TestTokenRepository) insertToken(token model.RefreshToken) {
+	r.nextID++
+	token.ID = r.nextID
+	r.tokens[token.TokenHash] = token
+}
+
+// Test Idempotency repo
+
+type TestIdempotencyRepository struct {
+	mu   sync.Mutex
+	keys map[string]model.IdempotencyKey
+}
+
+func NewTestIdempotencyRepository() *TestIdempotencyRepository {
+	return &TestIdempotencyRepository{
+		keys: make(map[string]model.IdempotencyKey),
+	}
+}
+
+func (r *TestIdempotencyRepository) WithTx(tx *sqlx.Tx) IdempotencyRepository {
+	return r
+}
+
+func (r *TestIdempotencyRepository) Reserve(ctx context.Context, key model.IdempotencyKey, staleBefore time.Time) (model.IdempotencyKey, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key.Key == "error" {
+		return key, false, errors.New("Reserve() test error")
+	}
+
+	existing, ok := r.keys[key.Key]
+
+	stale := ok && !existing.Completed() &&
+		existing.RequestHash == key.RequestHash &&
+		existing.CreatedAt.Before(staleBefore)
+
+	if ok && !stale {
+		return existing, false, nil
+	}
+
+	r.keys[key.Key] = key
+
+	return key, true, nil
+}
+
+func (r *TestIdempotencyRepository) Complete(ctx context.Context, userID uint64, key, token string, code int, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.keys[key]
+	if !ok || record.Completed() || record.Token != token {
+		return ErrIdempotencyReservationLost
+	}
+
+	record.ResponseCode = &code
+	record.ResponseBody = body
+	r.keys[key] = record
+
+	return nil
+}
+
+func (r *TestIdempotencyRepository) Release(ctx context.Context, userID uint64, key, token string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record, ok := r.keys[key]; ok && !record.Completed() && record.Token == token {
+		delete(r.keys, key)
+	}
+
+	return nil
+}
+
+func (r *TestIdempotencyRepository) PurgeExpired(ctx context.Context, createdBefore time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var purged int
+
+	for key, record := range r.keys {
+		if purged < limit && record.CreatedAt.Before(createdBefore) {
+			delete(r.keys, key)
+			purged++
+		}
+	}
+
+	return purged, nil
+}
+
+// Сохраненная запись ключа
+func (r *TestIdempotencyRepository) Get(key string) (model.IdempotencyKey, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.keys[key]
+
+	return record, ok
+}
+
+// Test Webhook repo
+
+type TestWebhookRepository struct {
+	mu         sync.Mutex
+	webhooks   []model.Webhook
+	Deliveries []model.WebhookDelivery
+	Updated    []model.WebhookDelivery
+}
+
+func NewTestWebhookRepository() *TestWebhookRepository {
+	return &TestWebhookRepository{}
+}
+
+func (r *TestWebhookRepository) WithTx(tx *sqlx.Tx) WebhookRepository {
+	return r
+}
+
+func (r *TestWebhookRepository) Create(ctx context.Context, webhook model.Webhook) (model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if webhook.UserID == 222 {
+		return webhook, errors.New("Create() test error")
+	}
+
+	webhook.ID = uint64(len(r.webhooks) + 1)
+	r.webhooks = append(r.webhooks, webhook)
+
+	return webhook, nil
+}
+
+func (r *TestWebhookRepository) GetUserWebhooks(ctx context.Context, userID uint64) ([]model.Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var webhooks []model.Webhook
+
+	for _, webhook := range r.webhooks {
+		if webhook.UserID == userID {
+			webhook.Secret = ""
+			webhooks = append(webhooks, webhook)
+		}
+	}
+
+	return webhooks, nil
+}
+
+func (r *TestWebhookRepository) Delete(ctx context.Context, userID uint64, webhookID uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, webhook := range r.webhooks {
+		if webhook.ID == webhookID && webhook.UserID == userID {
+			r.webhooks = slices.Delete(r.webhooks, i, i+1)
+			return nil
+		}
+	}
+
+	return ErrWebhookNotFound
+}
+
+func (r *TestWebhookRepository) ClaimDueDeliveries(ctx context.Context, lockedUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []model.WebhookDelivery
+
+	for _, delivery := range r.Deliveries {
+		if delivery.Status == model.WebhookDeliveryPending && len(due) < limit {
+			due = append(due, delivery)
+		}
+	}
+
+	return due, nil
+}
+
+func (r *TestWebhookRepository) UpdateDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.Updated = append(r.Updated, delivery)
+
+	for i := range r.Deliveries {
+		if r.Deliveries[i].ID == delivery.ID {
+			r.Deliveries[i] = delivery
+		}
+	}
+
+	return nil
+}
+
+func (r *TestWebhookRepository) GetDeadDeliveries(ctx context.Context, userID uint64, page model.Page) ([]model.WebhookDelivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if userID == 222 {
+		return nil, errors.New("GetDeadDeliveries() test error")
+	}
+
+	var dead []model.WebhookDelivery
+
+	for _, delivery := range r.Deliveries {
+		if delivery.UserID != userID || delivery.Status != model.WebhookDeliveryDead || delivery.ID <= page.Cursor {
+			continue
+		}
+
+		if page.Limit > 0 && len(dead) == page.Limit {
+			break
+		}
+
+		dead = append(dead, delivery)
+	}
+
+	return dead, nil
+}
+
+// Test Outbox repo
+
+type TestOutboxRepository struct {
+	mu          sync.Mutex
+	Events      []model.DomainEvent
+	PublishedAt []time.Time // Время публикации еще не удаленных опубликованных событий
+}
+
+func (r *TestOutboxRepository) WithTx(tx *sqlx.Tx) OutboxRepository {
+	return r
+}
+
+func (r *TestOutboxRepository) PublishPending(
+	ctx context.Context,
+	limit int,
+	publish func(ctx context.Context, events []model.DomainEvent) error,
+) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	pending := r.Events[:min(limit, len(r.Events))]
+	if len(pending) == 0 {
+		return 0, nil
+	}
+
+	if err := publish(ctx, pending); err != nil {
+		return 0, err
+	}
+
+	r.Events = r.Events[len(pending):]
+
+	return len(pending), nil
+}
+
+func (r *TestOutboxRepository) PurgePublished(ctx context.Context, publishedBefore time.Time, limit int) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var (
+		kept   []time.Time
+		purged int
+	)
+
+	for _, publishedAt := range r.PublishedAt {
+		if purged < limit && publishedAt.Before(publishedBefore) {
+			purged++
+			continue
+		}
+
+		kept = append(kept, publishedAt)
+	}
+
+	r.PublishedAt = kept
+
+	return purged, nil
+}
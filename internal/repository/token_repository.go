@@ -0,0 +1,202 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/database"
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrRefreshTokenUsed = errors.New("refresh token has already been used")
+
+type TokenRepository interface {
+	WithTx(tx *sqlx.Tx) TokenRepository
+	CreateFamily(ctx context.Context, family model.TokenFamily, token model.RefreshToken) error
+	GetRefreshToken(ctx context.Context, tokenHash string) (model.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, usedID uint64, next model.RefreshToken) error
+	RevokeFamily(ctx context.Context, familyID string) error
+	IsFamilyRevoked(ctx context.Context, familyID string) (bool, error)
+	PurgeExpiredTokens(ctx context.Context, expiredBefore time.Time, limit int) (int, error)
+	PurgeFamilies(ctx context.Context, before time.Time, limit int) (int, error)
+}
+
+type PgTokenRepository struct {
+	db database.Querier
+}
+
+func NewPgTokenRepository(db database.Querier) TokenRepository {
+	return &PgTokenRepository{
+		db: db,
+	}
+}
+
+// Репозиторий, выполняющий запросы в переданной транзакции
+func (r *PgTokenRepository) WithTx(tx *sqlx.Tx) TokenRepository {
+	return NewPgTokenRepository(tx)
+}
+
+// Создаем новую сессию вместе с первым refresh токеном
+func (r *PgTokenRepository) CreateFamily(ctx context.Context, family model.TokenFamily, token model.RefreshToken) error {
+	return database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(
+			ctx,
+			"INSERT INTO token_families (id, user_id, created_at) VALUES ($1, $2, $3)",
+			family.ID,
+			family.UserID,
+			family.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		return insertRefreshToken(ctx, tx, token)
+	})
+}
+
+func (r *PgTokenRepository) GetRefreshToken(ctx context.Context, tokenHash string) (model.RefreshToken, error) {
+	var token model.RefreshToken
+
+	selectTokenQuery := `SELECT
+			t.id,
+			t.family_id,
+			f.user_id,
+			t.token_hash,
+			t.created_at,
+			t.expires_at,
+			t.used_at,
+			f.revoked_at
+		FROM refresh_tokens t
+		JOIN token_families f ON f.id = t.family_id
+		WHERE t.token_hash = $1`
+	err := r.db.QueryRowxContext(ctx, selectTokenQuery, tokenHash).StructScan(&token)
+
+	return token, err
+}
+
+// Помечаем refresh токен использованным и выдаем следующий в том же семействе.
+// Если токен уже был использован, возвращаем ErrRefreshTokenUsed
+func (r *PgTokenRepository) RotateRefreshToken(ctx context.Context, usedID uint64, next model.RefreshToken) error {
+	return database.WrapTx(ctx, r.db, func(ctx context.Context, tx *sqlx.Tx) error {
+		result, err := tx.ExecContext(
+			ctx,
+			"UPDATE refresh_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL",
+			time.Now(),
+			usedID,
+		)
+		if err != nil {
+			return err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+
+		if affected == 0 {
+			return ErrRefreshTokenUsed
+		}
+
+		return insertRefreshToken(ctx, tx, next)
+	})
+}
+
+func (r *PgTokenRepository) RevokeFamily(ctx context.Context, familyID string) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		"UPDATE token_families SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL",
+		time.Now(),
+		familyID,
+	)
+
+	return err
+}
+
+// Неизвестная сессия считается отозванной
+func (r *PgTokenRepository) IsFamilyRevoked(ctx context.Context, familyID string) (bool, error) {
+	var revoked bool
+
+	err := r.db.QueryRowContext(
+		ctx,
+		"SELECT revoked_at IS NOT NULL FROM token_families WHERE id = $1",
+		familyID,
+	).Scan(&revoked)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// Удаляем refresh токены, истекшие раньше expiredBefore, не больше limit за вызов.
+// Возвращает количество удаленных токенов
+func (r *PgTokenRepository) PurgeExpiredTokens(ctx context.Context, expiredBefore time.Time, limit int) (int, error) {
+	result, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM refresh_tokens WHERE id IN (
+			SELECT id FROM refresh_tokens
+			WHERE expires_at < $1
+			LIMIT $2
+		)`,
+		expiredBefore,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+
+	return int(purged), err
+}
+
+// Удаляем сессии, отозванные раньше before, и сессии без refresh токенов
+// (все токены истекли и удалены), не больше limit за вызов. Неизвестная сессия
+// считается отозванной, поэтому access токены удаленных сессий не оживают.
+// Возвращает количество удаленных сессий
+func (r *PgTokenRepository) PurgeFamilies(ctx context.Context, before time.Time, limit int) (int, error) {
+	result, err := r.db.ExecContext(
+		ctx,
+		`DELETE FROM token_families WHERE id IN (
+			SELECT f.id FROM token_families f
+			WHERE f.revoked_at < $1
+				OR (f.created_at < $1 AND NOT EXISTS (
+					SELECT 1 FROM refresh_tokens t WHERE t.family_id = f.id
+				))
+			LIMIT $2
+		)`,
+		before,
+		limit,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	purged, err := result.RowsAffected()
+
+	return int(purged), err
+}
+
+func insertRefreshToken(ctx context.Context, q database.Querier, token model.RefreshToken) error {
+	_, err := q.ExecContext(
+		ctx,
+		`INSERT INTO refresh_tokens
+			(family_id, token_hash, created_at, expires_at)
+				VALUES
+			($1, $2, $3, $4)`,
+		token.FamilyID,
+		token.TokenHash,
+		token.CreatedAt,
+		token.ExpiresAt,
+	)
+
+	return err
+}
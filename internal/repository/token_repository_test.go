@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgTokenRepositoryPurge(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	repo := NewPgTokenRepository(db)
+
+	now := time.Now()
+	suffix := now.UnixNano()
+
+	newSession := func(name string, expiresAt time.Time) string {
+		id := fmt.Sprintf("purge_%s_%d", name, suffix)
+
+		require.NoError(t, repo.CreateFamily(
+			ctx,
+			model.TokenFamily{ID: id, UserID: 111, CreatedAt: now.Add(-time.Hour)},
+			model.RefreshToken{FamilyID: id, TokenHash: id, CreatedAt: now.Add(-time.Hour), ExpiresAt: expiresAt},
+		))
+
+		return id
+	}
+
+	active := newSession("active", now.Add(time.Hour))
+	expired := newSession("expired", now.Add(-time.Minute))
+	revoked := newSession("revoked", now.Add(time.Hour))
+	require.NoError(t, repo.RevokeFamily(ctx, revoked))
+
+	_, err := repo.PurgeExpiredTokens(ctx, now, 1000)
+	require.NoError(t, err)
+
+	_, err = repo.PurgeFamilies(ctx, time.Now(), 1000)
+	require.NoError(t, err)
+
+	// Истекший токен удален, активный остался
+	_, err = repo.GetRefreshToken(ctx, expired)
+	assert.Error(t, err)
+
+	_, err = repo.GetRefreshToken(ctx, active)
+	assert.NoError(t, err)
+
+	// Удаленные сессии считаются отозванными
+	for _, id := range []string{expired, revoked} {
+		isRevoked, err := repo.IsFamilyRevoked(ctx, id)
+		require.NoError(t, err)
+		assert.True(t, isRevoked)
+	}
+
+	isRevoked, err := repo.IsFamilyRevoked(ctx, active)
+	require.NoError(t, err)
+	assert.False(t, isRevoked)
+}
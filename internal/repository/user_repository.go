@@ -3,26 +3,33 @@ package repository
 import (
 	"context"
 
+	"github.com/Sadere/gophermart/internal/database"
 	"github.com/Sadere/gophermart/internal/model"
 	"github.com/jmoiron/sqlx"
 )
 
 type UserRepository interface {
+	WithTx(tx *sqlx.Tx) UserRepository
 	Create(ctx context.Context, user model.User) (uint64, error)
 	GetUserByID(ctx context.Context, ID uint64) (model.User, error)
 	GetUserByLogin(ctx context.Context, login string) (model.User, error)
 }
 
 type PgUserRepository struct {
-	db *sqlx.DB
+	db database.Querier
 }
 
-func NewPgUserRepository(db *sqlx.DB) UserRepository {
+func NewPgUserRepository(db database.Querier) UserRepository {
 	return &PgUserRepository{
 		db: db,
 	}
 }
 
+// Репозиторий, выполняющий запросы в переданной транзакции
+func (r *PgUserRepository) WithTx(tx *sqlx.Tx) UserRepository {
+	return NewPgUserRepository(tx)
+}
+
 // Creates new user and returns new user id
 func (r *PgUserRepository) Create(ctx context.Context, user model.User) (uint64, error) {
 	var newUserID uint64
@@ -36,7 +43,7 @@ func (r *PgUserRepository) Create(ctx context.Context, user model.User) (uint64,
 	err := result.Scan(&newUserID)
 
 	if err != nil {
-		return 0, err
+		return 0, mapConstraintError(err)
 	}
 
 	return newUserID, nil
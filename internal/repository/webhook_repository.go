@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/database"
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+type WebhookRepository interface {
+	WithTx(tx *sqlx.Tx) WebhookRepository
+	Create(ctx context.Context, webhook model.Webhook) (model.Webhook, error)
+	GetUserWebhooks(ctx context.Context, userID uint64) ([]model.Webhook, error)
+	Delete(ctx context.Context, userID uint64, webhookID uint64) error
+	ClaimDueDeliveries(ctx context.Context, lockedUntil time.Time, limit int) ([]model.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery model.WebhookDelivery) error
+	GetDeadDeliveries(ctx context.Context, userID uint64, page model.Page) ([]model.WebhookDelivery, error)
+}
+
+type PgWebhookRepository struct {
+	db database.Querier
+}
+
+func NewPgWebhookRepository(db database.Querier) WebhookRepository {
+	return &PgWebhookRepository{
+		db: db,
+	}
+}
+
+// Репозиторий, выполняющий запросы в переданной транзакции
+func (r *PgWebhookRepository) WithTx(tx *sqlx.Tx) WebhookRepository {
+	return NewPgWebhookRepository(tx)
+}
+
+func (r *PgWebhookRepository) Create(ctx context.Context, webhook model.Webhook) (model.Webhook, error) {
+	err := r.db.QueryRowContext(
+		ctx,
+		`INSERT INTO webhooks (user_id, url, secret, events, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
+		webhook.UserID,
+		webhook.URL,
+		webhook.Secret,
+		webhook.Events,
+		webhook.CreatedAt,
+	).Scan(&webhook.ID)
+
+	return webhook, mapConstraintError(err)
+}
+
+func (r *PgWebhookRepository) GetUserWebhooks(ctx context.Context, userID uint64) ([]model.Webhook, error) {
+	var webhooks []model.Webhook
+
+	err := r.db.SelectContext(
+		ctx,
+		&webhooks,
+		`SELECT id, user_id, url, events, created_at FROM webhooks WHERE user_id = $1 ORDER BY id`,
+		userID,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+// Удаляем webhook пользователя вместе с недоставленными событиями
+func (r *PgWebhookRepository) Delete(ctx context.Context, userID uint64, webhookID uint64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = $1 AND user_id = $2`, webhookID, userID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if deleted == 0 {
+		return ErrWebhookNotFound
+	}
+
+	return nil
+}
+
+// Захватываем доставки, время которых подошло, чтобы другие реплики их не отправляли
+func (r *PgWebhookRepository) ClaimDueDeliveries(ctx context.Context, lockedUntil time.Time, limit int) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+
+	now := time.Now()
+
+	query := `WITH claimed AS (
+			UPDATE webhook_deliveries SET locked_until = $1
+			WHERE id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = $2
+					AND next_attempt_at <= $3
+					AND (locked_until IS NULL OR locked_until < $3)
+				ORDER BY next_attempt_at
+				LIMIT $4
+				FOR UPDATE SKIP LOCKED
+			)
+			RETURNING *
+		)
+		SELECT
+			d.id, d.webhook_id, w.user_id, w.url, w.secret, d.event_type, d.payload,
+			d.status, d.attempts, d.next_attempt_at, d.last_error, d.created_at, d.delivered_at
+		FROM claimed d
+		JOIN webhooks w ON w.id = d.webhook_id
+		ORDER BY d.id`
+
+	err := r.db.SelectContext(ctx, &deliveries, query, lockedUntil, model.WebhookDeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Сохраняем результат попытки доставки и снимаем захват
+func (r *PgWebhookRepository) UpdateDelivery(ctx context.Context, delivery model.WebhookDelivery) error {
+	_, err := r.db.ExecContext(
+		ctx,
+		`UPDATE webhook_deliveries
+			SET status = $1, attempts = $2, next_attempt_at = $3, last_error = $4, delivered_at = $5, locked_until = NULL
+			WHERE id = $6`,
+		delivery.Status,
+		delivery.Attempts,
+		delivery.NextAttemptAt,
+		delivery.LastError,
+		delivery.DeliveredAt,
+		delivery.ID,
+	)
+
+	return err
+}
+
+// Недоставленные события пользователя постранично
+func (r *PgWebhookRepository) GetDeadDeliveries(ctx context.Context, userID uint64, page model.Page) ([]model.WebhookDelivery, error) {
+	var deliveries []model.WebhookDelivery
+
+	var query strings.Builder
+	args := []interface{}{userID, model.WebhookDeliveryDead}
+
+	query.WriteString(`
+		SELECT id, webhook_id, user_id, url, event_type, payload, status, attempts, next_attempt_at, last_error, created_at
+		FROM (
+			SELECT
+				d.id, d.webhook_id, w.user_id, w.url, d.event_type, d.payload,
+				d.status, d.attempts, d.next_attempt_at, d.last_error, d.created_at
+			FROM webhook_deliveries d
+			JOIN webhooks w ON w.id = d.webhook_id
+		) deliveries
+		WHERE user_id = ? AND status = ?`)
+
+	args = applyPage(&query, args, nil, nil, page)
+
+	err := r.db.SelectContext(ctx, &deliveries, r.db.Rebind(query.String()), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// Записываем событие в outbox для всех webhook пользователя, подписанных на него.
+// Вызывается в транзакции изменения, чтобы событие не потерялось и не появилось без изменения
+func enqueueWebhookEvent(ctx context.Context, q database.Querier, userID uint64, event model.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(
+		ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, event_type, payload, next_attempt_at, created_at)
+			SELECT id, $2::varchar, $3::jsonb, $4::timestamp, $4::timestamp FROM webhooks
+			WHERE user_id = $1 AND $2::text = ANY(string_to_array(events, ','))`,
+		userID,
+		event.Type,
+		payload,
+		event.CreatedAt.Time,
+	)
+
+	return err
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/structs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgWebhookRepositoryPayloadUser(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	userID, err := NewPgUserRepository(db).Create(ctx, model.User{
+		Login:        fmt.Sprintf("webhook_%d", time.Now().UnixNano()),
+		PasswordHash: "hash",
+		CreatedAt:    time.Now(),
+	})
+	require.NoError(t, err)
+
+	repo := NewPgWebhookRepository(db)
+	_, err = repo.Create(ctx, model.Webhook{
+		UserID:    userID,
+		URL:       "https://example.com/hook",
+		Secret:    "secret",
+		Events:    model.WebhookEvents{model.WebhookBalanceWithdrawn},
+		CreatedAt: structs.RFCTime{Time: time.Now()},
+	})
+	require.NoError(t, err)
+
+	number := fmt.Sprintf("%d", time.Now().UnixNano())
+
+	balanceRepo := NewPgBalanceRepository(db)
+	require.NoError(t, balanceRepo.Deposit(ctx, userID, structs.NewMoney(100)))
+	require.NoError(t, balanceRepo.Withdraw(ctx, model.Withdrawal{
+		UserID:    userID,
+		Number:    number,
+		Status:    model.WithdrawalCompleted,
+		Amount:    structs.NewMoney(10),
+		CreatedAt: structs.RFCTime{Time: time.Now()},
+	}))
+
+	deliveries, err := repo.ClaimDueDeliveries(ctx, time.Now().Add(time.Minute), 1000)
+	require.NoError(t, err)
+
+	var found bool
+	for _, delivery := range deliveries {
+		if delivery.UserID != userID {
+			continue
+		}
+
+		var event struct {
+			Data model.WebhookWithdrawalData `json:"data"`
+		}
+		require.NoError(t, json.Unmarshal(delivery.Payload, &event))
+
+		// Получатель видит, чье это списание
+		assert.Equal(t, userID, event.Data.UserID)
+		assert.Equal(t, number, event.Data.Number)
+		found = true
+	}
+
+	assert.True(t, found)
+}
@@ -2,22 +2,81 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
+	"github.com/Sadere/gophermart/internal/metrics"
 	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/repository"
 	"github.com/Sadere/gophermart/internal/structs"
+	"github.com/Sadere/gophermart/internal/tracing"
 	"github.com/go-resty/resty/v2"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var (
+	ErrAccrualRateLimited        = errors.New("accrual rate limit exceeded")
+	ErrAccrualOrderNotRegistered = errors.New("order is not registered in accrual")
+)
+
+const (
+	// Максимальная пауза между опросами незарегистрированного заказа
+	maxRegisterBackoff = time.Hour
+
+	// Сколько заказов захватываем за один цикл опроса
+	pullBatchSize = 1000
+)
+
+// Итог опроса заказа, попадает в лог поля outcome
+const (
+	pullOutcomeProcessed        = "processed"         // баллы начислены
+	pullOutcomeAlreadyProcessed = "already_processed" // заказ уже завершен другой репликой
+	pullOutcomeInvalid          = "invalid"           // accrual отклонил заказ
+	pullOutcomePending          = "pending"           // accrual еще считает начисление
+	pullOutcomePostponed        = "postponed"         // заказ не зарегистрирован, опрос отложен
+	pullOutcomeExpired          = "expired"           // заказ слишком долго не регистрировался
+	pullOutcomeRateLimited      = "rate_limited"
+	pullOutcomeError            = "error"
+)
+
+var accrualStatusMap = map[string]model.OrderStatus{
+	"REGISTERED": model.OrderNew,
+	"INVALID":    model.OrderInvalid,
+	"PROCESSING": model.OrderProcessing,
+	"PROCESSED":  model.OrderProcessed,
+}
+
+// Получатель уведомлений об изменениях, сделанных при опросе accrual
+type Notifier interface {
+	Publish(notification model.Notification)
+}
+
 type AccrualService struct {
 	balanceRepo  repository.BalanceRepository
 	orderRepo    repository.OrderRepository
+	notifier     Notifier
 	accrualAddr  structs.NetAddress
 	pullInterval time.Duration
+	workers      int
+	orderMaxAge  time.Duration
+	orderLease   time.Duration
+	drainTimeout time.Duration
+	limiter      *accrualLimiter
+	client       *resty.Client
+}
+
+// Результат обработки заказа воркером
+type pullResult struct {
+	number  string
+	outcome string
+	err     error
 }
 
 func NewAccrualService(
@@ -25,102 +84,511 @@ func NewAccrualService(
 	balanceRepo repository.BalanceRepository,
 	accrualAddr structs.NetAddress,
 	pullInterval time.Duration,
+	workers int,
+	orderMaxAge time.Duration,
+	orderLease time.Duration,
+	drainTimeout time.Duration,
+	notifier Notifier,
 ) *AccrualService {
+	if workers < 1 {
+		workers = 1
+	}
+
 	return &AccrualService{
 		orderRepo:    orderRepo,
 		balanceRepo:  balanceRepo,
 		accrualAddr:  accrualAddr,
 		pullInterval: pullInterval,
+		workers:      workers,
+		orderMaxAge:  orderMaxAge,
+		orderLease:   orderLease,
+		drainTimeout: drainTimeout,
+		notifier:     notifier,
+		limiter:      newAccrualLimiter(),
+		// Транспорт пишет запросы в трассировку и передает accrual заголовок traceparent
+		client: resty.New().SetTransport(otelhttp.NewTransport(http.DefaultTransport)),
 	}
 }
 
-func (s *AccrualService) Pull() {
-	statusMap := map[string]model.OrderStatus{
-		"REGISTERED": model.OrderNew,
-		"INVALID":    model.OrderInvalid,
-		"PROCESSING": model.OrderProcessing,
-		"PROCESSED":  model.OrderProcessed,
+// Опрашиваем accrual до отмены контекста. После отмены новые заказы не захватываются,
+// а уже захваченная пачка дорабатывается, но не дольше drainTimeout
+func (s *AccrualService) Pull(ctx context.Context) {
+	for {
+		cycleStart := time.Now()
+
+		pullCtx, cancel := context.WithTimeout(ctx, time.Duration(time.Second*5))
+
+		// Глубина очереди до захвата очередной пачки
+		if pending, err := s.orderRepo.CountPendingOrders(pullCtx); err == nil {
+			metrics.PendingOrders.Set(float64(pending))
+		}
+
+		// Захватываем заказы, чтобы другие реплики их не опрашивали
+		lockedUntil := time.Now().Add(s.orderLease).Truncate(time.Microsecond)
+
+		orders, err := s.orderRepo.ClaimPendingOrders(pullCtx, lockedUntil, pullBatchSize)
+		if err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "failed to claim orders", slog.Any("error", err))
+		}
+
+		cancel()
+
+		// Пачка может обрабатываться дольше срока захвата, особенно при лимите запросов accrual,
+		// поэтому продлеваем захват, пока воркеры не закончат
+		stopRenewal := s.renewLease(ctx, orders, lockedUntil)
+
+		workCtx, cancelWork := s.drainContext(ctx)
+		s.processOrders(workCtx, orders)
+		cancelWork()
+
+		lockedUntil = stopRenewal()
+
+		s.releaseOrders(ctx, orders, lockedUntil)
+
+		metrics.AccrualPollDuration.Observe(time.Since(cycleStart).Seconds())
+
+		// Ждем интервал
+		select {
+		case <-ctx.Done():
+			slog.Info("accrual poller stopped")
+			return
+		case <-time.After(s.pullInterval):
+		}
 	}
+}
 
-	for {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(time.Second*5))
+// Контекст обработки захваченных заказов: не отменяется вместе с ctx,
+// чтобы запросы к accrual и ожидание лимита не обрывались посреди пачки,
+// но после отмены ctx живет не дольше drainTimeout
+func (s *AccrualService) drainContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	workCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
 
-		orders, err := s.orderRepo.GetPendingOrders(ctx)
-		if err != nil {
-			log.Printf("pull error: %v\n", err)
+	go func() {
+		select {
+		case <-workCtx.Done():
+			return
+		case <-ctx.Done():
 		}
 
-		for _, order := range orders {
-			// Указываем, что заказ попал в обработку
-			if order.Status == model.OrderNew {
-				order.Status = model.OrderProcessing
+		select {
+		case <-workCtx.Done():
+		case <-time.After(s.drainTimeout):
+			cancel()
+		}
+	}()
 
-				err = s.orderRepo.UpdateOrder(context.Background(), order)
-				if err != nil {
-					log.Println("failed to update order: ", err)
-				}
+	return workCtx, cancel
+}
+
+// Продлеваем захват заказов каждую треть его срока, чтобы другие реплики не перехватили
+// заказы, которые еще обрабатываются. Возвращаемая функция останавливает продление
+// и отдает текущий срок захвата
+func (s *AccrualService) renewLease(ctx context.Context, orders []model.Order, lockedUntil time.Time) func() time.Time {
+	if len(orders) == 0 {
+		return func() time.Time {
+			return lockedUntil
+		}
+	}
+
+	orderIDs := make([]uint64, 0, len(orders))
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.ID)
+	}
+
+	// Продлеваем и после отмены ctx, пока пачка дорабатывается
+	renewCtx := context.WithoutCancel(ctx)
+
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(max(s.orderLease/3, time.Millisecond))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
 			}
 
-			accOrder, err := s.pullAccrual(order.Number)
+			renewedUntil := time.Now().Add(s.orderLease).Truncate(time.Microsecond)
+
+			queryCtx, cancel := context.WithTimeout(renewCtx, time.Duration(time.Second*5))
+			err := s.orderRepo.RenewOrders(queryCtx, orderIDs, lockedUntil, renewedUntil)
+			cancel()
 
 			if err != nil {
-				log.Printf("failed to pull accrual, error: %v\n", err)
+				slog.ErrorContext(renewCtx, "failed to renew orders lease", slog.Int("orders", len(orderIDs)), slog.Any("error", err))
 				continue
 			}
 
-			newStatus, ok := statusMap[accOrder.Status]
-			if !ok {
-				log.Printf("unknown status %s", accOrder.Status)
-				continue
-			}
+			lockedUntil = renewedUntil
+		}
+	}()
+
+	return func() time.Time {
+		close(stop)
+		<-stopped
+
+		return lockedUntil
+	}
+}
+
+// Отпускаем захваченные заказы, чтобы их можно было опросить в следующем цикле
+func (s *AccrualService) releaseOrders(ctx context.Context, orders []model.Order, lockedUntil time.Time) {
+	if len(orders) == 0 {
+		return
+	}
+
+	orderIDs := make([]uint64, 0, len(orders))
+	for _, order := range orders {
+		orderIDs = append(orderIDs, order.ID)
+	}
+
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), time.Duration(time.Second*5))
+	defer cancel()
+
+	if err := s.orderRepo.ReleaseOrders(releaseCtx, orderIDs, lockedUntil); err != nil {
+		slog.ErrorContext(ctx, "failed to release orders", slog.Int("orders", len(orderIDs)), slog.Any("error", err))
+	}
+}
+
+// Раздаем заказы пулу воркеров и собираем результаты,
+// возвращаемся только после того, как все воркеры завершили работу
+func (s *AccrualService) processOrders(ctx context.Context, orders []model.Order) []pullResult {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	jobs := make(chan model.Order)
+	results := make(chan pullResult, len(orders))
+
+	workers := min(s.workers, len(orders))
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
 
-			order.Status = newStatus
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
 
-			if accOrder.Accrual != nil && *accOrder.Accrual > 0 {
-				order.Accrual = accOrder.Accrual
+			for order := range jobs {
+				orderCtx, span := tracing.Tracer().Start(ctx, "accrual.process_order",
+					trace.WithAttributes(attribute.String("order.number", order.Number)),
+				)
 
-				err = s.balanceRepo.Deposit(context.Background(), order.UserID, *order.Accrual)
+				start := time.Now()
+				outcome, err := s.processOrder(orderCtx, order)
 
-				if err != nil {
-					log.Println("failed to deposit user balance: ", err)
-					continue
+				logOrderAttempt(orderCtx, order, outcome, time.Since(start), err)
+
+				span.SetAttributes(attribute.String("accrual.outcome", outcome))
+				tracing.EndSpan(span, err)
+
+				results <- pullResult{
+					number:  order.Number,
+					outcome: outcome,
+					err:     err,
 				}
 			}
+		}()
+	}
 
-			err = s.orderRepo.UpdateOrder(context.Background(), order)
-			if err != nil {
-				log.Println("failed to update order: ", err)
-			}
+feed:
+	for _, order := range orders {
+		select {
+		case <-ctx.Done():
+			break feed
+		case jobs <- order:
+		}
+	}
+	close(jobs)
+
+	wg.Wait()
+	close(results)
+
+	processed := make([]pullResult, 0, len(orders))
+	for result := range results {
+		processed = append(processed, result)
+	}
+
+	return processed
+}
+
+// Опрашиваем accrual по одному заказу и сохраняем результат, возвращаем итог опроса для лога
+func (s *AccrualService) processOrder(ctx context.Context, order model.Order) (string, error) {
+	// Результат опроса сохраняем, даже если сервис уже останавливается
+	dbCtx := context.WithoutCancel(ctx)
+
+	// Указываем, что заказ попал в обработку
+	if order.Status == model.OrderNew {
+		order.Status = model.OrderProcessing
 
+		event := newOrderEvent(model.OrderNew, order, "")
+
+		err := s.orderRepo.UpdateOrder(dbCtx, order, event)
+		if err != nil {
+			return pullOutcomeError, fmt.Errorf("failed to update order: %w", err)
 		}
 
-		cancel()
+		s.notifyOrder(order, event)
+	}
 
-		// Ждем интервал
-		time.Sleep(s.pullInterval)
+	accOrder, err := s.pullAccrual(ctx, order.Number)
+
+	// Заказ еще не зарегистрирован в accrual, откладываем следующий опрос
+	if errors.Is(err, ErrAccrualOrderNotRegistered) {
+		return s.postponeOrder(dbCtx, order, time.Now())
 	}
+
+	// Неудачный опрос тоже попадает в историю заказа
+	if err != nil {
+		event := newOrderEvent(order.Status, order, model.AccrualResultError)
+		event.Details = err.Error()
+
+		// Время ожидания в ошибке меняется от попытки к попытке, в историю пишем только причину,
+		// чтобы повторные отказы по лимиту не создавали новых событий
+		if errors.Is(err, ErrAccrualRateLimited) {
+			event.Details = ErrAccrualRateLimited.Error()
+		}
+
+		if eventErr := s.orderRepo.AddOrderEvent(dbCtx, event); eventErr != nil {
+			slog.ErrorContext(ctx, "failed to save order event", slog.String("order", order.Number), slog.Any("error", eventErr))
+		}
+
+		if errors.Is(err, ErrAccrualRateLimited) {
+			return pullOutcomeRateLimited, fmt.Errorf("failed to pull accrual: %w", err)
+		}
+
+		return pullOutcomeError, fmt.Errorf("failed to pull accrual: %w", err)
+	}
+
+	newStatus, ok := accrualStatusMap[accOrder.Status]
+	if !ok {
+		return pullOutcomeError, fmt.Errorf("unknown status %s", accOrder.Status)
+	}
+
+	previousStatus := order.Status
+
+	order.Status = newStatus
+	order.Attempts = 0
+	order.NextAttemptAt = nil
+
+	if accOrder.Accrual != nil && *accOrder.Accrual > 0 {
+		order.Accrual = accOrder.Accrual
+	}
+
+	event := newOrderEvent(previousStatus, order, accOrder.Status)
+	event.Accrual = accOrder.Accrual
+
+	// Начисление баллов и смена статуса выполняются атомарно
+	if order.Status == model.OrderProcessed {
+		err = s.orderRepo.CompleteOrder(dbCtx, order, event)
+
+		if errors.Is(err, repository.ErrOrderAlreadyProcessed) {
+			return pullOutcomeAlreadyProcessed, nil
+		}
+
+		if err != nil {
+			return pullOutcomeError, fmt.Errorf("failed to complete order: %w", err)
+		}
+
+		if order.Accrual != nil && *order.Accrual > 0 {
+			metrics.Deposits.Inc()
+			metrics.DepositedPoints.Add(order.Accrual.Float64())
+		}
+
+		s.notifyOrder(order, event)
+		s.notifyBalance(order)
+
+		return pullOutcomeProcessed, nil
+	}
+
+	err = s.orderRepo.UpdateOrder(dbCtx, order, event)
+	if err != nil {
+		return pullOutcomeError, fmt.Errorf("failed to update order: %w", err)
+	}
+
+	s.notifyOrder(order, event)
+
+	if order.Status == model.OrderInvalid {
+		return pullOutcomeInvalid, nil
+	}
+
+	return pullOutcomePending, nil
+}
+
+// Возвращаем заказ в статус NEW и откладываем следующий опрос с экспоненциальной задержкой,
+// слишком долго незарегистрированный заказ помечаем как INVALID
+func (s *AccrualService) postponeOrder(ctx context.Context, order model.Order, now time.Time) (string, error) {
+	previousStatus := order.Status
+	outcome := pullOutcomePostponed
+
+	if s.orderMaxAge > 0 && now.Sub(order.CreatedAt.Time) > s.orderMaxAge {
+		order.Status = model.OrderInvalid
+		order.NextAttemptAt = nil
+
+		outcome = pullOutcomeExpired
+	} else {
+		order.Status = model.OrderNew
+		order.Attempts++
+
+		nextAttempt := now.Add(registerBackoff(s.pullInterval, order.Attempts))
+		order.NextAttemptAt = &nextAttempt
+	}
+
+	event := newOrderEvent(previousStatus, order, model.AccrualResultNotRegistered)
+
+	err := s.orderRepo.UpdateOrder(ctx, order, event)
+	if err != nil {
+		return pullOutcomeError, fmt.Errorf("failed to update order: %w", err)
+	}
+
+	s.notifyOrder(order, event)
+
+	return outcome, nil
 }
 
-func (s *AccrualService) pullAccrual(orderNumber string) (model.AccOrder, error) {
-	var accOrder model.AccOrder
+// Уведомляем пользователя о смене статуса заказа
+func (s *AccrualService) notifyOrder(order model.Order, event model.OrderEvent) {
+	if s.notifier == nil || event.FromStatus == nil {
+		return
+	}
+
+	s.notifier.Publish(model.Notification{
+		Type:      model.NotificationOrder,
+		UserID:    order.UserID,
+		Order:     &order,
+		CreatedAt: event.CreatedAt,
+	})
+}
+
+// Уведомляем пользователя о начислении баллов за заказ
+func (s *AccrualService) notifyBalance(order model.Order) {
+	if s.notifier == nil || order.Accrual == nil || *order.Accrual <= 0 {
+		return
+	}
+
+	s.notifier.Publish(model.Notification{
+		Type:      model.NotificationBalance,
+		UserID:    order.UserID,
+		Order:     &order,
+		Amount:    order.Accrual,
+		CreatedAt: structs.RFCTime{Time: time.Now()},
+	})
+}
+
+// Пишем в лог итог опроса заказа, неудачные попытки - с уровнем ошибки
+func logOrderAttempt(ctx context.Context, order model.Order, outcome string, duration time.Duration, err error) {
+	attrs := []slog.Attr{
+		slog.String("order", order.Number),
+		slog.String("outcome", outcome),
+		slog.String("status", string(order.Status)),
+		slog.Uint64("attempts", uint64(order.Attempts)),
+		slog.Duration("duration", duration),
+	}
+
+	if err != nil {
+		attrs = append(attrs, slog.Any("error", err))
+		slog.LogAttrs(ctx, slog.LevelError, "order attempt failed", attrs...)
+
+		return
+	}
+
+	slog.LogAttrs(ctx, slog.LevelInfo, "order attempt", attrs...)
+}
+
+// Событие истории заказа, предыдущий статус указываем, только если статус изменился
+func newOrderEvent(previousStatus model.OrderStatus, order model.Order, result string) model.OrderEvent {
+	event := model.OrderEvent{
+		OrderID:   order.ID,
+		Status:    order.Status,
+		Result:    result,
+		CreatedAt: structs.RFCTime{Time: time.Now()},
+	}
+
+	if previousStatus != order.Status {
+		event.FromStatus = &previousStatus
+	}
+
+	return event
+}
+
+// Задержка перед очередным опросом: base * 2^(attempts-1), но не больше maxRegisterBackoff
+func registerBackoff(base time.Duration, attempts uint) time.Duration {
+	if base <= 0 {
+		base = time.Second
+	}
+
+	delay := base
+	for i := uint(1); i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRegisterBackoff {
+			return maxRegisterBackoff
+		}
+	}
+
+	return min(delay, maxRegisterBackoff)
+}
+
+func (s *AccrualService) pullAccrual(ctx context.Context, orderNumber string) (accOrder model.AccOrder, err error) {
+	ctx, span := tracing.Tracer().Start(ctx, "accrual.pull",
+		trace.WithAttributes(attribute.String("order.number", orderNumber)),
+	)
+	defer func() {
+		// Незарегистрированный заказ - обычный ответ accrual, а не сбой
+		if errors.Is(err, ErrAccrualOrderNotRegistered) {
+			span.SetAttributes(attribute.Bool("accrual.registered", false))
+			span.End()
+
+			return
+		}
+
+		tracing.EndSpan(span, err)
+	}()
 
 	baseURL := fmt.Sprintf(
 		"http://%s",
 		s.accrualAddr.String(),
 	)
 
-	client := resty.New()
-
 	path := fmt.Sprintf("/api/orders/%s", orderNumber)
 
-	result, err := client.R().
+	// Ждем своей очереди, если accrual ограничил количество запросов
+	if err := s.limiter.Wait(ctx); err != nil {
+		return accOrder, err
+	}
+
+	result, err := s.client.R().
+		SetContext(ctx).
 		SetResult(&accOrder).
 		Get(baseURL + path)
 
 	if err != nil {
+		metrics.AccrualResponses.WithLabelValues("error").Inc()
 		return accOrder, err
 	}
 
+	metrics.AccrualResponses.WithLabelValues(strconv.Itoa(result.StatusCode())).Inc()
+
+	if result.StatusCode() == http.StatusNoContent {
+		return accOrder, ErrAccrualOrderNotRegistered
+	}
+
+	if result.StatusCode() == http.StatusTooManyRequests {
+		retryAfter := parseRetryAfter(result.Header().Get("Retry-After"), time.Now())
+		s.limiter.Pause(retryAfter)
+
+		if limit, ok := parseRequestLimit(string(result.Body())); ok {
+			s.limiter.SetLimit(limit)
+		}
+
+		return accOrder, fmt.Errorf("%w, retry after %s", ErrAccrualRateLimited, retryAfter)
+	}
+
 	if result.StatusCode() != http.StatusOK {
 		return accOrder, fmt.Errorf("received code = %d", result.StatusCode())
 	}
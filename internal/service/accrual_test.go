@@ -0,0 +1,506 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/metrics"
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/pubsub"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/Sadere/gophermart/internal/structs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func newTestAccrualServer(t *testing.T, handler http.HandlerFunc) structs.NetAddress {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	var addr structs.NetAddress
+	err := addr.Set(srv.URL)
+	assert.NoError(t, err)
+
+	return addr
+}
+
+func TestProcessOrders(t *testing.T) {
+	var inFlight, maxInFlight int32
+
+	addr := newTestAccrualServer(t, func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+
+		for {
+			seen := atomic.LoadInt32(&maxInFlight)
+			if current <= seen || atomic.CompareAndSwapInt32(&maxInFlight, seen, current) {
+				break
+			}
+		}
+
+		time.Sleep(20 * time.Millisecond)
+
+		number := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+
+		if number == "000" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"order":"%s","status":"PROCESSED","accrual":10}`, number)
+	})
+
+	workers := 3
+	orderRepo := &repository.TestOrderRepository{}
+	accService := NewAccrualService(
+		orderRepo,
+		repository.NewTestBalanceRepository(),
+		addr,
+		time.Second,
+		workers,
+		time.Hour,
+		time.Minute,
+		time.Second,
+		nil,
+	)
+
+	var orders []model.Order
+	for i := 1; i <= 10; i++ {
+		orders = append(orders, model.Order{
+			ID:     uint64(i),
+			Number: fmt.Sprintf("%03d", i),
+			Status: model.OrderNew,
+		})
+	}
+	orders = append(orders, model.Order{ID: 11, Number: "000", Status: model.OrderProcessing})
+
+	results := accService.processOrders(context.Background(), orders)
+
+	assert.Len(t, results, len(orders))
+	assert.LessOrEqual(t, int(maxInFlight), workers)
+
+	failed := 0
+	for _, result := range results {
+		if result.err != nil {
+			failed++
+			assert.Equal(t, "000", result.number)
+			assert.Equal(t, pullOutcomeError, result.outcome)
+		}
+	}
+	assert.Equal(t, 1, failed)
+
+	// Неудачный опрос записан в историю заказа
+	var errorEvents []model.OrderEvent
+	for _, event := range orderRepo.Events {
+		if event.Result == model.AccrualResultError {
+			errorEvents = append(errorEvents, event)
+		}
+	}
+	if assert.Len(t, errorEvents, 1) {
+		assert.Equal(t, uint64(11), errorEvents[0].OrderID)
+		assert.NotEmpty(t, errorEvents[0].Details)
+	}
+
+	assert.Empty(t, accService.processOrders(context.Background(), nil))
+}
+
+func TestPullAccrualTooManyRequests(t *testing.T) {
+	addr := newTestAccrualServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+		fmt.Fprint(w, "No more than 30 requests per minute allowed")
+	})
+
+	accService := NewAccrualService(
+		repository.NewTestOrderRepository(),
+		repository.NewTestBalanceRepository(),
+		addr,
+		time.Second,
+		1,
+		time.Hour,
+		time.Minute,
+		time.Second,
+		nil,
+	)
+
+	_, err := accService.pullAccrual(context.Background(), "12345")
+
+	assert.ErrorIs(t, err, ErrAccrualRateLimited)
+	assert.Equal(t, 2*time.Second, accService.limiter.interval)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), accService.limiter.pausedUntil, time.Second)
+}
+
+func TestPullAccrualTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	var traceparent string
+
+	addr := newTestAccrualServer(t, func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	accService := NewAccrualService(
+		repository.NewTestOrderRepository(),
+		repository.NewTestBalanceRepository(),
+		addr,
+		time.Second,
+		1,
+		time.Hour,
+		time.Minute,
+		time.Second,
+		nil,
+	)
+
+	_, err := accService.pullAccrual(context.Background(), "12345")
+	assert.ErrorIs(t, err, ErrAccrualOrderNotRegistered)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	pullSpan, ok := spans["accrual.pull"]
+	if !assert.True(t, ok) {
+		return
+	}
+
+	// Accrual получил контекст трассировки, незарегистрированный заказ не считается сбоем
+	assert.Contains(t, traceparent, pullSpan.SpanContext().TraceID().String())
+	assert.NotEqual(t, "Error", pullSpan.Status().Code.String())
+	assert.Len(t, recorder.Ended(), 2)
+}
+
+func TestRegisterBackoff(t *testing.T) {
+	assert.Equal(t, 10*time.Second, registerBackoff(10*time.Second, 1))
+	assert.Equal(t, 20*time.Second, registerBackoff(10*time.Second, 2))
+	assert.Equal(t, 80*time.Second, registerBackoff(10*time.Second, 4))
+	assert.Equal(t, maxRegisterBackoff, registerBackoff(10*time.Second, 100))
+}
+
+func TestProcessOrderNotRegistered(t *testing.T) {
+	addr := newTestAccrualServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		order        model.Order
+		wantStatus   model.OrderStatus
+		wantAttempts uint
+		wantNext     bool
+		wantOutcome  string
+	}{
+		{
+			name: "first attempt",
+			order: model.Order{
+				ID:        1,
+				Number:    "12345",
+				Status:    model.OrderNew,
+				CreatedAt: structs.RFCTime{Time: now},
+			},
+			wantStatus:   model.OrderNew,
+			wantAttempts: 1,
+			wantNext:     true,
+			wantOutcome:  pullOutcomePostponed,
+		},
+		{
+			name: "processing order goes back to new",
+			order: model.Order{
+				ID:        2,
+				Number:    "12345",
+				Status:    model.OrderProcessing,
+				CreatedAt: structs.RFCTime{Time: now},
+				Attempts:  3,
+			},
+			wantStatus:   model.OrderNew,
+			wantAttempts: 4,
+			wantNext:     true,
+			wantOutcome:  pullOutcomePostponed,
+		},
+		{
+			name: "too old order becomes invalid",
+			order: model.Order{
+				ID:        3,
+				Number:    "12345",
+				Status:    model.OrderNew,
+				CreatedAt: structs.RFCTime{Time: now.Add(-2 * time.Hour)},
+				Attempts:  10,
+			},
+			wantStatus:   model.OrderInvalid,
+			wantAttempts: 10,
+			wantNext:     false,
+			wantOutcome:  pullOutcomeExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orderRepo := &repository.TestOrderRepository{}
+			accService := NewAccrualService(
+				orderRepo,
+				repository.NewTestBalanceRepository(),
+				addr,
+				time.Second,
+				1,
+				time.Hour,
+				time.Minute,
+				time.Second,
+				nil,
+			)
+
+			outcome, err := accService.processOrder(context.Background(), tt.order)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantOutcome, outcome)
+
+			if assert.NotEmpty(t, orderRepo.UpdatedOrders) {
+				last := orderRepo.UpdatedOrders[len(orderRepo.UpdatedOrders)-1]
+
+				assert.Equal(t, tt.wantStatus, last.Status)
+				assert.Equal(t, tt.wantAttempts, last.Attempts)
+
+				if tt.wantNext {
+					assert.NotNil(t, last.NextAttemptAt)
+				} else {
+					assert.Nil(t, last.NextAttemptAt)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessOrderCompleted(t *testing.T) {
+	addr := newTestAccrualServer(t, func(w http.ResponseWriter, r *http.Request) {
+		number := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"order":"%s","status":"PROCESSED","accrual":729.98}`, number)
+	})
+
+	orderRepo := &repository.TestOrderRepository{}
+	broker := pubsub.NewBroker()
+	accService := NewAccrualService(
+		orderRepo,
+		repository.NewTestBalanceRepository(),
+		addr,
+		time.Second,
+		1,
+		time.Hour,
+		time.Minute,
+		time.Second,
+		broker,
+	)
+
+	notifications, unsubscribe := broker.Subscribe(111)
+	defer unsubscribe()
+
+	t.Run("order completed", func(t *testing.T) {
+		okResponses := testutil.ToFloat64(metrics.AccrualResponses.WithLabelValues("200"))
+		deposits := testutil.ToFloat64(metrics.Deposits)
+
+		outcome, err := accService.processOrder(context.Background(), model.Order{ID: 1, UserID: 111, Number: "12345", Status: model.OrderProcessing})
+		assert.NoError(t, err)
+		assert.Equal(t, pullOutcomeProcessed, outcome)
+
+		if assert.Len(t, orderRepo.UpdatedOrders, 1) {
+			completed := orderRepo.UpdatedOrders[0]
+
+			assert.Equal(t, model.OrderProcessed, completed.Status)
+			if assert.NotNil(t, completed.Accrual) {
+				assert.Equal(t, structs.Money(72998), *completed.Accrual)
+			}
+		}
+
+		assert.Equal(t, okResponses+1, testutil.ToFloat64(metrics.AccrualResponses.WithLabelValues("200")))
+		assert.Equal(t, deposits+1, testutil.ToFloat64(metrics.Deposits))
+
+		// Результат опроса записан в историю заказа
+		if assert.Len(t, orderRepo.Events, 1) {
+			event := orderRepo.Events[0]
+
+			assert.Equal(t, model.OrderProcessed, event.Status)
+			assert.Equal(t, "PROCESSED", event.Result)
+			if assert.NotNil(t, event.FromStatus) {
+				assert.Equal(t, model.OrderProcessing, *event.FromStatus)
+			}
+		}
+
+		// Пользователь получил уведомления о заказе и начислении
+		if assert.Len(t, notifications, 2) {
+			orderNotification := <-notifications
+			assert.Equal(t, model.NotificationOrder, orderNotification.Type)
+			assert.Equal(t, model.OrderProcessed, orderNotification.Order.Status)
+
+			balanceNotification := <-notifications
+			assert.Equal(t, model.NotificationBalance, balanceNotification.Type)
+			if assert.NotNil(t, balanceNotification.Amount) {
+				assert.Equal(t, structs.Money(72998), *balanceNotification.Amount)
+			}
+		}
+	})
+
+	t.Run("order already processed", func(t *testing.T) {
+		outcome, err := accService.processOrder(context.Background(), model.Order{ID: 2, Number: "90340", Status: model.OrderProcessing})
+		assert.NoError(t, err)
+		assert.Equal(t, pullOutcomeAlreadyProcessed, outcome)
+	})
+}
+
+func TestPullStopsOnCancel(t *testing.T) {
+	accService := NewAccrualService(
+		repository.NewTestOrderRepository(),
+		repository.NewTestBalanceRepository(),
+		structs.NetAddress{},
+		time.Hour,
+		1,
+		time.Hour,
+		time.Minute,
+		time.Second,
+		nil,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		accService.Pull(ctx)
+	}()
+
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Pull() didn't stop after context cancel")
+	}
+}
+
+func TestProcessOrdersAfterCancel(t *testing.T) {
+	started := make(chan struct{}, 1)
+
+	addr := newTestAccrualServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+
+		time.Sleep(50 * time.Millisecond)
+
+		number := strings.TrimPrefix(r.URL.Path, "/api/orders/")
+
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"order":"%s","status":"PROCESSING"}`, number)
+	})
+
+	accService := NewAccrualService(
+		&repository.TestOrderRepository{},
+		repository.NewTestBalanceRepository(),
+		addr,
+		time.Second,
+		1,
+		time.Hour,
+		time.Minute,
+		time.Second,
+		nil,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	orders := []model.Order{
+		{ID: 1, Number: "001", Status: model.OrderProcessing},
+		{ID: 2, Number: "002", Status: model.OrderProcessing},
+	}
+
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	workCtx, cancelWork := accService.drainContext(ctx)
+	defer cancelWork()
+
+	// Отмена во время запроса не обрывает захваченную пачку
+	results := accService.processOrders(workCtx, orders)
+
+	if assert.Len(t, results, len(orders)) {
+		for _, result := range results {
+			assert.NoError(t, result.err)
+			assert.Equal(t, pullOutcomePending, result.outcome)
+		}
+	}
+}
+
+func TestDrainContext(t *testing.T) {
+	accService := NewAccrualService(
+		repository.NewTestOrderRepository(),
+		repository.NewTestBalanceRepository(),
+		structs.NetAddress{},
+		time.Hour,
+		1,
+		time.Hour,
+		time.Minute,
+		50*time.Millisecond,
+		nil,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	workCtx, cancelWork := accService.drainContext(ctx)
+	defer cancelWork()
+
+	cancel()
+
+	// Сразу после отмены работа продолжается, по истечении drainTimeout прерывается
+	assert.NoError(t, workCtx.Err())
+
+	select {
+	case <-workCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("work context wasn't cancelled after drain timeout")
+	}
+}
+
+func TestRenewLease(t *testing.T) {
+	orderRepo := &repository.TestOrderRepository{}
+	accService := NewAccrualService(
+		orderRepo,
+		repository.NewTestBalanceRepository(),
+		structs.NetAddress{},
+		time.Hour,
+		1,
+		time.Hour,
+		30*time.Millisecond,
+		time.Second,
+		nil,
+	)
+
+	lockedUntil := time.Now().Add(30 * time.Millisecond)
+
+	stop := accService.renewLease(context.Background(), []model.Order{{ID: 1}}, lockedUntil)
+	time.Sleep(100 * time.Millisecond)
+	renewedUntil := stop()
+
+	// Захват продлевался, пока пачка обрабатывалась
+	assert.Greater(t, orderRepo.Renewals, 0)
+	assert.True(t, renewedUntil.After(lockedUntil))
+
+	// Пустую пачку продлевать не нужно
+	assert.Equal(t, lockedUntil, accService.renewLease(context.Background(), nil, lockedUntil)())
+}
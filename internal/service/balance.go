@@ -3,17 +3,27 @@ package service
 import (
 	"context"
 	"errors"
+	"time"
 
+	"github.com/Sadere/gophermart/internal/metrics"
 	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/Sadere/gophermart/internal/structs"
 	"github.com/Sadere/gophermart/internal/utils"
 )
 
 var (
-	ErrInsufficientFunds = errors.New("insufficient funds")
-	ErrOrderNotFound     = errors.New("order not found")
+	ErrInsufficientFunds     = errors.New("insufficient funds")
+	ErrOrderNotFound         = errors.New("order not found")
+	ErrWithdrawalExists      = errors.New("order has already been paid with points")
+	ErrWithdrawalNotFound    = errors.New("withdrawal not found")
+	ErrWithdrawalNotReturned = errors.New("withdrawal can't be returned in its current status")
+	ErrWithdrawalNotPending  = errors.New("withdrawal is not pending")
 )
 
+// Сколько неподтвержденное списание держит баллы, прежде чем отмениться автоматически
+const WithdrawalHoldTTL = 15 * time.Minute
+
 type BalanceService struct {
 	balanceRepo repository.BalanceRepository
 }
@@ -24,14 +34,18 @@ func NewBalanceService(balanceRepo repository.BalanceRepository) *BalanceService
 	}
 }
 
-func (s *BalanceService) RegisterWithdraw(userID uint64, orderNumber string, sum float64) error {
+// Списываем баллы в счет оплаты заказа. Без hold списание завершается сразу.
+// С hold баллы резервируются неподтвержденным списанием: клиент подтверждает его
+// через ConfirmWithdrawal или отменяет, а неподтвержденное за WithdrawalHoldTTL
+// отменяется автоматически
+func (s *BalanceService) RegisterWithdraw(ctx context.Context, userID uint64, orderNumber string, sum structs.Money, hold bool) error {
 	// Проверяем валидность номера
 	if !utils.CheckLuhn(orderNumber) {
 		return ErrOrderInvalidNumber
 	}
 
 	// Получаем баланс пользователя
-	userBalance, err := s.balanceRepo.GetUserBalance(context.Background(), userID)
+	userBalance, err := s.balanceRepo.GetUserBalance(ctx, userID)
 	if err != nil {
 		return err
 	}
@@ -44,33 +58,118 @@ func (s *BalanceService) RegisterWithdraw(userID uint64, orderNumber string, sum
 	withdrawRequest := model.Withdrawal{
 		UserID: userID,
 		Number: orderNumber,
+		Status: model.WithdrawalCompleted,
 		Amount: sum,
 	}
-	err = s.balanceRepo.Withdraw(context.Background(), withdrawRequest)
+
+	if hold {
+		withdrawRequest.Status = model.WithdrawalPending
+	}
+
+	err = s.balanceRepo.Withdraw(ctx, withdrawRequest)
 
 	if errors.Is(err, repository.ErrInsufficientFunds) {
 		return ErrInsufficientFunds
 	}
 
-	if err != nil {
+	if errors.Is(err, repository.ErrWithdrawalExists) {
+		return ErrWithdrawalExists
+	}
+
+	if err != nil || hold {
 		return err
 	}
 
+	metrics.Withdrawals.Inc()
+	metrics.WithdrawnPoints.Add(sum.Float64())
+
 	return nil
 }
 
-func (s *BalanceService) ListUserWithdrawals(userID uint64) ([]model.Withdrawal, error) {
-	withdrawals, err := s.balanceRepo.GetUserWithdrawals(context.Background(), userID)
+// Подтверждаем неподтвержденное списание пользователя
+func (s *BalanceService) ConfirmWithdrawal(ctx context.Context, userID uint64, orderNumber string) (model.Withdrawal, error) {
+	withdrawal, err := s.balanceRepo.CompleteWithdrawal(ctx, userID, orderNumber)
+
+	if errors.Is(err, repository.ErrWithdrawalNotFound) {
+		return withdrawal, ErrWithdrawalNotFound
+	}
+
+	if errors.Is(err, repository.ErrWithdrawalNotPending) {
+		return withdrawal, ErrWithdrawalNotPending
+	}
 
 	if err != nil {
-		return nil, err
+		return withdrawal, err
 	}
 
-	return withdrawals, nil
+	metrics.Withdrawals.Inc()
+	metrics.WithdrawnPoints.Add(withdrawal.Amount.Float64())
+
+	return withdrawal, nil
+}
+
+// Отменяем неподтвержденное списание пользователя по номеру заказа и возвращаем баллы на баланс
+func (s *BalanceService) CancelWithdrawal(ctx context.Context, userID uint64, orderNumber string) (model.Withdrawal, error) {
+	withdrawal, err := s.balanceRepo.CancelWithdrawal(ctx, userID, orderNumber)
+
+	return withdrawal, mapReturnError(err)
+}
+
+// Возвращаем оплату заказа баллами: завершенное списание переходит в REFUNDED,
+// баллы возвращаются на баланс. Только для служебного API
+func (s *BalanceService) RefundWithdrawal(ctx context.Context, orderNumber string) (model.Withdrawal, error) {
+	withdrawal, err := s.balanceRepo.RefundWithdrawal(ctx, orderNumber)
+
+	return withdrawal, mapReturnError(err)
+}
+
+func mapReturnError(err error) error {
+	if errors.Is(err, repository.ErrWithdrawalNotFound) {
+		return ErrWithdrawalNotFound
+	}
+
+	if errors.Is(err, repository.ErrWithdrawalNotReturned) {
+		return ErrWithdrawalNotReturned
+	}
+
+	return err
+}
+
+// Списания пользователя по фильтру постранично.
+// Возвращает курсор следующей страницы или 0, если страница последняя
+func (s *BalanceService) ListUserWithdrawals(ctx context.Context, filter model.WithdrawalFilter) ([]model.Withdrawal, uint64, error) {
+	limit := filter.Limit
+	filter.Limit = pageFetchLimit(limit)
+
+	withdrawals, err := s.balanceRepo.GetUserWithdrawals(ctx, filter)
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	withdrawals, nextCursor := paginate(withdrawals, limit, func(w model.Withdrawal) uint64 { return w.ID })
+
+	return withdrawals, nextCursor, nil
+}
+
+// История операций по балансу пользователя постранично.
+// Возвращает курсор следующей страницы или 0, если страница последняя
+func (s *BalanceService) GetBalanceHistory(ctx context.Context, userID uint64, page model.Page) ([]model.BalanceHistoryEntry, uint64, error) {
+	limit := page.Limit
+	page.Limit = pageFetchLimit(limit)
+
+	history, err := s.balanceRepo.GetBalanceHistory(ctx, userID, page)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	history, nextCursor := paginate(history, limit, func(entry model.BalanceHistoryEntry) uint64 { return entry.ID })
+
+	return history, nextCursor, nil
 }
 
-func (s *BalanceService) GetUserBalance(userID uint64) (*model.UserBalance, error) {
-	balance, err := s.balanceRepo.GetUserBalance(context.Background(), userID)
+func (s *BalanceService) GetUserBalance(ctx context.Context, userID uint64) (*model.UserBalance, error) {
+	balance, err := s.balanceRepo.GetUserBalance(ctx, userID)
 
 	if err != nil {
 		return nil, err
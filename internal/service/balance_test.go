@@ -1,10 +1,12 @@
 package service
 
 import (
+	"context"
 	"testing"
 
 	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/Sadere/gophermart/internal/structs"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -16,56 +18,72 @@ func TestRegisterWithdraw(t *testing.T) {
 		name    string
 		userID  uint64
 		number  string
-		sum     float64
+		sum     structs.Money
+		hold    bool
 		wantErr bool
 	}{
 		{
 			name:    "success withdrawal register",
 			userID:  111,
 			number:  "89920",
-			sum:     100,
+			sum:     structs.NewMoney(100),
+			wantErr: false,
+		},
+		{
+			name:    "withdrawal on hold",
+			userID:  111,
+			number:  "78477",
+			sum:     structs.NewMoney(100),
+			hold:    true,
 			wantErr: false,
 		},
 		{
 			name:    "invalid withdraw order number",
 			userID:  111,
 			number:  "111",
-			sum:     100,
+			sum:     structs.NewMoney(100),
 			wantErr: true,
 		},
 		{
 			name:    "no funds",
 			userID:  222,
 			number:  "89920",
-			sum:     100,
+			sum:     structs.NewMoney(100),
 			wantErr: true,
 		},
 		{
 			name:    "error on getting balance",
 			userID:  333,
 			number:  "89920",
-			sum:     100,
+			sum:     structs.NewMoney(100),
 			wantErr: true,
 		},
 		{
 			name:    "no funds on withdraw",
 			userID:  444,
 			number:  "89920",
-			sum:     50,
+			sum:     structs.NewMoney(50),
 			wantErr: true,
 		},
 		{
 			name:    "error withdraw",
 			userID:  555,
 			number:  "89920",
-			sum:     50,
+			sum:     structs.NewMoney(50),
+			wantErr: true,
+		},
+		{
+			name:    "order already paid",
+			userID:  666,
+			number:  "89920",
+			sum:     structs.NewMoney(50),
 			wantErr: true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := balanceService.RegisterWithdraw(tt.userID, tt.number, tt.sum)
+			err := balanceService.RegisterWithdraw(context.Background(), tt.userID, tt.number, tt.sum, tt.hold)
 
 			if tt.wantErr {
 				assert.Error(t, err)
@@ -74,6 +92,58 @@ func TestRegisterWithdraw(t *testing.T) {
 			}
 		})
 	}
+
+	// Без hold списание завершается сразу, с hold - ждет подтверждения
+	if assert.Len(t, repo.Withdrawn, 2) {
+		assert.Equal(t, model.WithdrawalCompleted, repo.Withdrawn[0].Status)
+		assert.Equal(t, model.WithdrawalPending, repo.Withdrawn[1].Status)
+	}
+}
+
+func TestConfirmWithdrawal(t *testing.T) {
+	repo := &repository.TestBalanceRepository{}
+	balanceService := NewBalanceService(repo)
+
+	tests := []struct {
+		name    string
+		userID  uint64
+		number  string
+		wantErr error
+	}{
+		{
+			name:   "confirm pending withdrawal",
+			userID: 111,
+			number: "89920",
+		},
+		{
+			name:    "not pending",
+			userID:  111,
+			number:  "78477",
+			wantErr: ErrWithdrawalNotPending,
+		},
+		{
+			name:    "not found",
+			userID:  333,
+			number:  "89920",
+			wantErr: ErrWithdrawalNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withdrawal, err := balanceService.ConfirmWithdrawal(context.Background(), tt.userID, tt.number)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, model.WithdrawalCompleted, withdrawal.Status)
+		})
+	}
+
+	assert.Equal(t, []string{"89920"}, repo.Completed)
 }
 
 func TestListUserWithdrawals(t *testing.T) {
@@ -109,7 +179,7 @@ func TestListUserWithdrawals(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			withdrawals, err := balanceService.ListUserWithdrawals(tt.userID)
+			withdrawals, _, err := balanceService.ListUserWithdrawals(context.Background(), model.WithdrawalFilter{UserID: tt.userID})
 
 			assert.Len(t, withdrawals, tt.want.len)
 
@@ -122,6 +192,94 @@ func TestListUserWithdrawals(t *testing.T) {
 	}
 }
 
+func TestCancelWithdrawal(t *testing.T) {
+	repo := &repository.TestBalanceRepository{}
+	balanceService := NewBalanceService(repo)
+
+	tests := []struct {
+		name       string
+		userID     uint64
+		number     string
+		wantStatus model.WithdrawalStatus
+		wantErr    error
+	}{
+		{
+			name:       "cancel pending withdrawal",
+			userID:     111,
+			number:     "89920",
+			wantStatus: model.WithdrawalCancelled,
+		},
+		{
+			name:    "completed withdrawal",
+			userID:  111,
+			number:  "78477",
+			wantErr: ErrWithdrawalNotReturned,
+		},
+		{
+			name:    "not found",
+			userID:  111,
+			number:  "41004",
+			wantErr: ErrWithdrawalNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withdrawal, err := balanceService.CancelWithdrawal(context.Background(), tt.userID, tt.number)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, withdrawal.Status)
+		})
+	}
+}
+
+func TestRefundWithdrawal(t *testing.T) {
+	repo := &repository.TestBalanceRepository{}
+	balanceService := NewBalanceService(repo)
+
+	tests := []struct {
+		name       string
+		number     string
+		wantStatus model.WithdrawalStatus
+		wantErr    error
+	}{
+		{
+			name:       "refund completed withdrawal",
+			number:     "78477",
+			wantStatus: model.WithdrawalRefunded,
+		},
+		{
+			name:    "already refunded",
+			number:  "2377225624",
+			wantErr: ErrWithdrawalNotReturned,
+		},
+		{
+			name:    "not found",
+			number:  "89920",
+			wantErr: ErrWithdrawalNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withdrawal, err := balanceService.RefundWithdrawal(context.Background(), tt.number)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantStatus, withdrawal.Status)
+		})
+	}
+}
+
 func TestGetUserBalance(t *testing.T) {
 	repo := &repository.TestBalanceRepository{}
 	balanceService := NewBalanceService(repo)
@@ -140,8 +298,8 @@ func TestGetUserBalance(t *testing.T) {
 			userID: 111,
 			want: want{
 				balance: model.UserBalance{
-					Balance:   200,
-					Withdrawn: 200,
+					Balance:   structs.NewMoney(200),
+					Withdrawn: structs.NewMoney(200),
 				},
 				err: false,
 			},
@@ -157,7 +315,7 @@ func TestGetUserBalance(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			balance, err := balanceService.GetUserBalance(tt.userID)
+			balance, err := balanceService.GetUserBalance(context.Background(), tt.userID)
 
 			if tt.want.err {
 				assert.Error(t, err)
@@ -173,3 +331,76 @@ func TestGetUserBalance(t *testing.T) {
 		})
 	}
 }
+
+func TestGetBalanceHistory(t *testing.T) {
+	repo := &repository.TestBalanceRepository{}
+	balanceService := NewBalanceService(repo)
+
+	type want struct {
+		ids        []uint64
+		nextCursor uint64
+		err        bool
+	}
+	tests := []struct {
+		name   string
+		userID uint64
+		cursor uint64
+		limit  int
+		want   want
+	}{
+		{
+			name:   "first page",
+			userID: 111,
+			limit:  2,
+			want: want{
+				ids:        []uint64{1, 2},
+				nextCursor: 2,
+			},
+		},
+		{
+			name:   "last page",
+			userID: 111,
+			cursor: 2,
+			limit:  2,
+			want: want{
+				ids: []uint64{3},
+			},
+		},
+		{
+			name:   "whole history fits",
+			userID: 111,
+			limit:  3,
+			want: want{
+				ids: []uint64{1, 2, 3},
+			},
+		},
+		{
+			name:   "error",
+			userID: 222,
+			limit:  2,
+			want: want{
+				err: true,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			history, nextCursor, err := balanceService.GetBalanceHistory(context.Background(), tt.userID, model.Page{Cursor: tt.cursor, Limit: tt.limit})
+
+			if tt.want.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want.nextCursor, nextCursor)
+
+			var ids []uint64
+			for _, entry := range history {
+				ids = append(ids, entry.ID)
+			}
+			assert.Equal(t, tt.want.ids, ids)
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/repository"
+)
+
+const (
+	// Как часто запускается фоновая очистка
+	cleanupInterval = time.Minute
+
+	// Сколько записей обрабатываем за один запрос очистки
+	cleanupBatchSize = 500
+
+	// Сколько хранятся ключи идемпотентности: в течение этого времени повтор
+	// запроса получает сохраненный ответ
+	IdempotencyKeyTTL = 24 * time.Hour
+)
+
+// Фоновая очистка: отмена зависших неподтвержденных списаний, удаление
+// устаревших ключей идемпотентности, истекших refresh токенов и отозванных сессий
+type CleanupService struct {
+	balanceRepo     repository.BalanceRepository
+	idempotencyRepo repository.IdempotencyRepository
+	tokenRepo       repository.TokenRepository
+}
+
+func NewCleanupService(
+	balanceRepo repository.BalanceRepository,
+	idempotencyRepo repository.IdempotencyRepository,
+	tokenRepo repository.TokenRepository,
+) *CleanupService {
+	return &CleanupService{
+		balanceRepo:     balanceRepo,
+		idempotencyRepo: idempotencyRepo,
+		tokenRepo:       tokenRepo,
+	}
+}
+
+// Чистим до отмены контекста
+func (s *CleanupService) Run(ctx context.Context) {
+	for {
+		s.cleanup(ctx)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("cleanup stopped")
+			return
+		case <-time.After(cleanupInterval):
+		}
+	}
+}
+
+func (s *CleanupService) cleanup(ctx context.Context) {
+	now := time.Now()
+
+	cancelled, err := drainBatches(ctx, func(ctx context.Context) (int, error) {
+		return s.balanceRepo.CancelStaleWithdrawals(ctx, now.Add(-WithdrawalHoldTTL), cleanupBatchSize)
+	})
+	if err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "failed to cancel stale withdrawals", slog.Any("error", err))
+	}
+
+	if cancelled > 0 {
+		slog.InfoContext(ctx, "cancelled stale withdrawals", slog.Int("count", cancelled))
+	}
+
+	purged, err := drainBatches(ctx, func(ctx context.Context) (int, error) {
+		return s.idempotencyRepo.PurgeExpired(ctx, now.Add(-IdempotencyKeyTTL), cleanupBatchSize)
+	})
+	if err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "failed to purge idempotency keys", slog.Any("error", err))
+	}
+
+	if purged > 0 {
+		slog.InfoContext(ctx, "purged idempotency keys", slog.Int("count", purged))
+	}
+
+	s.purgeTokens(ctx, now)
+}
+
+// Сначала удаляем истекшие токены, затем сессии, у которых токенов не осталось
+func (s *CleanupService) purgeTokens(ctx context.Context, now time.Time) {
+	tokens, err := drainBatches(ctx, func(ctx context.Context) (int, error) {
+		return s.tokenRepo.PurgeExpiredTokens(ctx, now, cleanupBatchSize)
+	})
+	if err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "failed to purge refresh tokens", slog.Any("error", err))
+		return
+	}
+
+	families, err := drainBatches(ctx, func(ctx context.Context) (int, error) {
+		return s.tokenRepo.PurgeFamilies(ctx, now, cleanupBatchSize)
+	})
+	if err != nil && ctx.Err() == nil {
+		slog.ErrorContext(ctx, "failed to purge sessions", slog.Any("error", err))
+	}
+
+	if tokens > 0 || families > 0 {
+		slog.InfoContext(ctx, "purged refresh tokens",
+			slog.Int("tokens", tokens),
+			slog.Int("sessions", families),
+		)
+	}
+}
+
+// Повторяем пачку, пока она заполняется целиком. Возвращает сколько записей обработано всего
+func drainBatches(ctx context.Context, batch func(ctx context.Context) (int, error)) (int, error) {
+	var total int
+
+	for ctx.Err() == nil {
+		processed, err := batch(ctx)
+		total += processed
+
+		if err != nil || processed < cleanupBatchSize {
+			return total, err
+		}
+	}
+
+	return total, nil
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanup(t *testing.T) {
+	balanceRepo := &repository.TestBalanceRepository{Stale: cleanupBatchSize*2 + 1}
+	idempotencyRepo := repository.NewTestIdempotencyRepository()
+	tokenRepo := repository.NewTestTokenRepository()
+	cleanup := NewCleanupService(balanceRepo, idempotencyRepo, tokenRepo)
+
+	now := time.Now()
+	revokedAt := now.Add(-time.Minute)
+
+	sessions := []struct {
+		family    model.TokenFamily
+		expiresAt time.Time
+	}{
+		{model.TokenFamily{ID: "active", UserID: 111, CreatedAt: now.Add(-time.Hour)}, now.Add(time.Hour)},
+		{model.TokenFamily{ID: "expired", UserID: 111, CreatedAt: now.Add(-time.Hour)}, now.Add(-time.Minute)},
+		{model.TokenFamily{ID: "revoked", UserID: 111, CreatedAt: now.Add(-time.Hour), RevokedAt: &revokedAt}, now.Add(time.Hour)},
+	}
+
+	for _, session := range sessions {
+		err := tokenRepo.CreateFamily(context.Background(), session.family, model.RefreshToken{
+			FamilyID:  session.family.ID,
+			TokenHash: session.family.ID,
+			ExpiresAt: session.expiresAt,
+		})
+		assert.NoError(t, err)
+	}
+
+	for i := 0; i < cleanupBatchSize+1; i++ {
+		_, _, err := idempotencyRepo.Reserve(context.Background(), model.IdempotencyKey{
+			UserID:    111,
+			Key:       fmt.Sprintf("expired_%d", i),
+			CreatedAt: time.Now().Add(-IdempotencyKeyTTL - time.Minute),
+		}, time.Now())
+		assert.NoError(t, err)
+	}
+
+	_, _, err := idempotencyRepo.Reserve(context.Background(), model.IdempotencyKey{
+		UserID:    111,
+		Key:       "fresh",
+		CreatedAt: time.Now(),
+	}, time.Now())
+	assert.NoError(t, err)
+
+	cleanup.cleanup(context.Background())
+
+	// Зависшие списания отменяются за несколько пачек
+	assert.Zero(t, balanceRepo.Stale)
+	assert.WithinDuration(t, now.Add(-WithdrawalHoldTTL), balanceRepo.StaleBefore, time.Second)
+
+	// Устаревшие ключи идемпотентности удалены, свежий остался
+	_, ok := idempotencyRepo.Get("expired_0")
+	assert.False(t, ok)
+
+	_, ok = idempotencyRepo.Get("fresh")
+	assert.True(t, ok)
+
+	// Сессии с истекшими токенами и отозванные удалены, активная осталась
+	assert.True(t, tokenRepo.HasFamily("active"))
+	assert.False(t, tokenRepo.HasFamily("expired"))
+	assert.False(t, tokenRepo.HasFamily("revoked"))
+}
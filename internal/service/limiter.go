@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Пауза по умолчанию, если accrual не прислал заголовок Retry-After
+const DefaultRetryAfter = time.Minute
+
+var accrualLimitRe = regexp.MustCompile(`No more than (\d+) requests per minute allowed`)
+
+// Общий для всех воркеров ограничитель запросов к accrual.
+// После ответа 429 приостанавливает все запросы на время из Retry-After
+// и равномерно распределяет запросы согласно лимиту из тела ответа.
+type accrualLimiter struct {
+	mu          sync.Mutex
+	pausedUntil time.Time
+	nextSlot    time.Time
+	interval    time.Duration
+}
+
+func newAccrualLimiter() *accrualLimiter {
+	return &accrualLimiter{}
+}
+
+// Ждем, пока можно будет отправить очередной запрос
+func (l *accrualLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+
+	now := time.Now()
+	start := now
+
+	if l.pausedUntil.After(start) {
+		start = l.pausedUntil
+	}
+
+	if l.interval > 0 {
+		if l.nextSlot.After(start) {
+			start = l.nextSlot
+		}
+		l.nextSlot = start.Add(l.interval)
+	}
+
+	l.mu.Unlock()
+
+	delay := start.Sub(now)
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Приостанавливаем все запросы на указанное время
+func (l *accrualLimiter) Pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.pausedUntil) {
+		l.pausedUntil = until
+	}
+}
+
+// Устанавливаем лимит запросов в минуту
+func (l *accrualLimiter) SetLimit(perMinute int) {
+	if perMinute <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.interval = time.Minute / time.Duration(perMinute)
+}
+
+// Разбираем заголовок Retry-After: количество секунд или дата
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if len(header) == 0 {
+		return DefaultRetryAfter
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil {
+		if d := date.Sub(now); d > 0 {
+			return d
+		}
+		return 0
+	}
+
+	return DefaultRetryAfter
+}
+
+// Достаем лимит запросов в минуту из тела ответа 429
+func parseRequestLimit(body string) (int, bool) {
+	matches := accrualLimitRe.FindStringSubmatch(body)
+	if len(matches) != 2 {
+		return 0, false
+	}
+
+	limit, err := strconv.Atoi(matches[1])
+	if err != nil || limit <= 0 {
+		return 0, false
+	}
+
+	return limit, true
+}
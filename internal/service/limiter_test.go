@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{
+			name:   "seconds",
+			header: "60",
+			want:   time.Minute,
+		},
+		{
+			name:   "http date",
+			header: now.Add(30 * time.Second).Format(http.TimeFormat),
+			want:   30 * time.Second,
+		},
+		{
+			name:   "empty header",
+			header: "",
+			want:   DefaultRetryAfter,
+		},
+		{
+			name:   "invalid header",
+			header: "soon",
+			want:   DefaultRetryAfter,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, parseRetryAfter(tt.header, now))
+		})
+	}
+}
+
+func TestParseRequestLimit(t *testing.T) {
+	limit, ok := parseRequestLimit("No more than 15 requests per minute allowed")
+	assert.True(t, ok)
+	assert.Equal(t, 15, limit)
+
+	_, ok = parseRequestLimit("Too Many Requests")
+	assert.False(t, ok)
+}
+
+func TestAccrualLimiter(t *testing.T) {
+	t.Run("no limit", func(t *testing.T) {
+		l := newAccrualLimiter()
+
+		start := time.Now()
+		for i := 0; i < 10; i++ {
+			assert.NoError(t, l.Wait(context.Background()))
+		}
+
+		assert.Less(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("pause", func(t *testing.T) {
+		l := newAccrualLimiter()
+		l.Pause(50 * time.Millisecond)
+
+		start := time.Now()
+		assert.NoError(t, l.Wait(context.Background()))
+		assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+
+	t.Run("limit spreads requests", func(t *testing.T) {
+		l := newAccrualLimiter()
+		l.SetLimit(60 * 50) // один запрос каждые 20мс
+
+		start := time.Now()
+		for i := 0; i < 4; i++ {
+			assert.NoError(t, l.Wait(context.Background()))
+		}
+
+		assert.GreaterOrEqual(t, time.Since(start), 60*time.Millisecond)
+	})
+
+	t.Run("context cancel", func(t *testing.T) {
+		l := newAccrualLimiter()
+		l.Pause(time.Hour)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		assert.ErrorIs(t, l.Wait(ctx), context.Canceled)
+	})
+}
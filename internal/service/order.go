@@ -4,16 +4,23 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"slices"
 
 	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/repository"
 	"github.com/Sadere/gophermart/internal/utils"
 )
 
+// Максимальное количество номеров в одной пачке загрузки
+const MaxOrderBatchSize = 100
+
 var (
 	ErrOrderExists        = errors.New("order is already loaded by another user")
 	ErrOrderInvalidNumber = errors.New("invalid order number")
 	ErrOrdersNotAdded     = errors.New("no orders added yet")
+	ErrOrderBatchEmpty    = errors.New("no order numbers supplied")
+	ErrOrderBatchTooLarge = fmt.Errorf("no more than %d order numbers allowed in one batch", MaxOrderBatchSize)
 )
 
 type OrderService struct {
@@ -27,7 +34,7 @@ func NewOrderService(orderRepo repository.OrderRepository) *OrderService {
 }
 
 // Загружаем номер заказа в систему, возвращет true, если пользователь уже загрузил заказ
-func (s *OrderService) SaveOrderForUser(userID uint64, number string) (bool, error) {
+func (s *OrderService) SaveOrderForUser(ctx context.Context, userID uint64, number string) (bool, error) {
 	// Проверяем номер заказа
 	validNumber := utils.CheckLuhn(number)
 
@@ -35,48 +42,156 @@ func (s *OrderService) SaveOrderForUser(userID uint64, number string) (bool, err
 		return false, ErrOrderInvalidNumber
 	}
 
-	// Проверяем загружен ли заказ с таким номером
-	order, err := s.orderRepo.GetOrderByNumber(context.Background(), number)
+	// Добавляем заказ, если он еще не загружен. Проверка и вставка
+	// выполняются одним запросом, поэтому параллельные загрузки не конфликтуют
+	order, inserted, err := s.orderRepo.Create(ctx, model.Order{
+		UserID: userID,
+		Number: number,
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	if inserted {
+		return false, nil
+	}
 
-	// Если заказ не найден, пытаемся его добавить
-	if errors.Is(err, sql.ErrNoRows) {
-		_, err := s.orderRepo.Create(context.Background(), model.Order{
+	// Проверяем кем был загружен заказ
+	if order.UserID != userID {
+		return true, ErrOrderExists
+	}
+
+	return true, nil
+}
+
+// Загружаем пачку номеров заказов одной транзакцией и возвращаем
+// результат по каждому номеру в порядке загрузки
+func (s *OrderService) SaveOrdersForUser(ctx context.Context, userID uint64, numbers []string) ([]model.OrderUploadResult, error) {
+	if len(numbers) == 0 {
+		return nil, ErrOrderBatchEmpty
+	}
+
+	if len(numbers) > MaxOrderBatchSize {
+		return nil, ErrOrderBatchTooLarge
+	}
+
+	// Сохраняем валидные номера без повторов в порядке возрастания
+	var validNumbers []string
+	for _, number := range numbers {
+		if validOrderNumber(number) {
+			validNumbers = append(validNumbers, number)
+		}
+	}
+	slices.Sort(validNumbers)
+	validNumbers = slices.Compact(validNumbers)
+
+	orders := make([]model.Order, 0, len(validNumbers))
+	for _, number := range validNumbers {
+		orders = append(orders, model.Order{
 			UserID: userID,
 			Number: number,
 		})
+	}
 
+	statuses := make(map[string]model.OrderUploadStatus, len(orders))
+
+	if len(orders) > 0 {
+		stored, err := s.orderRepo.CreateBatch(ctx, orders)
 		if err != nil {
-			return false, err
+			return nil, err
 		}
 
-		return false, nil
+		for i, order := range stored {
+			number := orders[i].Number
+
+			switch {
+			case order.Inserted:
+				statuses[number] = model.OrderUploadAccepted
+			case order.UserID != userID:
+				statuses[number] = model.OrderUploadOwnedByAnother
+			default:
+				statuses[number] = model.OrderUploadAlreadyUploaded
+			}
+		}
+	}
+
+	results := make([]model.OrderUploadResult, 0, len(numbers))
+	accepted := make(map[string]bool, len(orders))
+
+	for _, number := range numbers {
+		status, ok := statuses[number]
+		if !ok {
+			status = model.OrderUploadInvalid
+		}
+
+		// Повтор номера внутри пачки считается уже загруженным
+		if status == model.OrderUploadAccepted {
+			if accepted[number] {
+				status = model.OrderUploadAlreadyUploaded
+			}
+			accepted[number] = true
+		}
+
+		results = append(results, model.OrderUploadResult{
+			Number: number,
+			Status: status,
+		})
+	}
+
+	return results, nil
+}
+
+func validOrderNumber(number string) bool {
+	return len(number) > 0 && utils.CheckOnlyDigits(number) == nil && utils.CheckLuhn(number)
+}
+
+// Заказ пользователя с историей обработки. Чужой заказ не отличаем от несуществующего
+func (s *OrderService) GetOrderForUser(ctx context.Context, userID uint64, number string) (model.OrderDetails, error) {
+	var details model.OrderDetails
+
+	order, err := s.orderRepo.GetOrderByNumber(ctx, number)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && order.UserID != userID) {
+		return details, ErrOrderNotFound
 	}
 
-	// Другие ошибки
 	if err != nil {
-		return false, err
+		return details, err
 	}
 
-	// Проверяем кем был загружен заказ
-	if order.UserID != userID {
-		return true, ErrOrderExists
+	events, err := s.orderRepo.GetOrderEvents(ctx, order.ID)
+	if err != nil {
+		return details, err
 	}
 
-	return true, nil
+	details.Order = order
+	details.Events = events
+
+	if details.Events == nil {
+		details.Events = []model.OrderEvent{}
+	}
+
+	return details, nil
 }
 
-func (s *OrderService) GetOrdersByUser(userID uint64) ([]model.Order, error) {
-	orders, err := s.orderRepo.GetOrdersByUser(context.Background(), userID)
+// Заказы пользователя по фильтру постранично.
+// Возвращает курсор следующей страницы или 0, если страница последняя
+func (s *OrderService) GetOrdersByUser(ctx context.Context, filter model.OrderFilter) ([]model.Order, uint64, error) {
+	limit := filter.Limit
+	filter.Limit = pageFetchLimit(limit)
+
+	orders, err := s.orderRepo.GetOrdersByUser(ctx, filter)
+
+	if err != nil {
+		return nil, 0, err
+	}
 
 	// Если не нашли заказы, отдаем ошибку
 	if len(orders) == 0 {
-		return nil, ErrOrdersNotAdded
+		return nil, 0, ErrOrdersNotAdded
 	}
 
-	// Остальные ошибки
-	if err != nil {
-		return nil, err
-	}
+	orders, nextCursor := paginate(orders, limit, func(order model.Order) uint64 { return order.ID })
 
-	return orders, nil
+	return orders, nextCursor, nil
 }
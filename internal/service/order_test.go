@@ -1,8 +1,10 @@
 package service
 
 import (
+	"context"
 	"testing"
 
+	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/repository"
 	"github.com/stretchr/testify/assert"
 )
@@ -80,7 +82,7 @@ func TestSaveOrderForUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			exists, err := orderService.SaveOrderForUser(tt.userID, tt.number)
+			exists, err := orderService.SaveOrderForUser(context.Background(), tt.userID, tt.number)
 
 			if tt.want.exists {
 				assert.True(t, exists)
@@ -97,6 +99,48 @@ func TestSaveOrderForUser(t *testing.T) {
 	}
 }
 
+func TestSaveOrdersForUser(t *testing.T) {
+	repo := &repository.TestOrderRepository{}
+	orderService := NewOrderService(repo)
+
+	t.Run("per number results", func(t *testing.T) {
+		results, err := orderService.SaveOrdersForUser(context.Background(), 111, []string{"84913", "56317", "24844", "54362", "", "84913"})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []model.OrderUploadResult{
+			{Number: "84913", Status: model.OrderUploadAccepted},
+			{Number: "56317", Status: model.OrderUploadAlreadyUploaded},
+			{Number: "24844", Status: model.OrderUploadOwnedByAnother},
+			{Number: "54362", Status: model.OrderUploadInvalid},
+			{Number: "", Status: model.OrderUploadInvalid},
+			{Number: "84913", Status: model.OrderUploadAlreadyUploaded},
+		}, results)
+	})
+
+	t.Run("only invalid numbers", func(t *testing.T) {
+		results, err := orderService.SaveOrdersForUser(context.Background(), 111, []string{"54362"})
+		assert.NoError(t, err)
+
+		assert.Equal(t, []model.OrderUploadResult{{Number: "54362", Status: model.OrderUploadInvalid}}, results)
+	})
+
+	t.Run("empty batch", func(t *testing.T) {
+		_, err := orderService.SaveOrdersForUser(context.Background(), 111, nil)
+		assert.ErrorIs(t, err, ErrOrderBatchEmpty)
+	})
+
+	t.Run("batch too large", func(t *testing.T) {
+		numbers := make([]string, MaxOrderBatchSize+1)
+		_, err := orderService.SaveOrdersForUser(context.Background(), 111, numbers)
+		assert.ErrorIs(t, err, ErrOrderBatchTooLarge)
+	})
+
+	t.Run("repository error", func(t *testing.T) {
+		_, err := orderService.SaveOrdersForUser(context.Background(), 111, []string{"84913", "27078"})
+		assert.Error(t, err)
+	})
+}
+
 func TestGetOrdersByUser(t *testing.T) {
 	repo := &repository.TestOrderRepository{}
 	orderService := NewOrderService(repo)
@@ -139,7 +183,7 @@ func TestGetOrdersByUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			orders, err := orderService.GetOrdersByUser(tt.userID)
+			orders, _, err := orderService.GetOrdersByUser(context.Background(), model.OrderFilter{UserID: tt.userID})
 
 			assert.Len(t, orders, tt.want.len)
 
@@ -151,3 +195,78 @@ func TestGetOrdersByUser(t *testing.T) {
 		})
 	}
 }
+
+func TestGetOrdersByUserPage(t *testing.T) {
+	repo := &repository.TestOrderRepository{}
+	orderService := NewOrderService(repo)
+
+	type want struct {
+		ids        []uint64
+		nextCursor uint64
+	}
+
+	tests := []struct {
+		name   string
+		filter model.OrderFilter
+		want   want
+	}{
+		{
+			name: "first page",
+			filter: model.OrderFilter{
+				UserID: 666,
+				Page:   model.Page{Limit: 2},
+			},
+			want: want{
+				ids:        []uint64{1, 2},
+				nextCursor: 2,
+			},
+		},
+		{
+			name: "next page",
+			filter: model.OrderFilter{
+				UserID: 666,
+				Page:   model.Page{Limit: 2, Cursor: 2},
+			},
+			want: want{
+				ids: []uint64{3},
+			},
+		},
+		{
+			name: "descending",
+			filter: model.OrderFilter{
+				UserID: 666,
+				Page:   model.Page{Limit: 2, Sort: model.SortDesc},
+			},
+			want: want{
+				ids:        []uint64{3, 2},
+				nextCursor: 2,
+			},
+		},
+		{
+			name: "by status",
+			filter: model.OrderFilter{
+				UserID:   666,
+				Statuses: []model.OrderStatus{model.OrderProcessed},
+				Page:     model.Page{Limit: 2},
+			},
+			want: want{
+				ids: []uint64{1, 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			orders, nextCursor, err := orderService.GetOrdersByUser(context.Background(), tt.filter)
+			assert.NoError(t, err)
+
+			var ids []uint64
+			for _, order := range orders {
+				ids = append(ids, order.ID)
+			}
+
+			assert.Equal(t, tt.want.ids, ids)
+			assert.Equal(t, tt.want.nextCursor, nextCursor)
+		})
+	}
+}
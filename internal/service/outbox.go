@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+)
+
+const (
+	// Сколько событий outbox публикуем за один раз
+	outboxBatchSize = 500
+
+	// Сколько храним опубликованные события, чтобы при разборе сбоев их можно было переиграть
+	outboxRetention = 7 * 24 * time.Hour
+
+	// Как часто удаляем старые опубликованные события и сколько за один запрос
+	outboxPurgeInterval  = time.Hour
+	outboxPurgeBatchSize = 1000
+)
+
+// Приемник доменных событий, реализации в пакете outbox
+type EventPublisher interface {
+	Publish(ctx context.Context, events []model.DomainEvent) error
+}
+
+// Переносим события из outbox в приемник. Доставка не реже одного раза:
+// после сбоя между публикацией и отметкой в базе пачка публикуется повторно,
+// получатели отбрасывают повторы по id события
+type OutboxRelay struct {
+	outboxRepo repository.OutboxRepository
+	publisher  EventPublisher
+	interval   time.Duration
+	lastPurge  time.Time
+}
+
+func NewOutboxRelay(outboxRepo repository.OutboxRepository, publisher EventPublisher, interval time.Duration) *OutboxRelay {
+	return &OutboxRelay{
+		outboxRepo: outboxRepo,
+		publisher:  publisher,
+		interval:   interval,
+	}
+}
+
+// Публикуем события до отмены контекста
+func (r *OutboxRelay) Run(ctx context.Context) {
+	for {
+		if err := r.relay(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "failed to publish events", slog.Any("error", err))
+		}
+
+		if time.Since(r.lastPurge) >= outboxPurgeInterval {
+			if err := r.purge(ctx); err != nil && ctx.Err() == nil {
+				slog.ErrorContext(ctx, "failed to purge published events", slog.Any("error", err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("outbox relay stopped")
+			return
+		case <-time.After(r.interval):
+		}
+	}
+}
+
+// Публикуем пачки, пока outbox не опустеет
+func (r *OutboxRelay) relay(ctx context.Context) error {
+	for ctx.Err() == nil {
+		published, err := r.outboxRepo.PublishPending(ctx, outboxBatchSize, r.publisher.Publish)
+		if err != nil {
+			return err
+		}
+
+		if published < outboxBatchSize {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Удаляем опубликованные события старше outboxRetention пачками
+func (r *OutboxRelay) purge(ctx context.Context) error {
+	r.lastPurge = time.Now()
+	publishedBefore := r.lastPurge.Add(-outboxRetention)
+
+	for ctx.Err() == nil {
+		purged, err := r.outboxRepo.PurgePublished(ctx, publishedBefore, outboxPurgeBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if purged > 0 {
+			slog.InfoContext(ctx, "purged published events", slog.Int("count", purged))
+		}
+
+		if purged < outboxPurgeBatchSize {
+			return nil
+		}
+	}
+
+	return nil
+}
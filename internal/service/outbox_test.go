@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/stretchr/testify/assert"
+)
+
+type testPublisher struct {
+	fail      bool
+	published []model.DomainEvent
+}
+
+func (p *testPublisher) Publish(ctx context.Context, events []model.DomainEvent) error {
+	if p.fail {
+		return errors.New("sink is down")
+	}
+
+	p.published = append(p.published, events...)
+
+	return nil
+}
+
+func TestOutboxRelay(t *testing.T) {
+	newEvents := func(count int) []model.DomainEvent {
+		events := make([]model.DomainEvent, 0, count)
+		for i := 1; i <= count; i++ {
+			events = append(events, model.DomainEvent{ID: uint64(i), Type: model.EventBalanceChanged})
+		}
+		return events
+	}
+
+	t.Run("drains outbox in order", func(t *testing.T) {
+		outboxRepo := &repository.TestOutboxRepository{Events: newEvents(outboxBatchSize*2 + 1)}
+		publisher := &testPublisher{}
+
+		relay := NewOutboxRelay(outboxRepo, publisher, time.Second)
+
+		assert.NoError(t, relay.relay(context.Background()))
+		assert.Empty(t, outboxRepo.Events)
+
+		if assert.Len(t, publisher.published, outboxBatchSize*2+1) {
+			for i, event := range publisher.published {
+				assert.Equal(t, uint64(i+1), event.ID)
+			}
+		}
+	})
+
+	t.Run("keeps events when publisher fails", func(t *testing.T) {
+		outboxRepo := &repository.TestOutboxRepository{Events: newEvents(3)}
+		publisher := &testPublisher{fail: true}
+
+		relay := NewOutboxRelay(outboxRepo, publisher, time.Second)
+
+		assert.Error(t, relay.relay(context.Background()))
+		assert.Len(t, outboxRepo.Events, 3)
+	})
+}
+
+func TestOutboxRelayPurge(t *testing.T) {
+	now := time.Now()
+
+	var publishedAt []time.Time
+	for i := 0; i < outboxPurgeBatchSize+1; i++ {
+		publishedAt = append(publishedAt, now.Add(-outboxRetention-time.Hour))
+	}
+	publishedAt = append(publishedAt, now.Add(-time.Hour))
+
+	outboxRepo := &repository.TestOutboxRepository{PublishedAt: publishedAt}
+	relay := NewOutboxRelay(outboxRepo, &testPublisher{}, time.Second)
+
+	// Старые события удаляются за несколько пачек, свежие остаются
+	assert.NoError(t, relay.purge(context.Background()))
+	assert.Len(t, outboxRepo.PublishedAt, 1)
+	assert.WithinDuration(t, now, relay.lastPurge, time.Second)
+}
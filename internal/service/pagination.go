@@ -0,0 +1,23 @@
+package service
+
+// Репозиторий запрашивается на одну запись больше лимита, чтобы понять,
+// есть ли следующая страница. Отбрасываем лишнюю запись и возвращаем
+// курсор следующей страницы или 0, если страница последняя
+func paginate[T any](items []T, limit int, id func(T) uint64) ([]T, uint64) {
+	if limit <= 0 || len(items) <= limit {
+		return items, 0
+	}
+
+	items = items[:limit]
+
+	return items, id(items[len(items)-1])
+}
+
+// Лимит для запроса к репозиторию с учетом дополнительной записи
+func pageFetchLimit(limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+
+	return limit + 1
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/auth"
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+)
+
+// Размер случайной части refresh токена и идентификатора сессии в байтах
+const secureTokenSize = 32
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected, session revoked")
+)
+
+type TokenService struct {
+	tokenRepo  repository.TokenRepository
+	keys       *auth.KeySet
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenService(
+	tokenRepo repository.TokenRepository,
+	keys *auth.KeySet,
+	accessTTL time.Duration,
+	refreshTTL time.Duration,
+) *TokenService {
+	return &TokenService{
+		tokenRepo:  tokenRepo,
+		keys:       keys,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// Начинаем новую сессию пользователя: выдаем access токен и первый refresh токен семейства
+func (s *TokenService) IssueTokens(ctx context.Context, userID uint64) (model.TokenPair, error) {
+	var pair model.TokenPair
+
+	familyID, err := auth.GenerateSecureToken(secureTokenSize)
+	if err != nil {
+		return pair, err
+	}
+
+	refreshToken, refreshRecord, err := s.newRefreshToken(familyID)
+	if err != nil {
+		return pair, err
+	}
+
+	family := model.TokenFamily{
+		ID:        familyID,
+		UserID:    userID,
+		CreatedAt: refreshRecord.CreatedAt,
+	}
+
+	err = s.tokenRepo.CreateFamily(ctx, family, refreshRecord)
+	if err != nil {
+		return pair, err
+	}
+
+	return s.tokenPair(userID, familyID, refreshToken)
+}
+
+// Обмениваем refresh токен на новую пару токенов. Повторное использование
+// refresh токена означает его утечку, поэтому в этом случае отзываем всю сессию
+func (s *TokenService) RefreshTokens(ctx context.Context, refreshToken string) (model.TokenPair, error) {
+	var pair model.TokenPair
+
+	stored, err := s.tokenRepo.GetRefreshToken(ctx, auth.HashToken(refreshToken))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return pair, ErrInvalidRefreshToken
+	}
+
+	if err != nil {
+		return pair, err
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return pair, ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil {
+		return pair, s.revokeReused(ctx, stored.FamilyID)
+	}
+
+	nextToken, nextRecord, err := s.newRefreshToken(stored.FamilyID)
+	if err != nil {
+		return pair, err
+	}
+
+	err = s.tokenRepo.RotateRefreshToken(ctx, stored.ID, nextRecord)
+
+	// Токен успели использовать параллельно
+	if errors.Is(err, repository.ErrRefreshTokenUsed) {
+		return pair, s.revokeReused(ctx, stored.FamilyID)
+	}
+
+	if err != nil {
+		return pair, err
+	}
+
+	return s.tokenPair(stored.UserID, stored.FamilyID, nextToken)
+}
+
+// Завершаем сессию: отзываем семейство refresh токенов и связанные access токены
+func (s *TokenService) Logout(ctx context.Context, sessionID string) error {
+	return s.tokenRepo.RevokeFamily(ctx, sessionID)
+}
+
+func (s *TokenService) revokeReused(ctx context.Context, familyID string) error {
+	if err := s.tokenRepo.RevokeFamily(ctx, familyID); err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReused
+}
+
+// Новый refresh токен и запись о нем для хранения в БД
+func (s *TokenService) newRefreshToken(familyID string) (string, model.RefreshToken, error) {
+	token, err := auth.GenerateSecureToken(secureTokenSize)
+	if err != nil {
+		return "", model.RefreshToken{}, err
+	}
+
+	now := time.Now()
+
+	return token, model.RefreshToken{
+		FamilyID:  familyID,
+		TokenHash: auth.HashToken(token),
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.refreshTTL),
+	}, nil
+}
+
+func (s *TokenService) tokenPair(userID uint64, familyID string, refreshToken string) (model.TokenPair, error) {
+	accessToken, err := auth.CreateToken(userID, familyID, time.Now().Add(s.accessTTL), s.keys)
+	if err != nil {
+		return model.TokenPair{}, err
+	}
+
+	return model.TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+	}, nil
+}
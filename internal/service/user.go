@@ -10,6 +10,7 @@ import (
 	"github.com/Sadere/gophermart/internal/auth"
 	"github.com/Sadere/gophermart/internal/model"
 	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/Sadere/gophermart/internal/tracing"
 )
 
 type ErrUserExists struct {
@@ -42,9 +43,9 @@ func NewUserService(userRepo repository.UserRepository) *UserService {
 	}
 }
 
-func (s *UserService) RegisterUser(login string, password string) (model.User, error) {
+func (s *UserService) RegisterUser(ctx context.Context, login string, password string) (model.User, error) {
 	var newUser model.User
-	user, err := s.userRepo.GetUserByLogin(context.Background(), login)
+	user, err := s.userRepo.GetUserByLogin(ctx, login)
 
 	// Проверяем существует ли пользователь с таким логином
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
@@ -55,8 +56,11 @@ func (s *UserService) RegisterUser(login string, password string) (model.User, e
 		return newUser, &ErrUserExists{Login: login}
 	}
 
-	// Хешируем пароль
+	// Хешируем пароль, bcrypt намеренно медленный - выделяем его в отдельный спан
+	_, span := tracing.Tracer().Start(ctx, "bcrypt.hash")
 	passwordHash, err := auth.HashPassword(password)
+	tracing.EndSpan(span, err)
+
 	if err != nil {
 		return newUser, errors.New("failed to generate password hash")
 	}
@@ -69,7 +73,12 @@ func (s *UserService) RegisterUser(login string, password string) (model.User, e
 	}
 
 	var newUserID uint64
-	newUserID, err = s.userRepo.Create(context.Background(), newUser)
+	newUserID, err = s.userRepo.Create(ctx, newUser)
+
+	// Логин успели занять параллельной регистрацией
+	if errors.Is(err, repository.ErrUserExists) {
+		return newUser, &ErrUserExists{Login: login}
+	}
 
 	if err != nil {
 		return newUser, errors.New("failed to create user")
@@ -80,8 +89,8 @@ func (s *UserService) RegisterUser(login string, password string) (model.User, e
 	return newUser, nil
 }
 
-func (s *UserService) LoginUser(login string, password string) (model.User, error) {
-	user, err := s.userRepo.GetUserByLogin(context.Background(), login)
+func (s *UserService) LoginUser(ctx context.Context, login string, password string) (model.User, error) {
+	user, err := s.userRepo.GetUserByLogin(ctx, login)
 
 	if errors.Is(err, sql.ErrNoRows) {
 		return user, ErrBadCredentials
@@ -91,7 +100,11 @@ func (s *UserService) LoginUser(login string, password string) (model.User, erro
 		return user, errors.New("failed to authenticate user")
 	}
 
-	if !auth.CheckPassword(user.PasswordHash, password) {
+	_, span := tracing.Tracer().Start(ctx, "bcrypt.compare")
+	passwordValid := auth.CheckPassword(user.PasswordHash, password)
+	span.End()
+
+	if !passwordValid {
 		return user, ErrBadCredentials
 	}
 
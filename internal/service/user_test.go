@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"strings"
@@ -110,11 +111,20 @@ func TestRegisterUser(t *testing.T) {
 				err:  true,
 			},
 		},
+		{
+			name:     "login taken by concurrent registration",
+			login:    "concurrent_user",
+			password: "test_pw",
+			want: want{
+				user: model.User{Login: "concurrent_user"},
+				err:  true,
+			},
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			resUser, err := userService.RegisterUser(tt.login, tt.password)
+			resUser, err := userService.RegisterUser(context.Background(), tt.login, tt.password)
 
 			assert.Equal(t, tt.want.user.ID, resUser.ID)
 			assert.Equal(t, tt.want.user.Login, resUser.Login)
@@ -196,7 +206,7 @@ func TestLoginUser(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			resUser, err := userService.LoginUser(tt.login, tt.password)
+			resUser, err := userService.LoginUser(context.Background(), tt.login, tt.password)
 
 			assert.Equal(t, tt.want.user.ID, resUser.ID)
 			assert.Equal(t, tt.want.user.Login, resUser.Login)
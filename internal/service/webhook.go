@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/Sadere/gophermart/internal/structs"
+)
+
+// Сколько webhook может зарегистрировать один пользователь
+const MaxUserWebhooks = 10
+
+var (
+	ErrWebhookInvalidURL   = errors.New("webhook url must be an absolute http or https url")
+	ErrWebhookInvalidEvent = errors.New("unknown webhook event")
+	ErrWebhookNotFound     = errors.New("webhook not found")
+	ErrWebhookLimit        = fmt.Errorf("no more than %d webhooks allowed", MaxUserWebhooks)
+)
+
+type WebhookService struct {
+	webhookRepo repository.WebhookRepository
+	resolver    hostResolver
+}
+
+func NewWebhookService(webhookRepo repository.WebhookRepository) *WebhookService {
+	return &WebhookService{
+		webhookRepo: webhookRepo,
+		resolver:    net.DefaultResolver,
+	}
+}
+
+// Регистрируем webhook пользователя. Без списка событий подписываем на все события.
+// Возвращает webhook вместе с секретом для проверки подписи
+func (s *WebhookService) CreateWebhook(ctx context.Context, userID uint64, rawURL string, events []model.WebhookEventType) (model.Webhook, error) {
+	var webhook model.Webhook
+
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || len(target.Host) == 0 {
+		return webhook, ErrWebhookInvalidURL
+	}
+
+	if err := checkWebhookHost(ctx, s.resolver, target.Hostname()); err != nil {
+		return webhook, err
+	}
+
+	if len(events) == 0 {
+		events = model.WebhookEventTypes
+	}
+
+	var subscribed model.WebhookEvents
+	for _, event := range events {
+		if !slices.Contains(model.WebhookEventTypes, event) {
+			return webhook, fmt.Errorf("%w: %s", ErrWebhookInvalidEvent, event)
+		}
+
+		if !slices.Contains(subscribed, event) {
+			subscribed = append(subscribed, event)
+		}
+	}
+
+	webhooks, err := s.webhookRepo.GetUserWebhooks(ctx, userID)
+	if err != nil {
+		return webhook, err
+	}
+
+	if len(webhooks) >= MaxUserWebhooks {
+		return webhook, ErrWebhookLimit
+	}
+
+	secret, err := newWebhookSecret()
+	if err != nil {
+		return webhook, err
+	}
+
+	return s.webhookRepo.Create(ctx, model.Webhook{
+		UserID:    userID,
+		URL:       target.String(),
+		Secret:    secret,
+		Events:    subscribed,
+		CreatedAt: structs.RFCTime{Time: time.Now()},
+	})
+}
+
+func (s *WebhookService) ListWebhooks(ctx context.Context, userID uint64) ([]model.Webhook, error) {
+	webhooks, err := s.webhookRepo.GetUserWebhooks(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if webhooks == nil {
+		webhooks = []model.Webhook{}
+	}
+
+	return webhooks, nil
+}
+
+func (s *WebhookService) DeleteWebhook(ctx context.Context, userID uint64, webhookID uint64) error {
+	err := s.webhookRepo.Delete(ctx, userID, webhookID)
+
+	if errors.Is(err, repository.ErrWebhookNotFound) {
+		return ErrWebhookNotFound
+	}
+
+	return err
+}
+
+// События, которые так и не удалось доставить, постранично.
+// Возвращает курсор следующей страницы или 0, если страница последняя
+func (s *WebhookService) ListDeadDeliveries(ctx context.Context, userID uint64, page model.Page) ([]model.WebhookDelivery, uint64, error) {
+	limit := page.Limit
+	page.Limit = pageFetchLimit(limit)
+
+	deliveries, err := s.webhookRepo.GetDeadDeliveries(ctx, userID, page)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if deliveries == nil {
+		deliveries = []model.WebhookDelivery{}
+	}
+
+	deliveries, nextCursor := paginate(deliveries, limit, func(d model.WebhookDelivery) uint64 { return d.ID })
+
+	return deliveries, nextCursor, nil
+}
+
+func newWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
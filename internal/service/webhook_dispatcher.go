@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/go-resty/resty/v2"
+)
+
+// Заголовки запроса с событием
+const (
+	WebhookEventHeader     = "X-Gophermart-Event"
+	WebhookDeliveryHeader  = "X-Gophermart-Delivery"
+	WebhookSignatureHeader = "X-Gophermart-Signature"
+)
+
+const (
+	// Сколько доставок захватываем за один цикл
+	webhookBatchSize = 100
+
+	// Сколько доставок отправляем одновременно
+	webhookWorkers = 4
+
+	// Сколько ждем ответа получателя
+	webhookTimeout = 10 * time.Second
+
+	// На сколько реплика захватывает доставки, должно быть больше времени ответа
+	webhookLease = time.Minute
+)
+
+// Фоновая доставка событий из outbox на webhook пользователей
+type WebhookDispatcher struct {
+	webhookRepo repository.WebhookRepository
+	interval    time.Duration
+	maxAttempts uint
+	client      *resty.Client
+}
+
+func NewWebhookDispatcher(
+	webhookRepo repository.WebhookRepository,
+	interval time.Duration,
+	maxAttempts uint,
+) *WebhookDispatcher {
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	return &WebhookDispatcher{
+		webhookRepo: webhookRepo,
+		interval:    interval,
+		maxAttempts: maxAttempts,
+		client:      resty.New().SetTimeout(webhookTimeout).SetTransport(newWebhookTransport()),
+	}
+}
+
+// Доставляем события до отмены контекста, начатые доставки завершаются
+func (d *WebhookDispatcher) Run(ctx context.Context) {
+	for {
+		d.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			slog.Info("webhook dispatcher stopped")
+			return
+		case <-time.After(d.interval):
+		}
+	}
+}
+
+func (d *WebhookDispatcher) dispatch(ctx context.Context) {
+	claimCtx, cancel := context.WithTimeout(ctx, time.Duration(time.Second*5))
+	defer cancel()
+
+	lockedUntil := time.Now().Add(webhookLease).Truncate(time.Microsecond)
+
+	deliveries, err := d.webhookRepo.ClaimDueDeliveries(claimCtx, lockedUntil, webhookBatchSize)
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.ErrorContext(ctx, "failed to claim webhook deliveries", slog.Any("error", err))
+		}
+		return
+	}
+
+	// Результат сохраняем, даже если сервис уже останавливается
+	dbCtx := context.WithoutCancel(ctx)
+
+	sem := make(chan struct{}, webhookWorkers)
+	var wg sync.WaitGroup
+
+	for _, delivery := range deliveries {
+		sem <- struct{}{}
+
+		// После остановки новые доставки не начинаем, их заберет реплика после истечения захвата
+		if ctx.Err() != nil {
+			<-sem
+			break
+		}
+
+		wg.Add(1)
+
+		go func(delivery model.WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			// Начатую доставку не прерываем остановкой сервиса, ее ограничивает только свой таймаут
+			sendCtx, cancel := context.WithTimeout(dbCtx, webhookTimeout)
+			defer cancel()
+
+			delivery = d.deliver(sendCtx, delivery, time.Now())
+
+			if err := d.webhookRepo.UpdateDelivery(dbCtx, delivery); err != nil {
+				slog.ErrorContext(ctx, "failed to save webhook delivery", slog.Uint64("delivery", delivery.ID), slog.Any("error", err))
+			}
+		}(delivery)
+	}
+
+	wg.Wait()
+}
+
+// Отправляем событие и возвращаем доставку с результатом попытки: доставлена,
+// отложена с экспоненциальной задержкой или перенесена в недоставленные.
+// Отмена контекста попыткой не считается, доставка повторяется при следующем цикле
+func (d *WebhookDispatcher) deliver(ctx context.Context, delivery model.WebhookDelivery, now time.Time) model.WebhookDelivery {
+	err := d.send(ctx, delivery, now)
+	if errors.Is(err, context.Canceled) {
+		delivery.NextAttemptAt = now
+
+		return delivery
+	}
+
+	delivery.Attempts++
+
+	if err == nil {
+		delivery.Status = model.WebhookDeliveryDelivered
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+
+		return delivery
+	}
+
+	delivery.LastError = err.Error()
+
+	if delivery.Attempts >= d.maxAttempts {
+		delivery.Status = model.WebhookDeliveryDead
+		slog.WarnContext(ctx, "webhook delivery is dead",
+			slog.Uint64("delivery", delivery.ID),
+			slog.Uint64("attempts", uint64(delivery.Attempts)),
+			slog.Any("error", err),
+		)
+
+		return delivery
+	}
+
+	delivery.NextAttemptAt = now.Add(registerBackoff(d.interval, delivery.Attempts))
+
+	return delivery
+}
+
+func (d *WebhookDispatcher) send(ctx context.Context, delivery model.WebhookDelivery, now time.Time) error {
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	result, err := d.client.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetHeader(WebhookEventHeader, string(delivery.EventType)).
+		SetHeader(WebhookDeliveryHeader, strconv.FormatUint(delivery.ID, 10)).
+		SetHeader(WebhookSignatureHeader, SignWebhook(delivery.Secret, timestamp, delivery.Payload)).
+		SetBody([]byte(delivery.Payload)).
+		Post(delivery.URL)
+
+	if err != nil {
+		return err
+	}
+
+	if !result.IsSuccess() {
+		return fmt.Errorf("received code = %d", result.StatusCode())
+	}
+
+	return nil
+}
+
+// Подпись события: t=<unix время>,v1=<hex HMAC-SHA256 от "<unix время>.<тело>">.
+// Время входит в подпись, чтобы получатель мог отклонять старые повторы
+func SignWebhook(secret string, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	return fmt.Sprintf("t=%s,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+var (
+	ErrWebhookForbiddenURL     = errors.New("webhook url must point to a public address")
+	ErrWebhookForbiddenAddress = errors.New("webhook address is not public")
+)
+
+// Служебные диапазоны, которые не покрывают методы netip.Addr
+var reservedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// Адрес можно отдавать пользовательским webhook: не loopback, не частная сеть,
+// не link-local (в том числе metadata 169.254.169.254) и не служебные диапазоны
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsValid() ||
+		addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() {
+		return false
+	}
+
+	for _, prefix := range reservedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type hostResolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// Проверяем, что все адреса хоста публичные
+func checkWebhookHost(ctx context.Context, resolver hostResolver, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !publicAddr(addr) {
+			return ErrWebhookForbiddenURL
+		}
+		return nil
+	}
+
+	addrs, err := resolver.LookupNetIP(ctx, "ip", host)
+	if err != nil || len(addrs) == 0 {
+		return fmt.Errorf("%w: cannot resolve %s", ErrWebhookForbiddenURL, host)
+	}
+
+	for _, addr := range addrs {
+		if !publicAddr(addr) {
+			return ErrWebhookForbiddenURL
+		}
+	}
+
+	return nil
+}
+
+// Транспорт доставки проверяет адрес уже после резолва, непосредственно перед соединением,
+// чтобы DNS rebinding не обошел проверку при регистрации
+func newWebhookTransport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", ErrWebhookForbiddenAddress, address)
+			}
+
+			if !publicAddr(addrPort.Addr()) {
+				return fmt.Errorf("%w: %s", ErrWebhookForbiddenAddress, addrPort.Addr())
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Transport{
+		// Прокси из окружения не используем: соединение должно идти на проверенный адрес
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
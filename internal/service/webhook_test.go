@@ -0,0 +1,369 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Sadere/gophermart/internal/model"
+	"github.com/Sadere/gophermart/internal/repository"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Резолвер с фиксированными адресами вместо DNS
+type testResolver map[string][]netip.Addr
+
+func (r testResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+
+	return addrs, nil
+}
+
+func TestCreateWebhook(t *testing.T) {
+	webhookService := NewWebhookService(repository.NewTestWebhookRepository())
+	webhookService.resolver = testResolver{
+		"crm.example.com":    {netip.MustParseAddr("93.184.215.14")},
+		"intranet.local":     {netip.MustParseAddr("10.0.0.5")},
+		"rebind.example.com": {netip.MustParseAddr("93.184.215.14"), netip.MustParseAddr("127.0.0.1")},
+	}
+
+	tests := []struct {
+		name    string
+		userID  uint64
+		url     string
+		events  []model.WebhookEventType
+		want    model.WebhookEvents
+		wantErr error
+	}{
+		{
+			name:   "all events by default",
+			userID: 111,
+			url:    "https://crm.example.com/hooks",
+			want:   model.WebhookEvents(model.WebhookEventTypes),
+		},
+		{
+			name:   "selected events without repeats",
+			userID: 111,
+			url:    "http://crm.example.com/hooks",
+			events: []model.WebhookEventType{model.WebhookOrderProcessed, model.WebhookOrderProcessed},
+			want:   model.WebhookEvents{model.WebhookOrderProcessed},
+		},
+		{
+			name:    "relative url",
+			userID:  111,
+			url:     "/hooks",
+			wantErr: ErrWebhookInvalidURL,
+		},
+		{
+			name:    "unsupported scheme",
+			userID:  111,
+			url:     "ftp://crm.example.com/hooks",
+			wantErr: ErrWebhookInvalidURL,
+		},
+		{
+			name:    "loopback address",
+			userID:  111,
+			url:     "http://127.0.0.1:8080/hooks",
+			wantErr: ErrWebhookForbiddenURL,
+		},
+		{
+			name:    "ipv6 loopback",
+			userID:  111,
+			url:     "http://[::1]/hooks",
+			wantErr: ErrWebhookForbiddenURL,
+		},
+		{
+			name:    "private address",
+			userID:  111,
+			url:     "http://10.1.2.3/hooks",
+			wantErr: ErrWebhookForbiddenURL,
+		},
+		{
+			name:    "metadata address",
+			userID:  111,
+			url:     "http://169.254.169.254/latest/meta-data",
+			wantErr: ErrWebhookForbiddenURL,
+		},
+		{
+			name:    "ipv4 mapped loopback",
+			userID:  111,
+			url:     "http://[::ffff:127.0.0.1]/hooks",
+			wantErr: ErrWebhookForbiddenURL,
+		},
+		{
+			name:    "host resolves to private address",
+			userID:  111,
+			url:     "https://intranet.local/hooks",
+			wantErr: ErrWebhookForbiddenURL,
+		},
+		{
+			name:    "one of host addresses is loopback",
+			userID:  111,
+			url:     "https://rebind.example.com/hooks",
+			wantErr: ErrWebhookForbiddenURL,
+		},
+		{
+			name:    "unresolvable host",
+			userID:  111,
+			url:     "https://unknown.example.com/hooks",
+			wantErr: ErrWebhookForbiddenURL,
+		},
+		{
+			name:    "unknown event",
+			userID:  111,
+			url:     "https://crm.example.com/hooks",
+			events:  []model.WebhookEventType{"order.created"},
+			wantErr: ErrWebhookInvalidEvent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook, err := webhookService.CreateWebhook(context.Background(), tt.userID, tt.url, tt.events)
+
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, webhook.Events)
+			assert.Len(t, webhook.Secret, 64)
+		})
+	}
+
+	t.Run("webhook limit", func(t *testing.T) {
+		for i := 0; i < MaxUserWebhooks; i++ {
+			_, err := webhookService.CreateWebhook(context.Background(), 333, "https://crm.example.com/hooks", nil)
+			require.NoError(t, err)
+		}
+
+		_, err := webhookService.CreateWebhook(context.Background(), 333, "https://crm.example.com/hooks", nil)
+		assert.ErrorIs(t, err, ErrWebhookLimit)
+	})
+}
+
+func TestWebhookDispatcher(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+
+		body, _ := io.ReadAll(r.Body)
+
+		// Получатель проверяет подпись по секрету webhook
+		signature := r.Header.Get(WebhookSignatureHeader)
+		timestamp := strings.TrimPrefix(strings.Split(signature, ",")[0], "t=")
+
+		if signature != SignWebhook("secret", timestamp, body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Header.Get(WebhookEventHeader) != string(model.WebhookOrderProcessed) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	payload := []byte(`{"event":"order.processed","data":{"number":"12345678903"}}`)
+
+	newDelivery := func(id uint64, secret string, attempts uint) model.WebhookDelivery {
+		return model.WebhookDelivery{
+			ID:        id,
+			URL:       srv.URL,
+			Secret:    secret,
+			EventType: model.WebhookOrderProcessed,
+			Payload:   payload,
+			Status:    model.WebhookDeliveryPending,
+			Attempts:  attempts,
+		}
+	}
+
+	webhookRepo := repository.NewTestWebhookRepository()
+	webhookRepo.Deliveries = []model.WebhookDelivery{
+		newDelivery(1, "secret", 0),
+		newDelivery(2, "wrong", 0),
+		newDelivery(3, "wrong", 2),
+	}
+
+	dispatcher := NewWebhookDispatcher(webhookRepo, time.Second, 3)
+	// Тестовый сервер слушает loopback, поэтому проверку адреса здесь отключаем
+	dispatcher.client.SetTransport(http.DefaultTransport)
+
+	now := time.Now()
+	dispatcher.dispatch(context.Background())
+
+	assert.Equal(t, int32(3), atomic.LoadInt32(&requests))
+	require.Len(t, webhookRepo.Updated, 3)
+
+	deliveries := make(map[uint64]model.WebhookDelivery)
+	for _, delivery := range webhookRepo.Deliveries {
+		deliveries[delivery.ID] = delivery
+	}
+
+	// Доставлено с первой попытки
+	assert.Equal(t, model.WebhookDeliveryDelivered, deliveries[1].Status)
+	assert.Equal(t, uint(1), deliveries[1].Attempts)
+	assert.NotNil(t, deliveries[1].DeliveredAt)
+
+	// Повтор откладывается
+	assert.Equal(t, model.WebhookDeliveryPending, deliveries[2].Status)
+	assert.Equal(t, uint(1), deliveries[2].Attempts)
+	assert.Equal(t, "received code = "+strconv.Itoa(http.StatusUnauthorized), deliveries[2].LastError)
+	assert.True(t, deliveries[2].NextAttemptAt.After(now))
+
+	// Попытки исчерпаны
+	assert.Equal(t, model.WebhookDeliveryDead, deliveries[3].Status)
+	assert.Equal(t, uint(3), deliveries[3].Attempts)
+}
+
+func TestWebhookDispatcherShutdown(t *testing.T) {
+	received := make(chan struct{})
+	release := make(chan struct{})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(received)
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	webhookRepo := repository.NewTestWebhookRepository()
+	webhookRepo.Deliveries = []model.WebhookDelivery{
+		{
+			ID:        1,
+			URL:       srv.URL,
+			Secret:    "secret",
+			EventType: model.WebhookOrderProcessed,
+			Payload:   []byte(`{}`),
+			Status:    model.WebhookDeliveryPending,
+		},
+	}
+
+	dispatcher := NewWebhookDispatcher(webhookRepo, time.Second, 1)
+	dispatcher.client.SetTransport(http.DefaultTransport)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dispatcher.dispatch(ctx)
+	}()
+
+	// Остановка сервиса во время отправки не прерывает начатую доставку
+	<-received
+	cancel()
+	close(release)
+	<-done
+
+	require.Len(t, webhookRepo.Deliveries, 1)
+	assert.Equal(t, model.WebhookDeliveryDelivered, webhookRepo.Deliveries[0].Status)
+	assert.Equal(t, uint(1), webhookRepo.Deliveries[0].Attempts)
+}
+
+func TestDeliverCanceled(t *testing.T) {
+	dispatcher := NewWebhookDispatcher(repository.NewTestWebhookRepository(), time.Second, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	now := time.Now()
+
+	// Последняя попытка, прерванная отменой, не переносит доставку в недоставленные
+	delivery := dispatcher.deliver(ctx, model.WebhookDelivery{
+		ID:       1,
+		URL:      "http://93.184.215.14/hooks",
+		Payload:  []byte(`{}`),
+		Status:   model.WebhookDeliveryPending,
+		Attempts: 2,
+	}, now)
+
+	assert.Equal(t, model.WebhookDeliveryPending, delivery.Status)
+	assert.Equal(t, uint(2), delivery.Attempts)
+	assert.Equal(t, now, delivery.NextAttemptAt)
+}
+
+func TestWebhookDispatcherForbiddenAddress(t *testing.T) {
+	var requests int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	// Адрес мог быть публичным при регистрации, но теперь резолвится в loopback
+	webhookRepo := repository.NewTestWebhookRepository()
+	webhookRepo.Deliveries = []model.WebhookDelivery{
+		{
+			ID:        1,
+			URL:       srv.URL,
+			Secret:    "secret",
+			EventType: model.WebhookOrderProcessed,
+			Payload:   []byte(`{}`),
+			Status:    model.WebhookDeliveryPending,
+		},
+	}
+
+	dispatcher := NewWebhookDispatcher(webhookRepo, time.Second, 3)
+	dispatcher.dispatch(context.Background())
+
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+	require.Len(t, webhookRepo.Deliveries, 1)
+	assert.Equal(t, model.WebhookDeliveryPending, webhookRepo.Deliveries[0].Status)
+	assert.Contains(t, webhookRepo.Deliveries[0].LastError, ErrWebhookForbiddenAddress.Error())
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{addr: "93.184.215.14", want: true},
+		{addr: "2606:2800:220:1:248:1893:25c8:1946", want: true},
+		{addr: "127.0.0.1", want: false},
+		{addr: "::1", want: false},
+		{addr: "10.0.0.1", want: false},
+		{addr: "172.16.5.4", want: false},
+		{addr: "192.168.1.1", want: false},
+		{addr: "169.254.169.254", want: false},
+		{addr: "fe80::1", want: false},
+		{addr: "fd00:ec2::254", want: false},
+		{addr: "100.64.0.1", want: false},
+		{addr: "0.0.0.0", want: false},
+		{addr: "::ffff:10.0.0.1", want: false},
+		{addr: "224.0.0.1", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.addr, func(t *testing.T) {
+			assert.Equal(t, tt.want, publicAddr(netip.MustParseAddr(tt.addr)))
+		})
+	}
+}
+
+func TestSignWebhook(t *testing.T) {
+	signature := SignWebhook("secret", "1700000000", []byte(`{}`))
+
+	assert.True(t, strings.HasPrefix(signature, "t=1700000000,v1="))
+	assert.Len(t, strings.TrimPrefix(signature, "t=1700000000,v1="), 64)
+	assert.NotEqual(t, signature, SignWebhook("other", "1700000000", []byte(`{}`)))
+	assert.NotEqual(t, signature, SignWebhook("secret", "1700000001", []byte(`{}`)))
+}
@@ -0,0 +1,189 @@
+package structs
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Количество минимальных единиц (сотых долей) в одном балле
+const MoneyScale = 100
+
+var ErrInvalidMoney = errors.New("invalid money value")
+
+// Money - денежная сумма с фиксированной точностью, хранится в сотых долях балла.
+// В JSON представлена обычным числом (например 729.98), в БД - целым числом сотых
+type Money int64
+
+// Переводим сумму в баллах в Money с округлением до сотых
+func NewMoney(value float64) Money {
+	return Money(math.Round(value * MoneyScale))
+}
+
+// Разбираем десятичную строку вида "729.98" без потери точности
+func ParseMoney(value string) (Money, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0, ErrInvalidMoney
+	}
+
+	negative := false
+	digits := value
+
+	switch digits[0] {
+	case '-':
+		negative = true
+		digits = digits[1:]
+	case '+':
+		digits = digits[1:]
+	}
+
+	intPart, fracPart, hasFrac := strings.Cut(digits, ".")
+
+	// Экспоненциальную запись разбираем через float и округляем
+	if strings.ContainsAny(digits, "eE") {
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return 0, ErrInvalidMoney
+		}
+		return NewMoney(f), nil
+	}
+
+	if len(intPart) == 0 || (hasFrac && len(fracPart) == 0) || strings.ContainsAny(digits, "+-") {
+		return 0, ErrInvalidMoney
+	}
+
+	units, err := strconv.ParseUint(intPart, 10, 64)
+	if err != nil || units > math.MaxInt64/MoneyScale-1 {
+		return 0, ErrInvalidMoney
+	}
+
+	// Лишние знаки после сотых округляем по третьему знаку
+	roundUp := false
+	if len(fracPart) > 2 {
+		if !onlyDigits(fracPart[2:]) {
+			return 0, ErrInvalidMoney
+		}
+		roundUp = fracPart[2] >= '5'
+		fracPart = fracPart[:2]
+	}
+
+	var cents uint64
+	if len(fracPart) > 0 {
+		cents, err = strconv.ParseUint(fracPart, 10, 64)
+		if err != nil {
+			return 0, ErrInvalidMoney
+		}
+		if len(fracPart) == 1 {
+			cents *= 10
+		}
+	}
+
+	if roundUp {
+		cents++
+	}
+
+	result := Money(units*MoneyScale + cents)
+	if negative {
+		result = -result
+	}
+
+	return result, nil
+}
+
+// Строка состоит только из десятичных цифр. Длина не ограничена, в отличие от ParseUint
+func onlyDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Сумма в баллах как число с плавающей точкой, только для отображения
+func (m Money) Float64() float64 {
+	return float64(m) / MoneyScale
+}
+
+// Десятичная запись суммы без лишних нулей: 729.98, 500.5, 42
+func (m Money) String() string {
+	value := int64(m)
+
+	sign := ""
+	if value < 0 {
+		sign = "-"
+	}
+
+	abs := uint64(value)
+	if value < 0 {
+		abs = uint64(-value)
+	}
+
+	units := abs / MoneyScale
+	cents := abs % MoneyScale
+
+	if cents == 0 {
+		return fmt.Sprintf("%s%d", sign, units)
+	}
+
+	frac := strings.TrimRight(fmt.Sprintf("%02d", cents), "0")
+
+	return fmt.Sprintf("%s%d.%s", sign, units, frac)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// null, как и для встроенных числовых типов, оставляет значение без изменений
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+
+	value, err := ParseMoney(string(data))
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidMoney, string(data))
+	}
+
+	*m = value
+
+	return nil
+}
+
+func (m *Money) Scan(src interface{}) error {
+	switch value := src.(type) {
+	case int64:
+		*m = Money(value)
+	case []byte:
+		return m.scanString(string(value))
+	case string:
+		return m.scanString(value)
+	case nil:
+		*m = 0
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidMoney, src)
+	}
+
+	return nil
+}
+
+func (m *Money) scanString(value string) error {
+	units, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidMoney, value)
+	}
+
+	*m = Money(units)
+
+	return nil
+}
+
+func (m Money) Value() (driver.Value, error) {
+	return int64(m), nil
+}
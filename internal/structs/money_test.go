@@ -0,0 +1,118 @@
+package structs
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Money
+		wantErr bool
+	}{
+		{value: "729.98", want: 72998},
+		{value: "500.5", want: 50050},
+		{value: "42", want: 4200},
+		{value: "0.1", want: 10},
+		{value: "-3.07", want: -307},
+		{value: "1.005", want: 101},
+		{value: "1e2", want: 10000},
+		{value: "2.999", want: 300},
+		{value: "0.123456789012345678901234567890", want: 12},
+		{value: "1.994999999999999999999999", want: 199},
+		{value: "1.000000000000000000000000x", wantErr: true},
+		{value: "1.2.3", wantErr: true},
+		{value: "", wantErr: true},
+		{value: "abc", wantErr: true},
+		{value: "1.", wantErr: true},
+		{value: ".5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseMoney(tt.value)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	assert.Equal(t, "729.98", Money(72998).String())
+	assert.Equal(t, "500.5", Money(50050).String())
+	assert.Equal(t, "42", Money(4200).String())
+	assert.Equal(t, "0.01", Money(1).String())
+	assert.Equal(t, "-0.3", Money(-30).String())
+	assert.Equal(t, "0", Money(0).String())
+}
+
+func TestMoneyJSON(t *testing.T) {
+	type balance struct {
+		Current Money  `json:"current"`
+		Accrual *Money `json:"accrual,omitempty"`
+	}
+
+	t.Run("no float drift", func(t *testing.T) {
+		sum := NewMoney(0.1) + NewMoney(0.2)
+
+		data, err := json.Marshal(balance{Current: sum})
+		assert.NoError(t, err)
+		assert.Equal(t, `{"current":0.3}`, string(data))
+	})
+
+	t.Run("unmarshal", func(t *testing.T) {
+		var b balance
+
+		err := json.Unmarshal([]byte(`{"current":500.5,"accrual":729.98}`), &b)
+		assert.NoError(t, err)
+		assert.Equal(t, Money(50050), b.Current)
+
+		if assert.NotNil(t, b.Accrual) {
+			assert.Equal(t, Money(72998), *b.Accrual)
+		}
+	})
+
+	t.Run("unmarshal null", func(t *testing.T) {
+		b := balance{Current: Money(100)}
+
+		err := json.Unmarshal([]byte(`{"current":null,"accrual":null}`), &b)
+		assert.NoError(t, err)
+		assert.Equal(t, Money(100), b.Current)
+		assert.Nil(t, b.Accrual)
+	})
+
+	t.Run("unmarshal invalid", func(t *testing.T) {
+		var b balance
+
+		err := json.Unmarshal([]byte(`{"current":"abc"}`), &b)
+		assert.Error(t, err)
+	})
+}
+
+func TestMoneyScan(t *testing.T) {
+	var m Money
+
+	assert.NoError(t, m.Scan(int64(72998)))
+	assert.Equal(t, Money(72998), m)
+
+	assert.NoError(t, m.Scan([]byte("150")))
+	assert.Equal(t, Money(150), m)
+
+	assert.NoError(t, m.Scan(nil))
+	assert.Equal(t, Money(0), m)
+
+	assert.Error(t, m.Scan(1.5))
+
+	value, err := Money(42).Value()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), value)
+}
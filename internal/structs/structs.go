@@ -2,12 +2,15 @@ package structs
 
 import (
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 	"time"
 )
 
+var ErrInvalidAddress = errors.New("address must be in <host>:<port> format")
+
 // Адрес в формате <хост>:<порт>
 type NetAddress struct {
 	Host string
@@ -22,16 +25,18 @@ func (addr *NetAddress) Set(flagValue string) error {
 	flagValue = strings.Replace(flagValue, "http://", "", 1)
 	addrParts := strings.Split(flagValue, ":")
 
-	if len(addrParts) == 2 {
-		addr.Host = addrParts[0]
-		optPort, err := strconv.Atoi(addrParts[1])
-		if err != nil {
-			return err
-		}
+	if len(addrParts) != 2 {
+		return ErrInvalidAddress
+	}
 
-		addr.Port = optPort
+	optPort, err := strconv.Atoi(addrParts[1])
+	if err != nil || optPort < 1 || optPort > 65535 {
+		return ErrInvalidAddress
 	}
 
+	addr.Host = addrParts[0]
+	addr.Port = optPort
+
 	return nil
 }
 
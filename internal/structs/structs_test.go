@@ -0,0 +1,40 @@
+package structs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetAddressSet(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    NetAddress
+		wantErr bool
+	}{
+		{value: "localhost:8080", want: NetAddress{Host: "localhost", Port: 8080}},
+		{value: "http://accrual:8081", want: NetAddress{Host: "accrual", Port: 8081}},
+		{value: ":9090", want: NetAddress{Host: "", Port: 9090}},
+		{value: "localhost", wantErr: true},
+		{value: "bad address", wantErr: true},
+		{value: "localhost:port", wantErr: true},
+		{value: "localhost:0", wantErr: true},
+		{value: "localhost:65536", wantErr: true},
+		{value: "a:b:c", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			var addr NetAddress
+			err := addr.Set(tt.value)
+
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrInvalidAddress)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, addr)
+		})
+	}
+}
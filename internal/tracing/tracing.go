@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var ErrUnknownExporter = errors.New("unknown trace exporter")
+
+const (
+	ServiceName = "gophermart"
+
+	instrumentationName = "github.com/Sadere/gophermart"
+)
+
+// Трейсер сервиса. Пока провайдер не настроен, спаны не записываются,
+// но контекст трассировки из входящих запросов все равно передается дальше
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Завершаем спан, ошибку отмечаем в нем
+func EndSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// Настроенный провайдер, при остановке сервера дописывает накопленные спаны
+type Provider struct {
+	provider *sdktrace.TracerProvider
+	closer   io.Closer
+}
+
+// Провайдер по строке из конфига:
+//
+//	otlp         — OTLP/HTTP на endpoint, например http://collector:4318.
+//	               Пустой endpoint берется из OTEL_EXPORTER_OTLP_ENDPOINT;
+//	stdout       — JSON в стандартный вывод;
+//	file:<путь>  — JSON в конец файла.
+//
+// Провайдер и W3C propagation становятся глобальными
+func Setup(ctx context.Context, exporter string, endpoint string) (*Provider, error) {
+	spanExporter, closer, err := newExporter(ctx, exporter, endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return &Provider{
+		provider: provider,
+		closer:   closer,
+	}, nil
+}
+
+func (p *Provider) Shutdown(ctx context.Context) error {
+	err := p.provider.Shutdown(ctx)
+
+	if p.closer != nil {
+		err = errors.Join(err, p.closer.Close())
+	}
+
+	return err
+}
+
+func newExporter(ctx context.Context, exporter string, endpoint string) (sdktrace.SpanExporter, io.Closer, error) {
+	switch {
+	case exporter == "otlp":
+		var options []otlptracehttp.Option
+		if len(endpoint) > 0 {
+			options = append(options, otlptracehttp.WithEndpointURL(endpoint))
+		}
+
+		spanExporter, err := otlptracehttp.New(ctx, options...)
+
+		return spanExporter, nil, err
+	case exporter == "stdout":
+		spanExporter, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+		return spanExporter, nil, err
+	case strings.HasPrefix(exporter, "file:"):
+		file, err := os.OpenFile(strings.TrimPrefix(exporter, "file:"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		spanExporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, err
+		}
+
+		return spanExporter, file, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: %s", ErrUnknownExporter, exporter)
+	}
+}
@@ -0,0 +1,65 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestFileExporter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+
+	provider, err := Setup(context.Background(), "file:"+path, "")
+	require.NoError(t, err)
+
+	ctx, span := Tracer().Start(context.Background(), "withdraw")
+	_, child := Tracer().Start(ctx, "query")
+	EndSpan(child, errors.New("lock timeout"))
+	EndSpan(span, nil)
+
+	// Контекст трассировки передается в заголовке traceparent
+	header := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+	assert.Contains(t, header.Get("traceparent"), span.SpanContext().TraceID().String())
+
+	require.NoError(t, provider.Shutdown(context.Background()))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	var names []string
+	statuses := map[string]string{}
+
+	decoder := json.NewDecoder(file)
+	for decoder.More() {
+		var record struct {
+			Name   string
+			Status struct {
+				Code string
+			}
+		}
+		require.NoError(t, decoder.Decode(&record))
+
+		names = append(names, record.Name)
+		statuses[record.Name] = record.Status.Code
+	}
+
+	assert.ElementsMatch(t, []string{"withdraw", "query"}, names)
+	assert.Equal(t, "Error", statuses["query"])
+	assert.Equal(t, "Unset", statuses["withdraw"])
+}
+
+func TestUnknownExporter(t *testing.T) {
+	_, err := Setup(context.Background(), "jaeger", "")
+	assert.ErrorIs(t, err, ErrUnknownExporter)
+}
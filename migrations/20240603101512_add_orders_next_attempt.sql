@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders
+    ADD attempts INTEGER NOT NULL DEFAULT 0,
+    ADD next_attempt_at timestamp NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE orders
+    DROP attempts,
+    DROP next_attempt_at;
+-- +goose StatementEnd
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE orders
+    ADD locked_until timestamp NULL;
+CREATE INDEX pending_orders_idx ON orders (status, next_attempt_at)
+    WHERE status IN ('NEW', 'PROCESSING');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS pending_orders_idx;
+ALTER TABLE orders
+    DROP locked_until;
+-- +goose StatementEnd
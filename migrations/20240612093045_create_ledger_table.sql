@@ -0,0 +1,80 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE ledger_entry_type AS ENUM ('ACCRUAL', 'WITHDRAWAL', 'ADJUSTMENT');
+
+CREATE SEQUENCE IF NOT EXISTS ledger_transaction_seq;
+
+-- Журнал движения баллов по двойной записи: каждая операция -
+-- это две записи с общим transaction_id, сумма которых равна нулю
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    transaction_id BIGINT NOT NULL,
+    account varchar(32) NOT NULL,
+    user_id INTEGER NOT NULL,
+    type ledger_entry_type NOT NULL,
+    amount DOUBLE PRECISION NOT NULL,
+    order_number varchar(255) NULL,
+    created_at timestamp NOT NULL
+);
+CREATE INDEX ledger_user_idx ON ledger_entries (user_id, account, created_at);
+CREATE INDEX ledger_transaction_idx ON ledger_entries (transaction_id);
+
+-- Переносим начисления по обработанным заказам
+WITH src AS (
+    SELECT user_id, number, accrual, created_at, nextval('ledger_transaction_seq') AS tx_id
+    FROM orders
+    WHERE status = 'PROCESSED' AND accrual > 0
+)
+INSERT INTO ledger_entries (transaction_id, account, user_id, type, amount, order_number, created_at)
+SELECT tx_id, 'user', user_id, 'ACCRUAL'::ledger_entry_type, accrual, number, created_at FROM src
+UNION ALL
+SELECT tx_id, 'accrual', user_id, 'ACCRUAL'::ledger_entry_type, -accrual, number, created_at FROM src;
+
+-- Переносим списания
+WITH src AS (
+    SELECT user_id, number, amount, created_at, nextval('ledger_transaction_seq') AS tx_id
+    FROM withdrawals
+)
+INSERT INTO ledger_entries (transaction_id, account, user_id, type, amount, order_number, created_at)
+SELECT tx_id, 'user', user_id, 'WITHDRAWAL'::ledger_entry_type, -amount, number, created_at FROM src
+UNION ALL
+SELECT tx_id, 'withdrawals', user_id, 'WITHDRAWAL'::ledger_entry_type, amount, number, created_at FROM src;
+
+-- Расхождения с текущим балансом оформляем корректировками
+WITH src AS (
+    SELECT
+        u.id AS user_id,
+        u.balance - COALESCE(SUM(l.amount), 0) AS diff,
+        nextval('ledger_transaction_seq') AS tx_id
+    FROM users u
+    LEFT JOIN ledger_entries l ON l.user_id = u.id AND l.account = 'user'
+    GROUP BY u.id, u.balance
+    HAVING u.balance - COALESCE(SUM(l.amount), 0) <> 0
+)
+INSERT INTO ledger_entries (transaction_id, account, user_id, type, amount, order_number, created_at)
+SELECT tx_id, 'user', user_id, 'ADJUSTMENT'::ledger_entry_type, diff, NULL, now() FROM src
+UNION ALL
+SELECT tx_id, 'adjustments', user_id, 'ADJUSTMENT'::ledger_entry_type, -diff, NULL, now() FROM src;
+
+-- Сумма списаний теперь считается по журналу,
+-- users.balance остается кешем текущего баланса из журнала
+ALTER TABLE users DROP withdrawn;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users ADD withdrawn DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+UPDATE users u SET withdrawn = l.withdrawn
+FROM (
+    SELECT user_id, -SUM(amount) AS withdrawn
+    FROM ledger_entries
+    WHERE account = 'user' AND type = 'WITHDRAWAL'
+    GROUP BY user_id
+) l
+WHERE l.user_id = u.id;
+
+DROP TABLE ledger_entries;
+DROP SEQUENCE IF EXISTS ledger_transaction_seq;
+DROP TYPE IF EXISTS ledger_entry_type;
+-- +goose StatementEnd
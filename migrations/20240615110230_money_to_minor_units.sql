@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Денежные суммы храним целым числом сотых долей балла
+ALTER TABLE orders
+    ALTER COLUMN accrual TYPE BIGINT USING round(accrual * 100)::BIGINT;
+
+ALTER TABLE users
+    ALTER COLUMN balance DROP DEFAULT,
+    ALTER COLUMN balance TYPE BIGINT USING round(balance * 100)::BIGINT,
+    ALTER COLUMN balance SET DEFAULT 0;
+
+ALTER TABLE withdrawals
+    ALTER COLUMN amount TYPE BIGINT USING round(amount * 100)::BIGINT;
+
+ALTER TABLE ledger_entries
+    ALTER COLUMN amount TYPE BIGINT USING round(amount * 100)::BIGINT;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE orders
+    ALTER COLUMN accrual TYPE DOUBLE PRECISION USING accrual / 100.0;
+
+ALTER TABLE users
+    ALTER COLUMN balance DROP DEFAULT,
+    ALTER COLUMN balance TYPE DOUBLE PRECISION USING balance / 100.0,
+    ALTER COLUMN balance SET DEFAULT 0;
+
+ALTER TABLE withdrawals
+    ALTER COLUMN amount TYPE DOUBLE PRECISION USING amount / 100.0;
+
+ALTER TABLE ledger_entries
+    ALTER COLUMN amount TYPE DOUBLE PRECISION USING amount / 100.0;
+-- +goose StatementEnd
@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Семейство refresh токенов - одна сессия пользователя,
+-- при отзыве семейства перестают действовать и access токены сессии
+CREATE TABLE IF NOT EXISTS token_families (
+    id varchar(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    created_at timestamp NOT NULL,
+    revoked_at timestamp NULL
+);
+CREATE INDEX token_families_user_idx ON token_families (user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id SERIAL PRIMARY KEY,
+    family_id varchar(64) NOT NULL REFERENCES token_families (id) ON DELETE CASCADE,
+    token_hash varchar(64) NOT NULL UNIQUE,
+    created_at timestamp NOT NULL,
+    expires_at timestamp NOT NULL,
+    used_at timestamp NULL
+);
+CREATE INDEX refresh_tokens_family_idx ON refresh_tokens (family_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE refresh_tokens;
+DROP TABLE token_families;
+-- +goose StatementEnd
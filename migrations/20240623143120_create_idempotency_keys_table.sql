@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Ключи идемпотентности запросов пользователя. Пока запрос выполняется,
+-- response_code пустой, после выполнения хранится ответ для повторов
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id INTEGER NOT NULL,
+    key varchar(255) NOT NULL,
+    request_hash varchar(64) NOT NULL,
+    response_code INTEGER NULL,
+    response_body bytea NULL,
+    created_at timestamp NOT NULL,
+    PRIMARY KEY (user_id, key)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE idempotency_keys;
+-- +goose StatementEnd
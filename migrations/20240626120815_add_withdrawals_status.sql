@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TYPE withdrawal_status AS ENUM ('PENDING', 'COMPLETED', 'CANCELLED', 'REFUNDED');
+
+-- Возврат баллов по отмененному списанию.
+-- Новое значение можно использовать только после коммита, поэтому
+-- повторные списания переводятся в REFUNDED следующей миграцией
+ALTER TYPE ledger_entry_type ADD VALUE IF NOT EXISTS 'REFUND';
+
+ALTER TABLE withdrawals ADD status withdrawal_status NOT NULL DEFAULT 'COMPLETED';
+ALTER TABLE withdrawals ADD updated_at timestamp NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Значение REFUND из ledger_entry_type удалить нельзя, оно остается в типе
+ALTER TABLE withdrawals DROP updated_at;
+ALTER TABLE withdrawals DROP status;
+DROP TYPE IF EXISTS withdrawal_status;
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Раньше один заказ можно было оплатить баллами несколько раз. Оставляем первое
+-- списание по номеру, остальные переводим в REFUNDED и возвращаем баллы по журналу
+WITH dup AS (
+    SELECT id
+    FROM (
+        SELECT id, row_number() OVER (PARTITION BY number ORDER BY id) AS rn
+        FROM withdrawals
+        WHERE status IN ('PENDING', 'COMPLETED')
+    ) w
+    WHERE rn > 1
+), refunded AS (
+    UPDATE withdrawals w
+    SET status = 'REFUNDED', updated_at = now()
+    FROM dup
+    WHERE w.id = dup.id
+    RETURNING w.user_id, w.number, w.amount
+), src AS (
+    SELECT user_id, number, amount, nextval('ledger_transaction_seq') AS tx_id
+    FROM refunded
+), entries AS (
+    INSERT INTO ledger_entries (transaction_id, account, user_id, type, amount, order_number, created_at)
+    SELECT tx_id, 'user', user_id, 'REFUND'::ledger_entry_type, amount, number, now() FROM src
+    UNION ALL
+    SELECT tx_id, 'withdrawals', user_id, 'REFUND'::ledger_entry_type, -amount, number, now() FROM src
+)
+UPDATE users u SET balance = u.balance + r.amount
+FROM (
+    SELECT user_id, SUM(amount) AS amount
+    FROM refunded
+    GROUP BY user_id
+) r
+WHERE r.user_id = u.id;
+
+-- Оплатить заказ баллами можно только один раз, после отмены или возврата номер освобождается
+CREATE UNIQUE INDEX withdrawals_number_idx ON withdrawals (number) WHERE status IN ('PENDING', 'COMPLETED');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Возвращенные дубли остаются в REFUNDED вместе с записями журнала
+DROP INDEX IF EXISTS withdrawals_number_idx;
+-- +goose StatementEnd
@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Строки, нарушающие ограничения, не исправляем автоматически: это деньги и заказы
+-- пользователей. Останавливаем миграцию с отчетом, строки нужно разобрать вручную
+DO $$
+DECLARE
+    orphan_orders bigint;
+    orphan_withdrawals bigint;
+    duplicate_numbers bigint;
+    negative_balances bigint;
+    invalid_amounts bigint;
+BEGIN
+    SELECT count(*) INTO orphan_orders
+    FROM orders o
+    WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = o.user_id);
+
+    SELECT count(*) INTO orphan_withdrawals
+    FROM withdrawals w
+    WHERE NOT EXISTS (SELECT 1 FROM users u WHERE u.id = w.user_id);
+
+    SELECT count(*) INTO duplicate_numbers
+    FROM (SELECT number FROM orders GROUP BY number HAVING count(*) > 1) d;
+
+    SELECT count(*) INTO negative_balances FROM users WHERE balance < 0;
+
+    SELECT count(*) INTO invalid_amounts FROM withdrawals WHERE amount <= 0;
+
+    IF orphan_orders + orphan_withdrawals + duplicate_numbers + negative_balances + invalid_amounts > 0 THEN
+        RAISE EXCEPTION 'existing rows violate core constraints: orders without user = %, withdrawals without user = %, duplicated order numbers = %, negative balances = %, non-positive withdrawals = %',
+            orphan_orders, orphan_withdrawals, duplicate_numbers, negative_balances, invalid_amounts
+            USING HINT = 'fix or remove these rows and run migrations again';
+    END IF;
+END
+$$;
+
+-- Ограничения добавляем без проверки существующих строк, чтобы не держать
+-- эксклюзивную блокировку таблиц на время проверки. Проверка - следующей миграцией
+ALTER TABLE orders
+    ADD CONSTRAINT orders_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+ALTER TABLE withdrawals
+    ADD CONSTRAINT withdrawals_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (id) NOT VALID;
+
+ALTER TABLE users ADD CONSTRAINT users_balance_check CHECK (balance >= 0) NOT VALID;
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_amount_check CHECK (amount > 0) NOT VALID;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_amount_check;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_balance_check;
+
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_user_id_fkey;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_user_id_fkey;
+-- +goose StatementEnd
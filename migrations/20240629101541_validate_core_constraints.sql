@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Проверка существующих строк не блокирует запись в таблицы
+ALTER TABLE orders VALIDATE CONSTRAINT orders_user_id_fkey;
+ALTER TABLE withdrawals VALIDATE CONSTRAINT withdrawals_user_id_fkey;
+ALTER TABLE users VALIDATE CONSTRAINT users_balance_check;
+ALTER TABLE withdrawals VALIDATE CONSTRAINT withdrawals_amount_check;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Проверенные ограничения удаляются предыдущей миграцией
+SELECT 1;
+-- +goose StatementEnd
@@ -0,0 +1,9 @@
+-- +goose NO TRANSACTION
+-- +goose Up
+-- Уникальный индекс строим без блокировки записи в orders. Если прошлая попытка
+-- прервалась, от нее остается невалидный индекс - удаляем его перед построением
+DROP INDEX CONCURRENTLY IF EXISTS orders_number_key;
+CREATE UNIQUE INDEX CONCURRENTLY orders_number_key ON orders (number);
+
+-- +goose Down
+DROP INDEX CONCURRENTLY IF EXISTS orders_number_key;
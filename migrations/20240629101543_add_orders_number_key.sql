@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Номер заказа уникален, уникальный индекс заменяет обычный
+ALTER TABLE orders ADD CONSTRAINT orders_number_key UNIQUE USING INDEX orders_number_key;
+DROP INDEX IF EXISTS number_idx;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE INDEX IF NOT EXISTS number_idx ON orders (number);
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_number_key;
+-- +goose StatementEnd
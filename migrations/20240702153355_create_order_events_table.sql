@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- История заказа: смены статуса и результаты опроса accrual
+CREATE TABLE IF NOT EXISTS order_events (
+    id BIGSERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    from_status order_status NULL,
+    status order_status NOT NULL,
+    result varchar(32) NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    accrual BIGINT NULL,
+    created_at timestamp NOT NULL
+);
+CREATE INDEX order_events_order_idx ON order_events (order_id, id);
+
+-- Для загруженных ранее заказов известно только время загрузки
+INSERT INTO order_events (order_id, status, created_at)
+SELECT id, 'NEW', created_at FROM orders;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE order_events;
+-- +goose StatementEnd
@@ -0,0 +1,40 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Адреса, на которые пользователь получает события. events - типы событий через запятую
+CREATE TABLE IF NOT EXISTS webhooks (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    url TEXT NOT NULL,
+    secret varchar(64) NOT NULL,
+    events TEXT NOT NULL,
+    created_at timestamp NOT NULL
+);
+CREATE INDEX webhooks_user_idx ON webhooks (user_id);
+
+-- Outbox: событие записывается в одной транзакции с изменением,
+-- затем доставляется фоновым процессом. DEAD - попытки доставки исчерпаны
+CREATE TYPE webhook_delivery_status AS ENUM ('PENDING', 'DELIVERED', 'DEAD');
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id BIGSERIAL PRIMARY KEY,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_type varchar(32) NOT NULL,
+    payload JSONB NOT NULL,
+    status webhook_delivery_status NOT NULL DEFAULT 'PENDING',
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at timestamp NOT NULL,
+    locked_until timestamp NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at timestamp NOT NULL,
+    delivered_at timestamp NULL
+);
+CREATE INDEX webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'PENDING';
+CREATE INDEX webhook_deliveries_dead_idx ON webhook_deliveries (webhook_id, id) WHERE status = 'DEAD';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE webhook_deliveries;
+DROP TYPE webhook_delivery_status;
+DROP TABLE webhooks;
+-- +goose StatementEnd
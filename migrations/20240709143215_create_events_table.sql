@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Outbox доменных событий: записываются в транзакции изменения,
+-- затем публикуются во внешний приемник в порядке seq каждого пользователя.
+-- Порядок id не совпадает с порядком коммитов, поэтому по нему не публикуем
+CREATE TABLE IF NOT EXISTS events (
+    id BIGSERIAL PRIMARY KEY,
+    type varchar(64) NOT NULL,
+    user_id INTEGER NOT NULL,
+    seq BIGINT NOT NULL,
+    payload JSONB NOT NULL,
+    created_at timestamp NOT NULL,
+    published_at timestamp NULL
+);
+CREATE UNIQUE INDEX events_user_seq_idx ON events (user_id, seq);
+CREATE INDEX events_unpublished_idx ON events (user_id, seq) WHERE published_at IS NULL;
+CREATE INDEX events_published_idx ON events (published_at) WHERE published_at IS NOT NULL;
+
+-- Последний seq событий пользователя. Строка пользователя блокируется при записи
+-- события до конца транзакции, поэтому события одного пользователя коммитятся в порядке seq
+ALTER TABLE users ADD events_seq BIGINT NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP events_seq;
+DROP TABLE events;
+-- +goose StatementEnd
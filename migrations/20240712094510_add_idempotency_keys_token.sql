@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Токен текущей резервации ключа: ответ сохраняет только ее владелец,
+-- а не запрос, резервацию которого перехватил повтор
+ALTER TABLE idempotency_keys ADD token varchar(64) NULL;
+CREATE INDEX idempotency_keys_created_at_idx ON idempotency_keys (created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX idempotency_keys_created_at_idx;
+ALTER TABLE idempotency_keys DROP token;
+-- +goose StatementEnd
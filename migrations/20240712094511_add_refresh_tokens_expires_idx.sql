@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Индексы фоновой очистки истекших refresh токенов и отозванных сессий
+CREATE INDEX refresh_tokens_expires_idx ON refresh_tokens (expires_at);
+CREATE INDEX token_families_revoked_idx ON token_families (revoked_at) WHERE revoked_at IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX token_families_revoked_idx;
+DROP INDEX refresh_tokens_expires_idx;
+-- +goose StatementEnd